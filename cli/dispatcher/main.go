@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/wosai/havok/apollo"
@@ -18,25 +20,97 @@ import (
 
 type (
 	dispatcherConfig struct {
-		Job      job
-		Fetcher  fetcher
-		Analyzer analyzer
-		Service  service
-		Reporter reporter
+		Job        job
+		Checkpoint checkpoint
+		Profile    dispatcher.LoadProfile
+		Fetcher    fetcher
+		Analyzer   analyzer
+		Filter     filter
+		Redact     redact
+		Reorder    reorder
+		Export     export
+		Service    service
+		Reporter   reporter
 	}
 
 	job struct {
-		Rate  float32
-		Speed float32
-		Begin int64
-		End   int64
+		Rate          float32
+		Speed         float32
+		Begin         int64
+		End           int64
+		IdleThreshold int64              `toml:"idle_threshold"` // 毫秒，日志间隔超过该值时压缩为idle_max，为0时不压缩
+		IdleMax       int64              `toml:"idle_max"`       // 毫秒
+		APIRates      map[string]float32 `toml:"api_rates"`      // 按API调整的回放增益，与rate相乘
+	}
+
+	checkpoint struct {
+		Path     string // 非空时定期保存任务断点
+		Interval int64  // 毫秒
+	}
+
+	filter struct {
+		Rules      []*dispatcher.FilterRule
+		Sample     float64 // 采样比例，(0, 1)之间时启用
+		SampleSalt string  `toml:"sample_salt"`
+	}
+
+	redact struct {
+		Key       string
+		Mask      bool
+		Headers   []string
+		JSONPaths []string `toml:"json_paths"`
+		Query     []string
+		Detectors []string
+		Patterns  map[string]string // 自定义探测器，名称到正则
+	}
+
+	reorder struct {
+		Window    int64  // 毫秒，大于0时启用
+		MaxBuffer int    `toml:"max_buffer"`
+		SpillDir  string `toml:"spill_dir"`
+		Late      string // drop/clamp
+	}
+
+	export struct {
+		Gor             string
+		Capture         string // 抓取文件，记录Fetcher输出的原始日志
+		CaptureRedacted bool   `toml:"capture_redacted"` // 在过滤与脱敏之后抓取
 	}
 
 	fetcher struct {
 		Type string
 		File struct {
+			Path    string
+			Follow  bool
+			Delay   int64 // 毫秒
+			MaxLine int   `toml:"max_line"`
+			Index   bool  // 为压缩文件维护旁路时间索引
+		}
+		Files struct {
+			Paths   []string
+			MaxLine int `toml:"max_line"`
+			Index   bool
+		}
+		Har struct {
+			Path         string
+			KeepResponse bool `toml:"keep_response"`
+		}
+		Ingest struct {
+			Buffer int
+		}
+		Gor struct {
+			Path       string
+			Scheme     string
+			SortWindow int64 `toml:"sort_window"` // 毫秒，0时使用默认值，负数时按文件顺序输出
+		}
+		Capture struct {
 			Path string
 		}
+		Pcap struct {
+			Path   string
+			Filter string
+			Scheme string
+		}
 		Sls struct {
 			AccessKeyId     string `toml:"access_key_id"`
 			AccessKeySecret string `toml:"access_key_secret"`
@@ -48,15 +122,47 @@ type (
 			PreDownload     int `toml:"pre-download"`
 		}
 		Kafka struct {
-			Brokers []string
-			Topic   string
-			Offset  int64
+			Brokers      []string
+			Topic        string
+			Offset       int64
+			Partition    int
+			OffsetByTime bool   `toml:"offset_by_time"`
+			GroupID      string `toml:"group_id"`
+			Envelope     bool
+			KeyHash      bool `toml:"key_hash"`
+		}
+		Elastic struct {
+			Urls      []string
+			Username  string
+			Password  string
+			Index     string
+			Query     string
+			TimeField string `toml:"time_field"`
+			PageSize  int    `toml:"page_size"`
+			KeepAlive string `toml:"keep_alive"`
+		}
+		Synthetic struct {
+			QPS       float64
+			Poisson   bool
+			Seed      int64 // 非0时固定随机数种子
+			Templates []*dispatcher.SyntheticTemplate
+			Shape     []dispatcher.SyntheticPoint
 		}
 	}
 
 	analyzer struct {
-		Name    string
-		Handler []string
+		Name     string
+		Handler  []string
+		BaseURL  string                  `toml:"base_url"`
+		JSON     dispatcher.FieldMapping // json、protobuf、avro共用的字段映射
+		Protobuf struct {
+			DescriptorSet string `toml:"descriptor_set"`
+			Message       string
+		}
+		Avro struct {
+			Schema   string
+			Registry bool // 消息带有schema registry前缀
+		}
 	}
 
 	service struct {
@@ -80,11 +186,9 @@ type (
 
 var (
 	configurationFile string
+	resume            bool
 	version           = "(git commit revision)"
 
-	// TODO add AnalyzeFuncs
-	analyzeFunc = map[string]dispatcher.AnalyzeFunc{}
-
 	defaultMux *http.ServeMux
 
 	reporterInfluxdbURL      = "REPORTER_INFLUXDB_URL"
@@ -95,6 +199,7 @@ var (
 
 func init() {
 	flag.StringVar(&configurationFile, "config", "", "dispatcher配置文件")
+	flag.BoolVar(&resume, "resume", false, "从checkpoint.path记录的断点继续任务")
 }
 
 func currentFilePath() string {
@@ -138,7 +243,7 @@ func main() {
 	defaultReporter := startReporter(conf, defaultReplayerManager)
 
 	// job 初始化行为
-	go startJob(conf)
+	go startJob(conf, defaultReporter)
 
 	go func() {
 		dispatcher.DefaultHavok.WithHashFunc(dispatcher.DefaultFNVHashPool.Hash).
@@ -211,12 +316,13 @@ func startReporter(conf dispatcherConfig, rm *dispatcher.ReplayerManager) *dispa
 	return rep
 }
 
-func startJob(conf dispatcherConfig) {
+func startJob(conf dispatcherConfig, rep *dispatcher.Reporter) {
 	jobConf := &pb.JobConfiguration{
-		Rate:  conf.Job.Rate,
-		Speed: conf.Job.Speed,
-		Begin: conf.Job.Begin,
-		End:   conf.Job.End,
+		Rate:     conf.Job.Rate,
+		Speed:    conf.Job.Speed,
+		Begin:    conf.Job.Begin,
+		End:      conf.Job.End,
+		ApiRates: conf.Job.APIRates,
 	}
 	job, err := dispatcher.NewJob(jobConf)
 	if err != nil {
@@ -229,7 +335,45 @@ func startJob(conf dispatcherConfig) {
 	switch conf.Fetcher.Type {
 
 	case "file":
-		fetcher = dispatcher.NewFileFetcher(conf.Fetcher.File.Path)
+		ff := dispatcher.NewFileFetcher(conf.Fetcher.File.Path).WithMaxLineSize(conf.Fetcher.File.MaxLine).WithIndex(conf.Fetcher.File.Index)
+		if conf.Fetcher.File.Follow {
+			ff.WithFollow(time.Duration(conf.Fetcher.File.Delay) * time.Millisecond)
+		}
+		fetcher = ff
+
+	case "har":
+		fetcher = dispatcher.NewHARFetcher(conf.Fetcher.Har.Path).WithResponse(conf.Fetcher.Har.KeepResponse)
+
+	case "ingest":
+		ing := dispatcher.NewIngestFetcher().WithBuffer(conf.Fetcher.Ingest.Buffer)
+		handle(defaultMux, ing) // 推送接口
+		fetcher = ing
+
+	case "gor":
+		gf := dispatcher.NewGoReplayFetcher(conf.Fetcher.Gor.Path).WithScheme(conf.Fetcher.Gor.Scheme)
+		if w := conf.Fetcher.Gor.SortWindow; w > 0 {
+			gf.WithSortWindow(time.Duration(w) * time.Millisecond)
+		} else if w < 0 {
+			gf.WithSortWindow(0)
+		}
+		fetcher = gf
+
+	case "capture":
+		fetcher = dispatcher.NewCaptureFetcher(conf.Fetcher.Capture.Path)
+
+	case "pcap":
+		pf, err := dispatcher.NewPCAPFetcher(conf.Fetcher.Pcap.Path, conf.Fetcher.Pcap.Filter)
+		if err != nil {
+			panic(err)
+		}
+		fetcher = pf.WithScheme(conf.Fetcher.Pcap.Scheme)
+
+	case "files":
+		mff, err := dispatcher.NewMultipleFilesFetcher(conf.Fetcher.Files.Paths...)
+		if err != nil {
+			panic(err)
+		}
+		fetcher = mff.WithMaxLineSize(conf.Fetcher.Files.MaxLine).WithIndex(conf.Fetcher.Files.Index)
 
 	case "concurrency-sls", "sls":
 		if conf.Fetcher.Sls.AccessKeyId == "" {
@@ -245,14 +389,54 @@ func startJob(conf dispatcherConfig) {
 		if err != nil {
 			panic(err)
 		}
+		// 开启重排序时保留原始日志时间，否则修正到查询时间块内
+		fetcher.(*dispatcher.AliyunSLSConcurrencyFetcher).WithKeepTime(conf.Reorder.Window > 0)
 		handle(defaultMux, fetcher.(*dispatcher.AliyunSLSConcurrencyFetcher)) // sls接口
 
 	case "kafka-single-partition":
-		fetcher, err = dispatcher.NewKafkaSinglePartitionFetcher(conf.Fetcher.Kafka.Brokers, conf.Fetcher.Kafka.Topic, conf.Fetcher.Kafka.Offset)
+		kspf, err := dispatcher.NewKafkaSinglePartitionFetcher(conf.Fetcher.Kafka.Brokers, conf.Fetcher.Kafka.Topic, conf.Fetcher.Kafka.Offset)
+		if err != nil {
+			panic(err)
+		}
+		fetcher = kspf.WithPartition(conf.Fetcher.Kafka.Partition).
+			WithOffsetByTime(conf.Fetcher.Kafka.OffsetByTime).
+			WithGroup(conf.Fetcher.Kafka.GroupID).
+			WithEnvelope(conf.Fetcher.Kafka.Envelope).
+			WithKeyHash(conf.Fetcher.Kafka.KeyHash)
+		handle(defaultMux, kspf)
+
+	case "kafka":
+		kf, err := dispatcher.NewKafkaFetcher(conf.Fetcher.Kafka.Brokers, conf.Fetcher.Kafka.Topic)
 		if err != nil {
 			panic(err)
 		}
-		handle(defaultMux, fetcher.(*dispatcher.KafkaSinglePartitionFetcher))
+		fetcher = kf.WithEnvelope(conf.Fetcher.Kafka.Envelope).WithKeyHash(conf.Fetcher.Kafka.KeyHash)
+		handle(defaultMux, kf)
+
+	case "elastic":
+		ef, err := dispatcher.NewElasticFetcher(conf.Fetcher.Elastic.Urls, conf.Fetcher.Elastic.Username,
+			conf.Fetcher.Elastic.Password, conf.Fetcher.Elastic.Index, conf.Fetcher.Elastic.Query)
+		if err != nil {
+			panic(err)
+		}
+		fetcher = ef.WithTimeField(conf.Fetcher.Elastic.TimeField).WithPageSize(conf.Fetcher.Elastic.PageSize).
+			WithKeepAlive(conf.Fetcher.Elastic.KeepAlive)
+		handle(defaultMux, ef)
+
+	case "synthetic":
+		sf, err := dispatcher.NewSyntheticFetcher(conf.Fetcher.Synthetic.Templates, conf.Fetcher.Synthetic.QPS)
+		if err != nil {
+			panic(err)
+		}
+		if _, err = sf.WithShape(conf.Fetcher.Synthetic.Shape); err != nil {
+			panic(err)
+		}
+		sf.WithPoisson(conf.Fetcher.Synthetic.Poisson)
+		if conf.Fetcher.Synthetic.Seed != 0 {
+			sf.WithSeed(conf.Fetcher.Synthetic.Seed)
+		}
+		fetcher = sf
+		handle(defaultMux, sf)
 
 	default:
 		panic(errors.New("unknown fetcher type"))
@@ -261,12 +445,49 @@ func startJob(conf dispatcherConfig) {
 	var analyzer dispatcher.Analyzer
 
 	switch conf.Analyzer.Name {
+	case "json":
+		ja, err := dispatcher.NewJSONAnalyzer(&conf.Analyzer.JSON)
+		if err != nil {
+			dispatcher.Logger.Error("bad json analyzer configuration", zap.Error(err))
+			os.Exit(1)
+		}
+		analyzer = ja
+	case "protobuf":
+		pa, err := dispatcher.NewProtobufAnalyzer(conf.Analyzer.Protobuf.DescriptorSet, conf.Analyzer.Protobuf.Message, &conf.Analyzer.JSON)
+		if err != nil {
+			dispatcher.Logger.Error("bad protobuf analyzer configuration", zap.Error(err))
+			os.Exit(1)
+		}
+		analyzer = pa
+	case "avro":
+		aa, err := dispatcher.NewAvroAnalyzer(conf.Analyzer.Avro.Schema, &conf.Analyzer.JSON)
+		if err != nil {
+			dispatcher.Logger.Error("bad avro analyzer configuration", zap.Error(err))
+			os.Exit(1)
+		}
+		analyzer = aa.WithSchemaRegistry(conf.Analyzer.Avro.Registry)
 	default:
 		analyzer = dispatcher.NewBaseAnalyzer()
 	}
 
-	for _, f := range conf.Analyzer.Handler {
-		analyzer.Use(analyzeFunc[f])
+	if conf.Analyzer.BaseURL != "" {
+		dispatcher.AccessLogBaseURL = conf.Analyzer.BaseURL
+	}
+	logRecord := false
+	for _, name := range conf.Analyzer.Handler {
+		if name == "" {
+			continue
+		}
+		logRecord = logRecord || name == "log_record"
+		f, ok := dispatcher.LookupAnalyzeFunc(name)
+		if !ok {
+			panic(errors.New("unknown analyzer handler: " + name))
+		}
+		analyzer.Use(f)
+	}
+	if ba, ok := analyzer.(*dispatcher.BaseAnalyzer); ok && conf.Fetcher.Type == "ingest" && !logRecord {
+		// 推送接口总是接受LogRecord的JSON格式，配置的handler用于推送原始访问日志
+		ba.Use(dispatcher.AnalyzeLogRecordJSON)
 	}
 	fetcher.WithAnalyzer(analyzer)
 
@@ -275,8 +496,121 @@ func startJob(conf dispatcherConfig) {
 		dispatcher.Logger.Error("bad time wheel", zap.Error(err))
 		os.Exit(1)
 	}
+	if conf.Job.IdleThreshold > 0 {
+		wheel.WithIdleCompression(time.Duration(conf.Job.IdleThreshold)*time.Millisecond, time.Duration(conf.Job.IdleMax)*time.Millisecond)
+		rep.WithPerformanceSource("timewheel", wheel.PerformanceStats)
+	}
 	job.WithTimeWheel(wheel).WithFetcher(fetcher).UseDefaultHavok()
 
+	if conf.Checkpoint.Path != "" {
+		job.WithCheckpoint(conf.Checkpoint.Path, time.Duration(conf.Checkpoint.Interval)*time.Millisecond)
+	}
+	if resume {
+		resumeJob(job, conf.Checkpoint.Path)
+	}
+	if conf.Profile.Type != "" {
+		if _, err = job.WithLoadProfile(&conf.Profile); err != nil {
+			dispatcher.Logger.Error("bad load profile", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+
+	// 默认抓取Fetcher输出的原始日志，须位于其他Stage之前；capture_redacted时位于RedactStage之后
+	var ce *dispatcher.CaptureExporter
+	if conf.Export.Capture != "" {
+		ce, err = dispatcher.NewCaptureExporter(conf.Export.Capture)
+		if err != nil {
+			dispatcher.Logger.Error("failed to create capture exporter", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+	redact := len(conf.Redact.Headers)+len(conf.Redact.JSONPaths)+len(conf.Redact.Query)+len(conf.Redact.Detectors)+len(conf.Redact.Patterns) > 0
+	if ce != nil && !conf.Export.CaptureRedacted {
+		if redact {
+			dispatcher.Logger.Warn("capture exporter runs before redact stage, sensitive fields are written to capture file in clear text, set export.capture_redacted to capture after redaction",
+				zap.String("capture", conf.Export.Capture))
+		}
+		job.WithStage(ce)
+	}
+
+	if len(conf.Filter.Rules) > 0 || (conf.Filter.Sample > 0 && conf.Filter.Sample < 1) {
+		fs, err := dispatcher.NewFilterStage(conf.Filter.Rules)
+		if err != nil {
+			dispatcher.Logger.Error("bad filter rules", zap.Error(err))
+			os.Exit(1)
+		}
+		fs.WithSampling(conf.Filter.Sample, conf.Filter.SampleSalt)
+		job.WithStage(fs)
+		handle(defaultMux, fs)
+	}
+
+	if r := conf.Redact; redact {
+		rs, err := dispatcher.NewRedactStage(r.Key).WithMask(r.Mask).
+			WithHeaders(r.Headers...).
+			WithJSONPaths(r.JSONPaths...).
+			WithQuery(r.Query...).
+			WithDetectors(r.Detectors...)
+		if err != nil {
+			dispatcher.Logger.Error("bad redact config", zap.Error(err))
+			os.Exit(1)
+		}
+		for name, pattern := range r.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				dispatcher.Logger.Error("bad redact pattern", zap.String("name", name), zap.Error(err))
+				os.Exit(1)
+			}
+			rs.WithDetector(name, re)
+		}
+		job.WithStage(rs)
+		handle(defaultMux, rs)
+	}
+	if ce != nil && conf.Export.CaptureRedacted {
+		job.WithStage(ce)
+	}
+
+	if conf.Reorder.Window > 0 {
+		rs := dispatcher.NewReorderStage(time.Duration(conf.Reorder.Window) * time.Millisecond).
+			WithMaxBuffer(conf.Reorder.MaxBuffer).
+			WithSpill(conf.Reorder.SpillDir).
+			WithClamp(conf.Reorder.Late == "clamp")
+		job.WithStage(rs)
+		handle(defaultMux, rs)
+	}
+
+	if conf.Export.Gor != "" {
+		exporter, err := dispatcher.NewGoReplayExporter(conf.Export.Gor)
+		if err != nil {
+			dispatcher.Logger.Error("failed to create gor exporter", zap.Error(err))
+			os.Exit(1)
+		}
+		job.WithStage(exporter)
+	}
+
 	handle(defaultMux, job)
 	handle(defaultMux, dispatcher.DefaultHavok)
 }
+
+// resumeJob 从断点恢复任务配置与读取位置，断点不存在或者任务已完成时从头开始
+func resumeJob(job *dispatcher.Job, path string) {
+	if path == "" {
+		dispatcher.Logger.Error("checkpoint.path is required to resume job")
+		os.Exit(1)
+	}
+	cp, err := dispatcher.LoadCheckpoint(path)
+	if os.IsNotExist(err) {
+		dispatcher.Logger.Warn("no checkpoint found, start job from the beginning", zap.String("path", path))
+		return
+	}
+	if err == nil {
+		err = job.Resume(cp)
+	}
+	if err == dispatcher.ErrCheckpointFinished {
+		dispatcher.Logger.Warn("job in checkpoint has finished, start job from the beginning", zap.String("path", path))
+		return
+	}
+	if err != nil {
+		dispatcher.Logger.Error("failed to resume job from checkpoint", zap.String("path", path), zap.Error(err))
+		os.Exit(1)
+	}
+}
@@ -1,5 +1,7 @@
 package dispatcher
 
+import "sync"
+
 type (
 	// Analyzer 日志内容解析器
 	Analyzer interface {
@@ -16,6 +18,26 @@ type (
 	AnalyzeFunc func([]byte) (*LogRecordWrapper, bool)
 )
 
+var (
+	analyzeFuncs   = map[string]AnalyzeFunc{}
+	analyzeFuncsMu sync.RWMutex
+)
+
+// RegisterAnalyzeFunc 注册AnalyzeFunc，注册后可在配置文件中通过名称引用，重复注册会覆盖
+func RegisterAnalyzeFunc(name string, f AnalyzeFunc) {
+	analyzeFuncsMu.Lock()
+	defer analyzeFuncsMu.Unlock()
+	analyzeFuncs[name] = f
+}
+
+// LookupAnalyzeFunc 根据名称查找已注册的AnalyzeFunc
+func LookupAnalyzeFunc(name string) (AnalyzeFunc, bool) {
+	analyzeFuncsMu.RLock()
+	defer analyzeFuncsMu.RUnlock()
+	f, ok := analyzeFuncs[name]
+	return f, ok
+}
+
 // NewBaseAnalyzer BaseAnalyzer实例化
 func NewBaseAnalyzer() *BaseAnalyzer {
 	return &BaseAnalyzer{
@@ -0,0 +1,349 @@
+package dispatcher
+
+import (
+	"bytes"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+type (
+	// jsonAccessLogFormat JSON格式访问日志的字段约定，每一项按顺序取第一个非空字段
+	jsonAccessLogFormat struct {
+		timeKeys     []string
+		methodKeys   []string
+		uriKeys      []string
+		hostKeys     []string
+		schemeKeys   []string
+		bodyKeys     []string
+		headerKeys   map[string]string // 日志字段 -> 请求头
+		headerPrefix string            // 带该前缀的字段均视为请求头，如nginx的$http_user_agent
+	}
+)
+
+var (
+	// AccessLogBaseURL 访问日志中缺少host信息时（如nginx combined格式）使用的scheme与host
+	AccessLogBaseURL = "http://127.0.0.1"
+
+	// combinedLogPattern 兼容Apache common/combined以及nginx combined格式，referer与user-agent为可选
+	combinedLogPattern = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}|-) (\S+)(?: "([^"]*)" "([^"]*)")?`)
+	nginxHexEscape     = regexp.MustCompile(`\\x[0-9A-Fa-f]{2}`)
+
+	logTimeLayouts = []string{
+		time.RFC3339Nano,
+		"02/Jan/2006:15:04:05 -0700",
+		"2006-01-02 15:04:05.000",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05.000Z0700",
+	}
+
+	nginxJSONFormat = &jsonAccessLogFormat{
+		timeKeys:     []string{"msec", "time_iso8601", "time_local", "@timestamp", "timestamp", "time"},
+		methodKeys:   []string{"request_method", "method"},
+		uriKeys:      []string{"request_uri", "uri"},
+		hostKeys:     []string{"host", "http_host", "server_name"},
+		schemeKeys:   []string{"scheme"},
+		bodyKeys:     []string{"request_body"},
+		headerPrefix: "http_",
+	}
+
+	envoyJSONFormat = &jsonAccessLogFormat{
+		timeKeys:   []string{"start_time", "timestamp"},
+		methodKeys: []string{"method"},
+		uriKeys:    []string{"path"},
+		hostKeys:   []string{"authority"},
+		schemeKeys: []string{"scheme"},
+		bodyKeys:   []string{"request_body"},
+		headerKeys: map[string]string{
+			"user_agent":      "User-Agent",
+			"x_forwarded_for": "X-Forwarded-For",
+			"request_id":      "X-Request-Id",
+			"referer":         "Referer",
+		},
+	}
+
+	aliyunSLBFormat = &jsonAccessLogFormat{
+		timeKeys:     []string{"time", "__time__"},
+		methodKeys:   []string{"request_method"},
+		uriKeys:      []string{"request_uri"},
+		hostKeys:     []string{"host", "http_host"},
+		schemeKeys:   []string{"scheme"},
+		headerPrefix: "http_",
+	}
+)
+
+func init() {
+	RegisterAnalyzeFunc("nginx_combined", AnalyzeCombinedLog)
+	RegisterAnalyzeFunc("apache_combined", AnalyzeCombinedLog)
+	RegisterAnalyzeFunc("apache_common", AnalyzeCombinedLog)
+	RegisterAnalyzeFunc("nginx_json", AnalyzeNginxJSONLog)
+	RegisterAnalyzeFunc("envoy_json", AnalyzeEnvoyJSONLog)
+	RegisterAnalyzeFunc("istio_json", AnalyzeEnvoyJSONLog)
+	RegisterAnalyzeFunc("aws_alb", AnalyzeAWSLoadBalancerLog)
+	RegisterAnalyzeFunc("aws_elb", AnalyzeAWSLoadBalancerLog)
+	RegisterAnalyzeFunc("aliyun_slb", AnalyzeAliyunSLBLog)
+}
+
+// AnalyzeCombinedLog 解析Apache common/combined以及nginx默认的combined格式日志
+func AnalyzeCombinedLog(data []byte) (*LogRecordWrapper, bool) {
+	m := combinedLogPattern.FindSubmatch(data)
+	if m == nil {
+		return nil, false
+	}
+	at, ok := parseLogTime(string(m[3]))
+	if !ok {
+		return nil, false
+	}
+	method, uri, ok := parseRequestLine(unescapeNginx(string(m[4])))
+	if !ok {
+		return nil, false
+	}
+
+	header := map[string]string{}
+	if ua := unescapeNginx(string(m[8])); ua != "" && ua != "-" {
+		header["User-Agent"] = ua
+	}
+	if referer := unescapeNginx(string(m[7])); referer != "" && referer != "-" {
+		header["Referer"] = referer
+	}
+	return &LogRecordWrapper{
+		OccurAt:   at,
+		LogRecord: &pb.LogRecord{Url: buildLogURL("", "", uri), Method: method, Header: header},
+	}, true
+}
+
+// AnalyzeNginxJSONLog 解析nginx JSON格式的log_format，$http_*字段会被还原为请求头
+func AnalyzeNginxJSONLog(data []byte) (*LogRecordWrapper, bool) {
+	if fields, ok := jsonLogFields(data); ok {
+		return nginxJSONFormat.analyze(fields)
+	}
+	if !bytes.Contains(data, []byte(`\x`)) {
+		return nil, false
+	}
+	// 未设置escape=json时，nginx会把特殊字符转义成\xHH，不是合法的JSON
+	fields, ok := jsonLogFields(bytes.ReplaceAll(data, []byte(`\x`), []byte(`\u00`)))
+	if !ok {
+		return nil, false
+	}
+	return nginxJSONFormat.analyze(fields)
+}
+
+// AnalyzeEnvoyJSONLog 解析Envoy/Istio默认字段的JSON访问日志
+func AnalyzeEnvoyJSONLog(data []byte) (*LogRecordWrapper, bool) {
+	fields, ok := jsonLogFields(data)
+	if !ok {
+		return nil, false
+	}
+	return envoyJSONFormat.analyze(fields)
+}
+
+// AnalyzeAliyunSLBLog 解析投递到SLS的阿里云SLB七层访问日志
+func AnalyzeAliyunSLBLog(data []byte) (*LogRecordWrapper, bool) {
+	fields, ok := jsonLogFields(data)
+	if !ok {
+		return nil, false
+	}
+	return aliyunSLBFormat.analyze(fields)
+}
+
+// AnalyzeAWSLoadBalancerLog 解析AWS ALB以及Classic ELB访问日志
+func AnalyzeAWSLoadBalancerLog(data []byte) (*LogRecordWrapper, bool) {
+	fields := splitQuotedFields(string(data))
+	if len(fields) < 13 {
+		return nil, false
+	}
+
+	// Classic ELB以时间开头，ALB以请求类型开头
+	timeIndex, requestIndex, traceIndex := 0, 11, -1
+	if _, ok := parseLogTime(fields[0]); !ok {
+		timeIndex, requestIndex, traceIndex = 1, 12, 17
+	}
+	at, ok := parseLogTime(fields[timeIndex])
+	if !ok || len(fields) <= requestIndex+1 {
+		return nil, false
+	}
+	method, uri, ok := parseRequestLine(fields[requestIndex])
+	if !ok {
+		return nil, false
+	}
+
+	header := map[string]string{}
+	if ua := fields[requestIndex+1]; ua != "" && ua != "-" {
+		header["User-Agent"] = ua
+	}
+	if traceIndex > 0 && len(fields) > traceIndex && fields[traceIndex] != "-" {
+		header["X-Amzn-Trace-Id"] = fields[traceIndex]
+	}
+	return &LogRecordWrapper{
+		OccurAt:   at,
+		LogRecord: &pb.LogRecord{Url: buildLogURL("", "", uri), Method: method, Header: header},
+	}, true
+}
+
+func (f *jsonAccessLogFormat) analyze(fields map[string]string) (*LogRecordWrapper, bool) {
+	at, ok := parseLogTime(firstField(fields, f.timeKeys))
+	if !ok {
+		return nil, false
+	}
+	method := firstField(fields, f.methodKeys)
+	uri := firstField(fields, f.uriKeys)
+	if method == "" || uri == "" {
+		if method, uri, ok = parseRequestLine(fields["request"]); !ok {
+			return nil, false
+		}
+	}
+
+	header := map[string]string{}
+	for k, v := range fields {
+		if v == "" || v == "-" {
+			continue
+		}
+		if name, ok := f.headerKeys[k]; ok {
+			header[name] = v
+		} else if f.headerPrefix != "" && strings.HasPrefix(k, f.headerPrefix) && k != "http_host" {
+			header[textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(strings.TrimPrefix(k, f.headerPrefix), "_", "-"))] = v
+		}
+	}
+
+	var body []byte
+	if b := firstField(fields, f.bodyKeys); b != "" {
+		body = []byte(unescapeNginx(b))
+	}
+	return &LogRecordWrapper{
+		OccurAt: at,
+		LogRecord: &pb.LogRecord{
+			Url:    buildLogURL(firstField(fields, f.schemeKeys), firstField(fields, f.hostKeys), uri),
+			Method: strings.ToUpper(method),
+			Header: header,
+			Body:   body,
+		},
+	}, true
+}
+
+// jsonLogFields 取出JSON对象的顶层字段，非字符串的值保留原始内容
+func jsonLogFields(data []byte) (map[string]string, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, false
+	}
+	fields := map[string]string{}
+	err := jsonparser.ObjectEach(data, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		if dataType == jsonparser.String {
+			s, err := jsonparser.ParseString(value)
+			if err != nil {
+				return err
+			}
+			fields[string(key)] = s
+		} else if dataType != jsonparser.Null {
+			fields[string(key)] = string(value)
+		}
+		return nil
+	})
+	return fields, err == nil
+}
+
+func firstField(fields map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v := fields[k]; v != "" && v != "-" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseLogTime 解析常见的日志时间格式，以及秒/毫秒/微秒/纳秒级别的时间戳
+func parseLogTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		switch {
+		case f < 1e11: // 秒，如nginx的$msec: 1532058494.123
+			sec := int64(f)
+			return time.Unix(sec, int64((f-float64(sec))*1e9)).Round(time.Microsecond), true
+		case f < 1e14:
+			return ParseMSec(int64(f)), true
+		case f < 1e17:
+			return time.Unix(0, int64(f)*1e3), true
+		default:
+			return time.Unix(0, int64(f)), true
+		}
+	}
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseRequestLine 解析形如"GET /path?a=b HTTP/1.1"的请求行
+func parseRequestLine(line string) (string, string, bool) {
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	return strings.ToUpper(parts[0]), parts[1], true
+}
+
+// buildLogURL 拼接完整的请求地址，uri已经是完整地址时直接返回
+func buildLogURL(scheme, host, uri string) string {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return uri
+	}
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	if host == "" {
+		return strings.TrimSuffix(AccessLogBaseURL, "/") + uri
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	return (&url.URL{Scheme: scheme, Host: host}).String() + uri
+}
+
+// unescapeNginx 还原nginx对特殊字符的\xHH转义
+func unescapeNginx(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	return nginxHexEscape.ReplaceAllStringFunc(s, func(m string) string {
+		b, _ := strconv.ParseUint(m[2:], 16, 8)
+		return string([]byte{byte(b)})
+	})
+}
+
+// splitQuotedFields 按空格切分日志，双引号包裹的内容视为一个字段
+func splitQuotedFields(s string) []string {
+	var fields []string
+	var buf strings.Builder
+	quoted, inField := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inField = true
+		case (c == ' ' || c == '\t' || c == '\n' || c == '\r') && !quoted:
+			if inField {
+				fields = append(fields, buf.String())
+				buf.Reset()
+				inField = false
+			}
+		default:
+			buf.WriteByte(c)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, buf.String())
+	}
+	return fields
+}
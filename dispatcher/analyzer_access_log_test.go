@@ -0,0 +1,83 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeCombinedLog(t *testing.T) {
+	log, ok := AnalyzeCombinedLog([]byte(`10.1.2.3 - - [10/Oct/2000:13:55:36 -0700] "POST /v2/orders?id=1 HTTP/1.1" 200 2326 "-" "curl/7.46.0 \x22x\x22"`))
+	assert.True(t, ok)
+	assert.Equal(t, "POST", log.Method)
+	assert.Equal(t, AccessLogBaseURL+"/v2/orders?id=1", log.Url)
+	assert.Equal(t, `curl/7.46.0 "x"`, log.Header["User-Agent"])
+	assert.NotContains(t, log.Header, "Referer")
+	assert.Equal(t, time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC), log.OccurAt.UTC())
+
+	// apache common
+	log, ok = AnalyzeCombinedLog([]byte(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`))
+	assert.True(t, ok)
+	assert.Equal(t, "GET", log.Method)
+	assert.Empty(t, log.Header)
+
+	_, ok = AnalyzeCombinedLog([]byte(`not an access log`))
+	assert.False(t, ok)
+}
+
+func TestAnalyzeNginxJSONLog(t *testing.T) {
+	log, ok := AnalyzeNginxJSONLog([]byte(`{"msec":"1532058494.123","request_method":"post","request_uri":"/pay/precreate","host":"api.example.com","scheme":"https","http_user_agent":"okhttp","http_x_forwarded_for":"-","request_body":"{\"a\":1}"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "POST", log.Method)
+	assert.Equal(t, "https://api.example.com/pay/precreate", log.Url)
+	assert.Equal(t, map[string]string{"User-Agent": "okhttp"}, log.Header)
+	assert.Equal(t, `{"a":1}`, string(log.Body))
+	assert.Equal(t, int64(1532058494123), log.OccurAt.UnixNano()/1e6)
+
+	// 未设置escape=json
+	log, ok = AnalyzeNginxJSONLog([]byte(`{"time_iso8601":"2018-07-20T11:48:14+08:00","request":"PUT /a HTTP/1.1","request_body":"{\x22a\x22:1}"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "PUT", log.Method)
+	assert.Equal(t, `{"a":1}`, string(log.Body))
+}
+
+func TestAnalyzeEnvoyJSONLog(t *testing.T) {
+	log, ok := AnalyzeEnvoyJSONLog([]byte(`{"start_time":"2020-11-23T08:00:01.123Z","method":"GET","path":"/api/v1/users?page=2","protocol":"HTTP/1.1","authority":"users.svc:8080","user_agent":"Go-http-client/1.1","x_forwarded_for":null,"request_id":"abc"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "http://users.svc:8080/api/v1/users?page=2", log.Url)
+	assert.Equal(t, map[string]string{"User-Agent": "Go-http-client/1.1", "X-Request-Id": "abc"}, log.Header)
+	assert.Equal(t, time.Date(2020, 11, 23, 8, 0, 1, 123e6, time.UTC), log.OccurAt.UTC())
+}
+
+func TestAnalyzeAWSLoadBalancerLog(t *testing.T) {
+	alb := `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/?a=b HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-"`
+	log, ok := AnalyzeAWSLoadBalancerLog([]byte(alb))
+	assert.True(t, ok)
+	assert.Equal(t, "GET", log.Method)
+	assert.Equal(t, "http://www.example.com:80/?a=b", log.Url)
+	assert.Equal(t, "Root=1-58337262-36d228ad5d99923122bbe354", log.Header["X-Amzn-Trace-Id"])
+
+	elb := `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`
+	log, ok = AnalyzeAWSLoadBalancerLog([]byte(elb))
+	assert.True(t, ok)
+	assert.Equal(t, "curl/7.38.0", log.Header["User-Agent"])
+	assert.Equal(t, 2015, log.OccurAt.Year())
+}
+
+func TestAnalyzeAliyunSLBLog(t *testing.T) {
+	log, ok := AnalyzeAliyunSLBLog([]byte(`{"__time__":"1532058494","host":"api.example.com","request_method":"GET","request_uri":"/status","scheme":"https","http_user_agent":"curl","http_x_real_ip":"1.2.3.4"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "https://api.example.com/status", log.Url)
+	assert.Equal(t, "1.2.3.4", log.Header["X-Real-Ip"])
+	assert.Equal(t, int64(1532058494), log.OccurAt.Unix())
+}
+
+func TestLookupAnalyzeFunc(t *testing.T) {
+	for _, name := range []string{"nginx_combined", "nginx_json", "envoy_json", "istio_json", "apache_common", "aws_alb", "aliyun_slb"} {
+		_, ok := LookupAnalyzeFunc(name)
+		assert.True(t, ok, name)
+	}
+	_, ok := LookupAnalyzeFunc("unknown")
+	assert.False(t, ok)
+}
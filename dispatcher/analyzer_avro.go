@@ -0,0 +1,414 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type (
+	// AvroAnalyzer 根据Avro schema解码二进制消息，转换为JSON后按FieldMapping映射，映射失败时依次尝试通过Use添加的AnalyzeFunc
+	//
+	// 转换时union直接输出所选分支的值（不包装类型名），bytes与fixed为base64编码（body_encoding = "base64"），
+	// 逻辑类型按底层类型输出，如timestamp-millis为毫秒数
+	AvroAnalyzer struct {
+		registry bool
+		*BaseAnalyzer
+	}
+
+	// avroSchema 解析后的Avro schema，命名类型之间共享指针，因此可以递归引用
+	avroSchema struct {
+		kind     string
+		name     string
+		fields   []avroField
+		symbols  []string
+		items    *avroSchema
+		values   *avroSchema
+		branches []*avroSchema
+		size     int
+	}
+
+	avroField struct {
+		name   string
+		schema *avroSchema
+	}
+
+	avroDecoder struct {
+		data  []byte
+		pos   int
+		items int64 // 已解码的array与map元素总数
+	}
+)
+
+var (
+	// AvroMaxItems 单条消息中array与map的元素总数上限，null等不占字节的元素无法按剩余数据校验块的条数，超过上限时视为schema不匹配
+	AvroMaxItems int64 = 1 << 20
+
+	errAvroShortBuffer  = errors.New("avro: unexpected end of data")
+	errAvroTooManyItems = errors.New("avro: too many array or map items")
+
+	avroPrimitives = map[string]bool{
+		"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true,
+	}
+)
+
+// NewAvroAnalyzer AvroAnalyzer的构造函数，schema为.avsc文件路径
+func NewAvroAnalyzer(schema string, m *FieldMapping) (*AvroAnalyzer, error) {
+	data, err := os.ReadFile(schema)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseAvroSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	fe, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	aa := &AvroAnalyzer{BaseAnalyzer: NewBaseAnalyzer()}
+	aa.Use(func(data []byte) (*LogRecordWrapper, bool) {
+		if aa.registry {
+			// schema registry的消息格式：magic byte 0 + 4字节schema id + Avro二进制
+			if len(data) < 5 || data[0] != 0 {
+				return nil, false
+			}
+			data = data[5:]
+		}
+		js, err := decodeAvro(s, data)
+		if err != nil {
+			return nil, false
+		}
+		return fe.analyze(js)
+	})
+	return aa, nil
+}
+
+// WithSchemaRegistry 消息带有schema registry的5字节前缀，解码前跳过，不校验schema id
+func (aa *AvroAnalyzer) WithSchemaRegistry(enabled bool) *AvroAnalyzer {
+	aa.registry = enabled
+	return aa
+}
+
+// parseAvroSchema 解析Avro schema
+func parseAvroSchema(data []byte) (*avroSchema, error) {
+	return parseAvroType(json.RawMessage(data), "", map[string]*avroSchema{})
+}
+
+func parseAvroType(raw json.RawMessage, namespace string, names map[string]*avroSchema) (*avroSchema, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, errors.New("avro: empty schema")
+	}
+
+	switch raw[0] {
+	case '"':
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return nil, err
+		}
+		if avroPrimitives[name] {
+			return &avroSchema{kind: name}, nil
+		}
+		if s, ok := names[avroFullName(name, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := names[name]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("avro: unknown type %q", name)
+
+	case '[':
+		var branches []json.RawMessage
+		if err := json.Unmarshal(raw, &branches); err != nil {
+			return nil, err
+		}
+		s := &avroSchema{kind: "union"}
+		for _, b := range branches {
+			branch, err := parseAvroType(b, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			s.branches = append(s.branches, branch)
+		}
+		return s, nil
+	}
+
+	var def struct {
+		Type      json.RawMessage `json:"type"`
+		Name      string          `json:"name"`
+		Namespace string          `json:"namespace"`
+		Fields    []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+		Symbols []string        `json:"symbols"`
+		Items   json.RawMessage `json:"items"`
+		Values  json.RawMessage `json:"values"`
+		Size    int             `json:"size"`
+	}
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return nil, err
+	}
+	var kind string
+	if err := json.Unmarshal(def.Type, &kind); err != nil { // 如{"type": {"type": "array", ...}}
+		return parseAvroType(def.Type, namespace, names)
+	}
+
+	s := &avroSchema{kind: kind}
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		if def.Name == "" {
+			return nil, fmt.Errorf("avro: %s without name", kind)
+		}
+		if def.Namespace != "" {
+			namespace = def.Namespace
+		}
+		s.name = avroFullName(def.Name, namespace)
+		if i := strings.LastIndexByte(s.name, '.'); i >= 0 {
+			namespace = s.name[:i]
+		}
+		names[s.name] = s
+	}
+
+	switch kind {
+	case "record", "error":
+		s.kind = "record"
+		for _, f := range def.Fields {
+			fs, err := parseAvroType(f.Type, namespace, names)
+			if err != nil {
+				return nil, fmt.Errorf("avro: field %s.%s: %w", s.name, f.Name, err)
+			}
+			s.fields = append(s.fields, avroField{name: f.Name, schema: fs})
+		}
+	case "enum":
+		s.symbols = def.Symbols
+	case "fixed":
+		if def.Size < 0 {
+			return nil, fmt.Errorf("avro: bad size of fixed %s", s.name)
+		}
+		s.size = def.Size
+	case "array":
+		items, err := parseAvroType(def.Items, namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		s.items = items
+	case "map":
+		values, err := parseAvroType(def.Values, namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		s.values = values
+	default:
+		if !avroPrimitives[kind] { // 带有logicalType等属性的基本类型，或者命名类型的引用
+			return parseAvroType(def.Type, namespace, names)
+		}
+	}
+	return s, nil
+}
+
+func avroFullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// decodeAvro 按schema将Avro二进制解码为JSON，数据有剩余时视为schema不匹配
+func decodeAvro(s *avroSchema, data []byte) ([]byte, error) {
+	d := &avroDecoder{data: data}
+	out, err := d.decode(s, make([]byte, 0, len(data)*2))
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("avro: trailing data")
+	}
+	return out, nil
+}
+
+func (d *avroDecoder) decode(s *avroSchema, out []byte) ([]byte, error) {
+	switch s.kind {
+	case "null":
+		return append(out, "null"...), nil
+	case "boolean":
+		if d.pos >= len(d.data) {
+			return nil, errAvroShortBuffer
+		}
+		d.pos++
+		return strconv.AppendBool(out, d.data[d.pos-1] != 0), nil
+	case "int", "long":
+		n, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(out, n, 10), nil
+	case "float":
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(out, float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 32), nil
+	case "double":
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(out, math.Float64frombits(binary.LittleEndian.Uint64(b)), 64), nil
+	case "string":
+		b, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(out, string(b)), nil
+	case "bytes":
+		b, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(out, base64.StdEncoding.EncodeToString(b)), nil
+	case "fixed":
+		b, err := d.next(s.size)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONString(out, base64.StdEncoding.EncodeToString(b)), nil
+	case "enum":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.symbols)) {
+			return nil, fmt.Errorf("avro: bad enum index %d of %s", i, s.name)
+		}
+		return appendJSONString(out, s.symbols[i]), nil
+	case "union":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.branches)) {
+			return nil, fmt.Errorf("avro: bad union index %d", i)
+		}
+		return d.decode(s.branches[i], out)
+	case "record":
+		var err error
+		out = append(out, '{')
+		for i, f := range s.fields {
+			if i > 0 {
+				out = append(out, ',')
+			}
+			out = appendJSONString(out, f.name)
+			out = append(out, ':')
+			if out, err = d.decode(f.schema, out); err != nil {
+				return nil, err
+			}
+		}
+		return append(out, '}'), nil
+	case "array", "map":
+		return d.decodeBlocks(s, out)
+	}
+	return nil, fmt.Errorf("avro: unknown type %q", s.kind)
+}
+
+// decodeBlocks 解码array与map，二者都由若干个块组成，条数为负数的块带有块的字节数
+func (d *avroDecoder) decodeBlocks(s *avroSchema, out []byte) ([]byte, error) {
+	begin, end := byte('['), byte(']')
+	if s.kind == "map" {
+		begin, end = '{', '}'
+	}
+	out = append(out, begin)
+	first := true
+	for {
+		count, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return append(out, end), nil
+		}
+		if count < 0 {
+			count = -count
+			if _, err = d.long(); err != nil {
+				return nil, err
+			}
+		}
+		if count > int64(len(d.data)-d.pos) && (s.kind == "map" || s.items.kind != "null") { // 除null外每条至少占用一个字节
+			return nil, errAvroShortBuffer
+		}
+		if count > AvroMaxItems-d.items {
+			return nil, errAvroTooManyItems
+		}
+		d.items += count
+		for ; count > 0; count-- {
+			if !first {
+				out = append(out, ',')
+			}
+			first = false
+			if s.kind == "map" {
+				key, err := d.bytes()
+				if err != nil {
+					return nil, err
+				}
+				out = append(appendJSONString(out, string(key)), ':')
+				out, err = d.decode(s.values, out)
+			} else {
+				out, err = d.decode(s.items, out)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// long 读取zigzag编码的变长整数
+func (d *avroDecoder) long() (int64, error) {
+	u, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errAvroShortBuffer
+	}
+	d.pos += n
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (d *avroDecoder) bytes() ([]byte, error) {
+	size, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > int64(len(d.data)-d.pos) {
+		return nil, errAvroShortBuffer
+	}
+	return d.next(int(size))
+}
+
+func (d *avroDecoder) next(size int) ([]byte, error) {
+	if size > len(d.data)-d.pos {
+		return nil, errAvroShortBuffer
+	}
+	d.pos += size
+	return d.data[d.pos-size : d.pos], nil
+}
+
+func appendJSONString(out []byte, s string) []byte {
+	b, _ := json.Marshal(s)
+	return append(out, b...)
+}
+
+// appendJSONFloat NaN与Inf无法用JSON表示，输出为null
+func appendJSONFloat(out []byte, f float64, bitSize int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(out, "null"...)
+	}
+	return strconv.AppendFloat(out, f, 'g', -1, bitSize)
+}
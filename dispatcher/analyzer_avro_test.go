@@ -0,0 +1,124 @@
+package dispatcher
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAvroSchema = `{
+  "type": "record", "name": "Access", "namespace": "com.example",
+  "fields": [
+    {"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "user", "type": ["null", "string"]},
+    {"name": "request", "type": {"type": "record", "name": "Request", "fields": [
+      {"name": "method", "type": {"type": "enum", "name": "Method", "symbols": ["GET", "POST"]}},
+      {"name": "path", "type": "string"},
+      {"name": "headers", "type": {"type": "map", "values": "string"}},
+      {"name": "body", "type": "bytes"}
+    ]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "score", "type": "double"},
+    {"name": "previous", "type": ["null", "Request"]}
+  ]
+}`
+
+// avroTestEncoder 构造测试用的Avro二进制
+type avroTestEncoder []byte
+
+func (e avroTestEncoder) long(n int64) avroTestEncoder {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(e, buf[:binary.PutUvarint(buf, uint64((n<<1)^(n>>63)))]...)
+}
+
+func (e avroTestEncoder) str(s string) avroTestEncoder {
+	return append(e.long(int64(len(s))), s...)
+}
+
+func TestAvroAnalyzer_Analyze(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.avsc")
+	assert.Nil(t, os.WriteFile(path, []byte(testAvroSchema), 0644))
+
+	aa, err := NewAvroAnalyzer(path, &FieldMapping{
+		Path:          "request.path",
+		Method:        "request.method",
+		Headers:       "request.headers",
+		Body:          "request.body",
+		BodyEncoding:  "base64",
+		Timestamp:     "ts",
+		TimestampUnit: "ms",
+		HashField:     "user",
+		BaseURL:       "http://api.example.com",
+	})
+	assert.Nil(t, err)
+
+	var e avroTestEncoder
+	e = e.long(1606118400123).long(1).str("u1")
+	e = e.long(1).str("/orders").long(1).str("X-A").str("1").long(0).str("{}")
+	e = e.long(-2).long(4).str("a").str("b").long(0) // 带有字节数的块
+	score := make([]byte, 8)
+	binary.LittleEndian.PutUint64(score, math.Float64bits(0.5))
+	e = append(e, score...)
+	e = e.long(1).long(0).str("/").long(0).str("")
+
+	js, err := decodeAvro(mustParseAvroSchema(t, testAvroSchema), e)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"ts":1606118400123,"user":"u1","request":{"method":"POST","path":"/orders","headers":{"X-A":"1"},"body":"e30="},
+		"tags":["a","b"],"score":0.5,"previous":{"method":"GET","path":"/","headers":{},"body":""}}`, string(js))
+
+	log := aa.Analyze(e)
+	assert.NotNil(t, log)
+	assert.Equal(t, "http://api.example.com/orders", log.Url)
+	assert.Equal(t, "POST", log.Method)
+	assert.Equal(t, map[string]string{"X-A": "1"}, log.Header)
+	assert.Equal(t, "{}", string(log.Body))
+	assert.Equal(t, "u1", log.HashField)
+	assert.EqualValues(t, 1606118400123, log.OccurAt.UnixNano()/1e6)
+
+	// schema registry前缀
+	assert.Nil(t, aa.Analyze(append([]byte{0, 0, 0, 0, 7}, e...)))
+	aa.WithSchemaRegistry(true)
+	assert.NotNil(t, aa.Analyze(append([]byte{0, 0, 0, 0, 7}, e...)))
+	assert.Nil(t, aa.Analyze(e))
+
+	// 数据被截断或者有剩余时不匹配
+	aa.WithSchemaRegistry(false)
+	assert.Nil(t, aa.Analyze(e[:len(e)-3]))
+	assert.Nil(t, aa.Analyze(append(e, 0)))
+}
+
+func TestDecodeAvro_MaxItems(t *testing.T) {
+	// null不占字节，块的条数受AvroMaxItems限制
+	s := mustParseAvroSchema(t, `{"type":"array","items":"null"}`)
+	js, err := decodeAvro(s, avroTestEncoder{}.long(3).long(0))
+	assert.Nil(t, err)
+	assert.Equal(t, `[null,null,null]`, string(js))
+
+	_, err = decodeAvro(s, avroTestEncoder{}.long(1<<62).long(0))
+	assert.Equal(t, errAvroTooManyItems, err)
+
+	// 多个块的条数累计计算
+	_, err = decodeAvro(s, avroTestEncoder{}.long(AvroMaxItems).long(1).long(0))
+	assert.Equal(t, errAvroTooManyItems, err)
+}
+
+func TestParseAvroSchema(t *testing.T) {
+	// 递归引用
+	s := mustParseAvroSchema(t, `{"type":"record","name":"Node","fields":[{"name":"v","type":"int"},{"name":"next","type":["null","Node"]}]}`)
+	assert.Equal(t, s, s.fields[1].schema.branches[1])
+
+	for _, bad := range []string{`"Unknown"`, `{"type":"record","fields":[]}`, `{"type":"array","items":"Missing"}`, `[`} {
+		_, err := parseAvroSchema([]byte(bad))
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func mustParseAvroSchema(t *testing.T, schema string) *avroSchema {
+	s, err := parseAvroSchema([]byte(schema))
+	assert.Nil(t, err)
+	return s
+}
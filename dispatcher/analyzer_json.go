@@ -0,0 +1,327 @@
+package dispatcher
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	pb "github.com/wosai/havok/pkg/genproto"
+	"github.com/wosai/havok/processor"
+)
+
+type (
+	// FieldMapping JSON日志的字段映射配置，路径语法与processor.JSONProcessor一致，如request.headers、data.list[0].id
+	FieldMapping struct {
+		URL             string `toml:"url"`              // 完整请求地址，与host/path二选一
+		Host            string `toml:"host"`             // 请求host，缺失时使用base_url
+		Path            string `toml:"path"`             // 请求路径
+		Query           string `toml:"query"`            // 查询参数，可以是a=1&b=2形式的字符串或者JSON对象
+		Method          string `toml:"method"`           // 请求方法，缺失时为GET
+		Headers         string `toml:"headers"`          // 请求头，须为JSON对象
+		Body            string `toml:"body"`             // 请求体，字符串原样使用，对象或数组使用原始JSON
+		BodyEncoding    string `toml:"body_encoding"`    // 请求体编码，支持base64
+		Timestamp       string `toml:"timestamp"`        // 日志时间
+		TimestampLayout string `toml:"timestamp_layout"` // 时间格式，如2006-01-02 15:04:05，与timestamp_unit二选一
+		TimestampUnit   string `toml:"timestamp_unit"`   // 数值时间戳的单位：s/ms/us/ns
+		Timezone        string `toml:"timezone"`         // timestamp_layout不带时区时使用，如Asia/Shanghai
+		HashField       string `toml:"hash_field"`       // 作为LogRecordWrapper.HashField的字段
+		BaseURL         string `toml:"base_url"`         // 缺少host时使用的scheme与host，默认为AccessLogBaseURL
+	}
+
+	// JSONAnalyzer 根据FieldMapping解析JSON日志，映射失败时依次尝试通过Use添加的AnalyzeFunc
+	JSONAnalyzer struct {
+		*BaseAnalyzer
+	}
+
+	// fieldExtractor 编译后的FieldMapping
+	fieldExtractor struct {
+		url, host, path, query, method, headers, body, timestamp, hashField []string
+		base64Body                                                          bool
+		layout                                                              string
+		unit                                                                time.Duration
+		location                                                            *time.Location
+		scheme                                                              string
+		baseURL                                                             string
+	}
+)
+
+var timestampUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// NewJSONAnalyzer JSONAnalyzer的构造函数，配置有误时返回error
+func NewJSONAnalyzer(m *FieldMapping) (*JSONAnalyzer, error) {
+	f, err := m.Compile()
+	if err != nil {
+		return nil, err
+	}
+	ja := &JSONAnalyzer{BaseAnalyzer: NewBaseAnalyzer()}
+	ja.Use(f)
+	return ja, nil
+}
+
+// Compile 校验配置并生成AnalyzeFunc
+func (m *FieldMapping) Compile() (AnalyzeFunc, error) {
+	fe, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+	return fe.analyze, nil
+}
+
+func (m *FieldMapping) compile() (*fieldExtractor, error) {
+	if m == nil {
+		return nil, errors.New("empty field mapping")
+	}
+	if m.URL == "" && m.Path == "" {
+		return nil, errors.New("field mapping: either url or path is required")
+	}
+	if m.URL != "" && (m.Host != "" || m.Path != "") {
+		return nil, errors.New("field mapping: url cannot be used together with host or path")
+	}
+	if m.Timestamp == "" {
+		return nil, errors.New("field mapping: timestamp is required")
+	}
+
+	fe := &fieldExtractor{
+		url:       jsonPath(m.URL),
+		host:      jsonPath(m.Host),
+		path:      jsonPath(m.Path),
+		query:     jsonPath(m.Query),
+		method:    jsonPath(m.Method),
+		headers:   jsonPath(m.Headers),
+		body:      jsonPath(m.Body),
+		timestamp: jsonPath(m.Timestamp),
+		hashField: jsonPath(m.HashField),
+		layout:    m.TimestampLayout,
+		location:  time.Local,
+		baseURL:   strings.TrimSuffix(m.BaseURL, "/"),
+	}
+
+	switch {
+	case m.TimestampLayout != "" && m.TimestampUnit != "":
+		return nil, errors.New("field mapping: timestamp_layout and timestamp_unit are mutually exclusive")
+	case m.TimestampLayout != "":
+		if time.Unix(0, 0).UTC().Format(m.TimestampLayout) == m.TimestampLayout {
+			return nil, fmt.Errorf("field mapping: bad timestamp_layout %q", m.TimestampLayout)
+		}
+	case m.TimestampUnit != "":
+		unit, ok := timestampUnits[m.TimestampUnit]
+		if !ok {
+			return nil, fmt.Errorf("field mapping: unknown timestamp_unit %q, expect s/ms/us/ns", m.TimestampUnit)
+		}
+		fe.unit = unit
+	}
+
+	if m.Timezone != "" {
+		loc, err := time.LoadLocation(m.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("field mapping: bad timezone: %w", err)
+		}
+		fe.location = loc
+	}
+
+	switch strings.ToLower(m.BodyEncoding) {
+	case "", "plain":
+	case "base64":
+		fe.base64Body = true
+	default:
+		return nil, fmt.Errorf("field mapping: unknown body_encoding %q", m.BodyEncoding)
+	}
+
+	if fe.baseURL != "" {
+		u, err := url.Parse(fe.baseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("field mapping: bad base_url %q", m.BaseURL)
+		}
+		fe.scheme = u.Scheme
+	}
+	return fe, nil
+}
+
+func jsonPath(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return processor.ParseJSONPath(key)
+}
+
+// analyze 实现AnalyzeFunc，缺少地址或者时间时视为不匹配
+func (fe *fieldExtractor) analyze(data []byte) (*LogRecordWrapper, bool) {
+	at, ok := fe.parseTimestamp(data)
+	if !ok {
+		return nil, false
+	}
+
+	var reqURL string
+	if fe.url != nil {
+		if reqURL = getString(data, fe.url); reqURL == "" {
+			return nil, false
+		}
+	} else {
+		path := getString(data, fe.path)
+		if path == "" {
+			return nil, false
+		}
+		if query := fe.parseQuery(data); query != "" {
+			path += "?" + query
+		}
+		reqURL = fe.buildURL(getString(data, fe.host), path)
+	}
+
+	method := strings.ToUpper(getString(data, fe.method))
+	if method == "" {
+		method = "GET"
+	}
+
+	var body []byte
+	if fe.body != nil {
+		value, dataType, _, err := jsonparser.Get(data, fe.body...)
+		if err == nil && dataType != jsonparser.Null {
+			if dataType == jsonparser.String {
+				s, _ := jsonparser.ParseString(value)
+				body = []byte(s)
+			} else {
+				body = append([]byte(nil), value...)
+			}
+			if fe.base64Body {
+				if body, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+					return nil, false
+				}
+			}
+		}
+	}
+
+	return &LogRecordWrapper{
+		HashField: getString(data, fe.hashField),
+		OccurAt:   at,
+		LogRecord: &pb.LogRecord{
+			Url:    reqURL,
+			Method: method,
+			Header: fe.parseHeaders(data),
+			Body:   body,
+		},
+	}, true
+}
+
+func (fe *fieldExtractor) buildURL(host, path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if host == "" {
+		if fe.baseURL != "" {
+			return fe.baseURL + path
+		}
+		return buildLogURL("", "", path)
+	}
+	return buildLogURL(fe.scheme, host, path)
+}
+
+func (fe *fieldExtractor) parseTimestamp(data []byte) (time.Time, bool) {
+	value, dataType, _, err := jsonparser.Get(data, fe.timestamp...)
+	if err != nil {
+		return time.Time{}, false
+	}
+	s := string(value)
+	if dataType == jsonparser.String {
+		if s, err = jsonparser.ParseString(value); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	switch {
+	case fe.layout != "":
+		t, err := time.ParseInLocation(fe.layout, s, fe.location)
+		return t, err == nil
+	case fe.unit != 0:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(0, n*int64(fe.unit)), true
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(f*float64(fe.unit))), true
+	default:
+		return parseLogTime(s)
+	}
+}
+
+func (fe *fieldExtractor) parseQuery(data []byte) string {
+	if fe.query == nil {
+		return ""
+	}
+	value, dataType, _, err := jsonparser.Get(data, fe.query...)
+	if err != nil {
+		return ""
+	}
+	switch dataType {
+	case jsonparser.String:
+		s, _ := jsonparser.ParseString(value)
+		return strings.TrimPrefix(s, "?")
+	case jsonparser.Object:
+		values := url.Values{}
+		for k, v := range objectFields(value) {
+			values.Set(k, v)
+		}
+		return values.Encode()
+	}
+	return ""
+}
+
+func (fe *fieldExtractor) parseHeaders(data []byte) map[string]string {
+	if fe.headers == nil {
+		return nil
+	}
+	value, dataType, _, err := jsonparser.Get(data, fe.headers...)
+	if err != nil || dataType != jsonparser.Object {
+		return nil
+	}
+	return objectFields(value)
+}
+
+// getString 读取字段内容，非字符串的值返回原始内容，字段不存在时返回空字符串
+func getString(data []byte, path []string) string {
+	if path == nil {
+		return ""
+	}
+	value, dataType, _, err := jsonparser.Get(data, path...)
+	if err != nil || dataType == jsonparser.Null {
+		return ""
+	}
+	if dataType == jsonparser.String {
+		s, err := jsonparser.ParseString(value)
+		if err != nil {
+			return ""
+		}
+		return s
+	}
+	return string(value)
+}
+
+// objectFields 将JSON对象转换为map，非字符串的值保留原始内容
+func objectFields(data []byte) map[string]string {
+	m := map[string]string{}
+	jsonparser.ObjectEach(data, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		if dataType == jsonparser.String {
+			if s, err := jsonparser.ParseString(value); err == nil {
+				m[string(key)] = s
+			}
+		} else if dataType != jsonparser.Null {
+			m[string(key)] = string(value)
+		}
+		return nil
+	})
+	return m
+}
@@ -0,0 +1,83 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONAnalyzer_Analyze(t *testing.T) {
+	ja, err := NewJSONAnalyzer(&FieldMapping{
+		Host:          "req.host",
+		Path:          "req.path",
+		Query:         "req.args",
+		Method:        "req.method",
+		Headers:       "req.headers",
+		Body:          "req.body",
+		BodyEncoding:  "base64",
+		Timestamp:     "ts",
+		TimestampUnit: "ms",
+		HashField:     "user.id",
+		BaseURL:       "https://staging.example.com",
+	})
+	assert.Nil(t, err)
+
+	log := ja.Analyze([]byte(`{"ts":1532058494123,"user":{"id":42},"req":{"host":"api.example.com","path":"/v2/orders","args":{"page":"2"},"method":"post","headers":{"Content-Type":"application/json"},"body":"eyJhIjoxfQ=="}}`))
+	assert.NotNil(t, log)
+	assert.Equal(t, "https://api.example.com/v2/orders?page=2", log.Url)
+	assert.Equal(t, "POST", log.Method)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, log.Header)
+	assert.Equal(t, `{"a":1}`, string(log.Body))
+	assert.Equal(t, "42", log.HashField)
+	assert.Equal(t, int64(1532058494123), log.OccurAt.UnixNano()/1e6)
+
+	// 缺少host时使用base_url，缺少method时为GET
+	log = ja.Analyze([]byte(`{"ts":"1532058494000","req":{"path":"status","args":"a=1"}}`))
+	assert.NotNil(t, log)
+	assert.Equal(t, "https://staging.example.com/status?a=1", log.Url)
+	assert.Equal(t, "GET", log.Method)
+
+	// 缺少时间或路径时不匹配
+	assert.Nil(t, ja.Analyze([]byte(`{"req":{"path":"/a"}}`)))
+	assert.Nil(t, ja.Analyze([]byte(`{"ts":1532058494000}`)))
+}
+
+func TestJSONAnalyzer_Layout(t *testing.T) {
+	ja, err := NewJSONAnalyzer(&FieldMapping{
+		URL:             "data[0].url",
+		Body:            "data[0].payload",
+		Timestamp:       "data[0].time",
+		TimestampLayout: "2006-01-02 15:04:05.000",
+		Timezone:        "Asia/Shanghai",
+	})
+	assert.Nil(t, err)
+
+	log := ja.Analyze([]byte(`{"data":[{"url":"http://a.com/x","time":"2018-07-20 11:48:14.123","payload":{"k":[1,2]}}]}`))
+	assert.NotNil(t, log)
+	assert.Equal(t, "http://a.com/x", log.Url)
+	assert.Equal(t, `{"k":[1,2]}`, string(log.Body))
+	assert.Equal(t, time.Date(2018, 7, 20, 3, 48, 14, 123e6, time.UTC), log.OccurAt.UTC())
+}
+
+func TestFieldMapping_Compile(t *testing.T) {
+	bad := []*FieldMapping{
+		nil,
+		{Timestamp: "ts"},
+		{URL: "url"},
+		{URL: "url", Path: "path", Timestamp: "ts"},
+		{URL: "url", Timestamp: "ts", TimestampUnit: "minute"},
+		{URL: "url", Timestamp: "ts", TimestampUnit: "ms", TimestampLayout: "2006"},
+		{URL: "url", Timestamp: "ts", TimestampLayout: "yyyy-MM-dd"},
+		{URL: "url", Timestamp: "ts", BodyEncoding: "gzip"},
+		{URL: "url", Timestamp: "ts", Timezone: "Mars/Olympus"},
+		{Path: "path", Timestamp: "ts", BaseURL: "example.com"},
+	}
+	for _, m := range bad {
+		_, err := m.Compile()
+		assert.NotNil(t, err, "%+v", m)
+	}
+
+	_, err := (&FieldMapping{URL: "url", Timestamp: "ts"}).Compile()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,78 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type (
+	// ProtobufAnalyzer 根据descriptor set动态解码protobuf消息，转换为JSON后按FieldMapping映射，映射失败时依次尝试通过Use添加的AnalyzeFunc
+	//
+	// 转换使用proto文件中的字段名（如occur_at），int64等64位整数为字符串，bytes为base64编码（body_encoding = "base64"），
+	// google.protobuf.Timestamp为RFC 3339格式的字符串
+	ProtobufAnalyzer struct {
+		*BaseAnalyzer
+	}
+)
+
+var protoJSONOptions = protojson.MarshalOptions{UseProtoNames: true}
+
+// NewProtobufAnalyzer ProtobufAnalyzer的构造函数，descriptorSet为protoc --include_imports --descriptor_set_out生成的文件，
+// message为消息的完整名称，如wosai.havok.LogRecord
+func NewProtobufAnalyzer(descriptorSet, message string, m *FieldMapping) (*ProtobufAnalyzer, error) {
+	md, err := loadMessageDescriptor(descriptorSet, message)
+	if err != nil {
+		return nil, err
+	}
+	fe, err := m.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	pa := &ProtobufAnalyzer{BaseAnalyzer: NewBaseAnalyzer()}
+	pa.Use(func(data []byte) (*LogRecordWrapper, bool) {
+		msg := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return nil, false
+		}
+		js, err := protoJSONOptions.Marshal(msg)
+		if err != nil {
+			return nil, false
+		}
+		return fe.analyze(js)
+	})
+	return pa, nil
+}
+
+// loadMessageDescriptor 从descriptor set文件中查找消息定义
+func loadMessageDescriptor(path, message string) (protoreflect.MessageDescriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("bad descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("bad descriptor set: %w", err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %q not found in descriptor set: %w", message, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, errors.New(message + " is not a message")
+	}
+	return md, nil
+}
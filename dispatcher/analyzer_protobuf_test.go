@@ -0,0 +1,56 @@
+package dispatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestProtobufAnalyzer_Analyze(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(pb.File_havok_proto)}}
+	data, err := proto.Marshal(set)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "havok.desc")
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+
+	mapping := &FieldMapping{
+		URL:           "log.url",
+		Method:        "log.method",
+		Headers:       "log.header",
+		Body:          "log.body",
+		BodyEncoding:  "base64",
+		Timestamp:     "occur_at",
+		TimestampUnit: "ns",
+		HashField:     "hash_field",
+	}
+	_, err = NewProtobufAnalyzer(path, "wosai.havok.Unknown", mapping)
+	assert.NotNil(t, err)
+	pa, err := NewProtobufAnalyzer(path, "wosai.havok.CapturedRecord", mapping)
+	assert.Nil(t, err)
+
+	msg, err := proto.Marshal(&pb.CapturedRecord{
+		Log:       &pb.LogRecord{Url: "http://api.example.com/orders", Method: "POST", Header: map[string]string{"X-A": "1"}, Body: []byte{0, 1, 2}},
+		OccurAt:   1606118400123456789,
+		HashField: "u1",
+	})
+	assert.Nil(t, err)
+	log := pa.Analyze(msg)
+	assert.NotNil(t, log)
+	assert.Equal(t, "http://api.example.com/orders", log.Url)
+	assert.Equal(t, "POST", log.Method)
+	assert.Equal(t, map[string]string{"X-A": "1"}, log.Header)
+	assert.Equal(t, []byte{0, 1, 2}, log.Body)
+	assert.Equal(t, "u1", log.HashField)
+	assert.EqualValues(t, 1606118400123456789, log.OccurAt.UnixNano())
+
+	// 无法解码或者缺少字段时不匹配
+	assert.Nil(t, pa.Analyze([]byte{0xff, 0xff}))
+	msg, _ = proto.Marshal(&pb.CapturedRecord{OccurAt: 1})
+	assert.Nil(t, pa.Analyze(msg))
+}
@@ -0,0 +1,224 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// Checkpoint 任务断点，记录最后分发的日志时间、数据源的读取位置以及当前的回放配置
+	Checkpoint struct {
+		Configuration *pb.JobConfiguration `json:"configuration"`
+		Feature       *Feature             `json:"feature"`
+		OccurAt       int64                `json:"occur_at"`          // 最后分发的日志时间，毫秒
+		Cursors       map[string]int64     `json:"cursors,omitempty"` // 最后分发的日志在各数据源中的读取位置
+		Dispatched    int64                `json:"dispatched"`        // 本次运行分发的日志条数
+		Finished      bool                 `json:"finished"`          // 任务已完成，无需恢复
+		SavedAt       int64                `json:"saved_at"`          // 毫秒
+	}
+
+	// Checkpointer 可以从断点记录的读取位置继续读取的Fetcher
+	//
+	// Fetcher需要在输出的日志中记录读取位置（LogRecordWrapper.cursor），TimeWheel分发日志时更新断点
+	Checkpointer interface {
+		// Resume 在Start之前调用，cursors为断点中记录的读取位置，不存在的数据源按任务开始时间定位
+		Resume(cursors map[string]int64) error
+	}
+
+	// sourceCursor 日志在数据源中的读取位置，offset为继续读取时的起点，如文件中下一行的偏移量、kafka中下一条消息的offset
+	sourceCursor struct {
+		source string
+		offset int64
+		start  int64 // 日志本身的起始位置，由ReorderStage记录为同一数据源上一条日志的offset，-1表示未知
+	}
+
+	// checkpointer 记录TimeWheel最后分发的日志，按间隔写入断点文件
+	checkpointer struct {
+		path       string
+		interval   time.Duration
+		mu         sync.Mutex
+		occurAt    time.Time
+		cursors    map[string]int64
+		dispatched int64
+	}
+)
+
+var (
+	// DefaultCheckpointInterval 默认的断点保存间隔
+	DefaultCheckpointInterval = 10 * time.Second
+
+	// ErrCheckpointFinished 断点对应的任务已经完成
+	ErrCheckpointFinished = errors.New("job in checkpoint has finished")
+)
+
+func newCheckpointer(path string, interval time.Duration) *checkpointer {
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	return &checkpointer{path: path, interval: interval, cursors: make(map[string]int64)}
+}
+
+// LoadCheckpoint 读取断点文件
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if cp.Configuration == nil {
+		return nil, errors.New("checkpoint without job configuration")
+	}
+	return cp, nil
+}
+
+// record 由TimeWheel在分发日志之前调用
+func (c *checkpointer) record(log *LogRecordWrapper) {
+	c.mu.Lock()
+	c.occurAt = log.OccurAt
+	if log.cursor != nil {
+		c.cursors[log.cursor.source] = log.cursor.offset
+	}
+	c.dispatched++
+	c.mu.Unlock()
+}
+
+// reset 任务重新定位后清空记录，之后的断点以新位置分发的日志为准
+func (c *checkpointer) reset() {
+	c.mu.Lock()
+	c.occurAt, c.cursors = time.Time{}, make(map[string]int64)
+	c.mu.Unlock()
+}
+
+// snapshot 生成断点，尚未分发过日志时返回nil
+func (c *checkpointer) snapshot(conf *pb.JobConfiguration, feature *Feature, finished bool) *Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.occurAt.IsZero() {
+		return nil
+	}
+	cp := &Checkpoint{
+		Configuration: conf,
+		Feature:       feature,
+		OccurAt:       c.occurAt.UnixNano() / 1e6,
+		Cursors:       make(map[string]int64, len(c.cursors)),
+		Dispatched:    c.dispatched,
+		Finished:      finished,
+		SavedAt:       time.Now().UnixNano() / 1e6,
+	}
+	for source, offset := range c.cursors {
+		cp.Cursors[source] = offset
+	}
+	return cp
+}
+
+// save 先写临时文件再重命名，避免进程退出时留下不完整的断点文件
+func (c *checkpointer) save(cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// WithCheckpoint 按interval将断点写入path，任务停止或者完成时再写入一次
+func (job *Job) WithCheckpoint(path string, interval time.Duration) *Job {
+	job.checkpoint = newCheckpointer(path, interval)
+	return job
+}
+
+// Resume 从断点继续任务，须在Start之前调用，之后通过/api/job/start启动时忽略请求中的开始时间
+//
+// 任务从最后分发的日志时间开始，恢复断点中的速率、倍速、按API的回放增益与特性配置；Fetcher实现了Checkpointer时从记录的读取位置继续读取，
+// 否则按时间重新定位，可能重复分发最后一毫秒内的日志
+func (job *Job) Resume(cp *Checkpoint) error {
+	if cp.Finished {
+		return ErrCheckpointFinished
+	}
+	if job.Status() != StatusReady {
+		return errors.New("bad job status")
+	}
+
+	c := &pb.JobConfiguration{Begin: cp.OccurAt, End: cp.Configuration.End, Rate: cp.Configuration.Rate,
+		Speed: cp.Configuration.Speed, Stuck: cp.Configuration.Stuck, ApiRates: cp.Configuration.ApiRates}
+	if err := checkConfiguration(c); err != nil {
+		return err
+	}
+	job.lock.Lock()
+	job.resumed = true
+	job.Configuration.Begin, job.Configuration.End = c.Begin, c.End
+	job.Configuration.Rate, job.Configuration.Speed, job.Configuration.Stuck = c.Rate, c.Speed, c.Stuck
+	if c.ApiRates != nil {
+		job.Configuration.ApiRates = copyAPIRates(c.ApiRates)
+	}
+	job.lock.Unlock()
+	if cp.Feature != nil {
+		job.mergeJobConfiguration(cp.Feature)
+	}
+	if job.timeWheel != nil {
+		job.timeWheel.refreshConfig(job.Configuration)
+	}
+
+	if ck, ok := job.fetcher.(Checkpointer); ok && len(cp.Cursors) > 0 {
+		if err := ck.Resume(cp.Cursors); err != nil {
+			return err
+		}
+	}
+	Logger.Info("resume job from checkpoint", zap.Time("occurAt", ParseMSec(cp.OccurAt)), zap.Any("cursors", cp.Cursors))
+	return nil
+}
+
+// saveCheckpoint 写入当前断点
+func (job *Job) saveCheckpoint(finished bool) {
+	job.lock.Lock()
+	conf := &pb.JobConfiguration{Begin: job.Configuration.Begin, End: job.Configuration.End, Rate: job.Configuration.Rate,
+		Speed: job.Configuration.Speed, Stuck: job.Configuration.Stuck, ApiRates: copyAPIRates(job.Configuration.ApiRates)}
+	feature := &Feature{Shake: &config{}, Strike: &config{}}
+	*feature.Shake, *feature.Strike = *job.feature.Shake, *job.feature.Strike
+	job.lock.Unlock()
+
+	cp := job.checkpoint.snapshot(conf, feature, finished)
+	if cp == nil {
+		return
+	}
+	if err := job.checkpoint.save(cp); err != nil {
+		Logger.Warn("failed to save checkpoint", zap.String("path", job.checkpoint.path), zap.Error(err))
+	}
+}
+
+// checkpointing 定时保存断点，任务停止或者完成时由Stop、Finish保存最终状态
+func (job *Job) checkpointing() {
+	ticker := time.NewTicker(job.checkpoint.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if job.Status() != StatusRunning {
+			return
+		}
+		job.saveCheckpoint(false)
+	}
+}
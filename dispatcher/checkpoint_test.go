@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestJob_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestLog(t, dir, "access.log", "1000 /a1", "2000 /a2", "3000 /a3", "3000 /a3b", "4000 /a4", "5000 /a5")
+	state := filepath.Join(dir, "havok.checkpoint")
+
+	job, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 2, Speed: 4, ApiRates: map[string]float32{"/a4": 5}})
+	assert.Nil(t, err)
+	job.WithFetcher(NewFileFetcher(path).withTestAnalyzer()).WithCheckpoint(state, 0)
+	job.feature.Shake.Peak = 1.5
+
+	logs := fetchAll(t, job.fetcher, ParseMSec(1000), ParseMSec(10000))
+	assert.Len(t, logs, 6)
+	job.saveCheckpoint(false) // 尚未分发日志时不保存
+	_, err = LoadCheckpoint(state)
+	assert.NotNil(t, err)
+
+	for _, log := range logs[:3] {
+		job.checkpoint.record(log)
+	}
+	job.saveCheckpoint(false)
+	cp, err := LoadCheckpoint(state)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3000, cp.OccurAt)
+	assert.EqualValues(t, 3, cp.Dispatched)
+	assert.EqualValues(t, len("1000 /a1\n2000 /a2\n3000 /a3\n"), cp.Cursors[path])
+
+	// 从断点继续，不重复最后分发的日志，同一毫秒内之后的日志不会丢失
+	resumed, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1})
+	assert.Nil(t, err)
+	resumed.WithFetcher(NewFileFetcher(path).withTestAnalyzer())
+	assert.Nil(t, resumed.Resume(cp))
+	assert.EqualValues(t, 3000, resumed.Configuration.Begin)
+	assert.EqualValues(t, 2, resumed.Configuration.Rate)
+	assert.EqualValues(t, 4, resumed.Configuration.Speed)
+	assert.Equal(t, map[string]float32{"/a4": 5}, resumed.Configuration.ApiRates)
+	assert.EqualValues(t, 1.5, resumed.feature.Shake.Peak)
+
+	logs = fetchAll(t, resumed.fetcher, ParseMSec(resumed.Configuration.Begin), ParseMSec(10000))
+	var urls []string
+	for _, log := range logs {
+		urls = append(urls, log.Url)
+	}
+	assert.Equal(t, []string{"/a3b", "/a4", "/a5"}, urls)
+
+	// 已完成的任务不再恢复
+	cp.Finished = true
+	assert.Equal(t, ErrCheckpointFinished, resumed.Resume(cp))
+}
@@ -0,0 +1,108 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// playbackClock 回放时钟，将现实时间按倍速映射为日志时间，暂停期间日志时间停止推进
+	//
+	// 时钟只记录一个锚点（现实时间与对应的日志时间），暂停时把锚点移动到当前日志时间，恢复时从该日志时间重新计时，
+	// 因此暂停期间积压的日志不会在恢复后集中发出
+	playbackClock struct {
+		mu      sync.Mutex
+		anchor  time.Time // 锚点的现实时间
+		at      time.Time // 锚点对应的日志时间
+		speed   float64
+		started bool
+		paused  bool
+	}
+)
+
+func newPlaybackClock(speed float32) *playbackClock {
+	return &playbackClock{speed: float64(speed)}
+}
+
+// start 以日志时间at作为当前时刻开始计时，已经开始时忽略
+func (c *playbackClock) start(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.anchor, c.at, c.started = time.Now(), at, true
+}
+
+// reset 重新定位后使用，下一次start时以新的日志时间开始计时，暂停状态保持不变
+func (c *playbackClock) reset() {
+	c.mu.Lock()
+	c.started = false
+	c.mu.Unlock()
+}
+
+// isStarted 时钟是否已经开始计时
+func (c *playbackClock) isStarted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.started
+}
+
+// now 当前的日志时间，未开始计时时返回零值
+func (c *playbackClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current(time.Now())
+}
+
+func (c *playbackClock) current(real time.Time) time.Time {
+	if !c.started || c.paused {
+		return c.at
+	}
+	return c.at.Add(time.Duration(float64(real.Sub(c.anchor)) * c.speed))
+}
+
+// until 返回距离日志时间at还需等待的现实时间，时钟暂停或者未开始时running为false
+func (c *playbackClock) until(at time.Time) (d time.Duration, running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started || c.paused {
+		return 0, false
+	}
+	return time.Duration(float64(at.Sub(c.current(time.Now()))) / c.speed), true
+}
+
+// pause 冻结日志时间
+func (c *playbackClock) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return
+	}
+	c.at, c.paused = c.current(time.Now()), true
+}
+
+// resume 从暂停时的日志时间继续计时
+func (c *playbackClock) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.anchor, c.paused = time.Now(), false
+}
+
+// setSpeed 修改倍速，此前经过的日志时间不受影响
+func (c *playbackClock) setSpeed(speed float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.at, c.anchor, c.speed = c.current(now), now, float64(speed)
+}
+
+// skip 日志时间直接向前推进d，用于压缩日志之间过长的空闲间隔，暂停中同样生效
+func (c *playbackClock) skip(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.at = c.at.Add(d)
+}
@@ -0,0 +1,48 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaybackClock(t *testing.T) {
+	c := newPlaybackClock(2)
+	_, running := c.until(time.Now())
+	assert.False(t, running)
+
+	at := time.Unix(1606118400, 0)
+	c.start(at)
+	d, running := c.until(at.Add(time.Second))
+	assert.True(t, running)
+	assert.True(t, d > 400*time.Millisecond && d <= 500*time.Millisecond, d)
+
+	c.pause()
+	frozen := c.now()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, frozen, c.now())
+	_, running = c.until(at.Add(time.Second))
+	assert.False(t, running)
+
+	c.resume()
+	d, _ = c.until(frozen.Add(time.Second))
+	assert.True(t, d > 400*time.Millisecond && d <= 500*time.Millisecond, d)
+
+	c.setSpeed(1)
+	d, _ = c.until(c.now().Add(time.Second))
+	assert.True(t, d > 900*time.Millisecond && d <= time.Second, d)
+}
+
+func TestPlaybackClock_Skip(t *testing.T) {
+	c := newPlaybackClock(1)
+	at := time.Unix(1606118400, 0)
+	c.start(at)
+	c.skip(time.Minute)
+	d, _ := c.until(at.Add(time.Minute + time.Second))
+	assert.True(t, d > 900*time.Millisecond && d <= time.Second, d)
+
+	c.pause()
+	c.skip(time.Minute)
+	assert.True(t, c.now().Sub(at) >= 2*time.Minute)
+}
@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// CaptureExporter 将经过的日志连同OccurAt、HashField写入抓取文件，日志原样传递给下游
+	//
+	// 抓取文件为gzip压缩的varint长度前缀加pb.CapturedRecord序列，可以由CaptureFetcher原样重放，
+	// 用于固定SLS、Kafka等会过期或者变化的数据源。写文件失败只记录错误日志，不影响回放
+	CaptureExporter struct {
+		path    string
+		file    *os.File
+		gz      *gzip.Writer
+		writer  *bufio.Writer
+		counter int64
+		*baseStage
+	}
+)
+
+// NewCaptureExporter CaptureExporter的构造函数，文件已存在时会被覆盖
+func NewCaptureExporter(path string) (*CaptureExporter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &CaptureExporter{path: path, file: file, gz: gz, writer: bufio.NewWriter(gz), baseStage: newBaseStage()}, nil
+}
+
+// Start 写入日志直到输入管道关闭
+func (ce *CaptureExporter) Start() error {
+	var err error
+	for log := range ce.input {
+		if err == nil {
+			if err = encodeCapturedRecord(ce.writer, log); err != nil {
+				Logger.Error("failed to write capture file, stop capturing", zap.String("path", ce.path), zap.Error(err))
+			} else {
+				ce.counter++
+			}
+		}
+		ce.output <- log
+	}
+	close(ce.output)
+
+	if cerr := ce.close(); cerr != nil {
+		Logger.Error("failed to close capture file", zap.String("path", ce.path), zap.Error(cerr))
+		if err == nil {
+			err = cerr
+		}
+	}
+	Logger.Info("finished to capture logs", zap.String("path", ce.path), zap.Int64("records", ce.counter))
+	return err
+}
+
+func (ce *CaptureExporter) close() error {
+	err := ce.writer.Flush()
+	if e := ce.gz.Close(); err == nil {
+		err = e
+	}
+	if e := ce.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// encodeCapturedRecord 写入一条varint长度前缀的CapturedRecord
+func encodeCapturedRecord(w io.Writer, log *LogRecordWrapper) error {
+	data, err := proto.Marshal(&pb.CapturedRecord{Log: log.LogRecord, OccurAt: log.OccurAt.UnixNano(), HashField: log.HashField})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(protowire.AppendVarint(nil, uint64(len(data))), data...))
+	return err
+}
@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// GoReplayExporter 将经过的日志以GoReplay录制文件格式写入文件，日志原样传递给下游，文件名以.gz结尾时使用gzip压缩
+	//
+	// 写文件失败只记录错误日志，不影响回放
+	GoReplayExporter struct {
+		path    string
+		file    *os.File
+		gz      *gzip.Writer
+		writer  *bufio.Writer
+		prefix  string
+		counter int64
+		*baseStage
+	}
+)
+
+// NewGoReplayExporter GoReplayExporter的构造函数，文件已存在时会被覆盖
+func NewGoReplayExporter(path string) (*GoReplayExporter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 8)
+	rand.Read(random)
+	ge := &GoReplayExporter{path: path, file: file, prefix: hex.EncodeToString(random), baseStage: newBaseStage()}
+	if strings.HasSuffix(path, ".gz") {
+		ge.gz = gzip.NewWriter(file)
+		ge.writer = bufio.NewWriter(ge.gz)
+	} else {
+		ge.writer = bufio.NewWriter(file)
+	}
+	return ge, nil
+}
+
+// Start 写入日志直到输入管道关闭
+func (ge *GoReplayExporter) Start() error {
+	var err error
+	for log := range ge.input {
+		if err == nil {
+			if err = ge.write(log); err != nil {
+				Logger.Error("failed to write gor file, stop exporting", zap.String("path", ge.path), zap.Error(err))
+			}
+		}
+		ge.output <- log
+	}
+	close(ge.output)
+
+	if cerr := ge.close(); cerr != nil {
+		Logger.Error("failed to close gor file", zap.String("path", ge.path), zap.Error(cerr))
+		if err == nil {
+			err = cerr
+		}
+	}
+	Logger.Info("finished to export gor file", zap.String("path", ge.path), zap.Int64("requests", ge.counter))
+	return err
+}
+
+func (ge *GoReplayExporter) write(log *LogRecordWrapper) error {
+	ge.counter++
+	return encodeGoReplayPayload(ge.writer, ge.prefix+fmt.Sprintf("%08x", ge.counter), log)
+}
+
+func (ge *GoReplayExporter) close() error {
+	err := ge.writer.Flush()
+	if ge.gz != nil {
+		if e := ge.gz.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := ge.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// encodeGoReplayPayload 按GoReplay格式写入一条请求记录
+func encodeGoReplayPayload(w io.Writer, id string, log *LogRecordWrapper) error {
+	u, err := url.Parse(log.Url)
+	if err != nil {
+		return err
+	}
+	method := log.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %d -1\n", goreplayRequestType, id, log.OccurAt.UnixNano())
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\nHost: %s\r\n", method, u.RequestURI(), u.Host)
+
+	keys := make([]string, 0, len(log.Header))
+	for k := range log.Header {
+		switch strings.ToLower(k) {
+		case "host", "content-length", "transfer-encoding":
+		default:
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k + ": " + log.Header[k] + "\r\n")
+	}
+	if len(log.Body) > 0 {
+		b.WriteString("Content-Length: " + strconv.Itoa(len(log.Body)) + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.Write(log.Body)
+	b.WriteString(goreplayPayloadSeparator)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -2,14 +2,17 @@ package dispatcher
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
 	"os"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,7 +20,6 @@ import (
 	"github.com/segmentio/kafka-go"
 	pb "github.com/wosai/havok/pkg/genproto"
 	"go.uber.org/zap"
-	"gopkg.in/olivere/elastic.v5"
 )
 
 type (
@@ -29,34 +31,48 @@ type (
 		SubTask
 	}
 
-	// ElasticFetcher ElasticSearch的日志收集对象
-	ElasticFetcher struct {
-		client *elastic.Client
-	}
-
-	// FileFetcher 本地日志文件收集者
+	// FileFetcher 本地日志文件收集者，按magic bytes识别gzip、zstd、bzip2压缩的文件并透明解压
+	//
+	// 超过最大长度的行以及Analyzer无法解析的行会被跳过并计数，不会中止任务。日志需按时间有序，
+	// 未压缩的文件按字节偏移量二分查找开始时间，压缩文件可以开启旁路时间索引
 	FileFetcher struct {
-		path   string
-		status TaskStatus
+		path    string
+		follow  bool
+		delay   time.Duration
+		maxLine int
+		index   bool
+		stats   LineStats
+		cursors map[string]int64
 		*baseFetcher
 	}
 
-	// MultipleFilesFetcher 多文件日志收集对象
-	MultipleFilesFetcher struct {
-	}
-
+	// KafkaSinglePartitionFetcher 读取topic下单个partition的kafka日志收集者，也可以作为消费组成员持续镜像线上流量
 	KafkaSinglePartitionFetcher struct {
 		*baseFetcher
-		reader  *kafka.Reader
-		counter int64
-		qps     int64
+		brokers   []string
+		topic     string
+		partition int
+		offset    int64
+		byTime    bool
+		groupID   string
+		cursors   map[string]int64
+		reader    *kafka.Reader
+		cancel    context.CancelFunc
+		counter   int64
+		qps       int64
+		kafkaMessageOptions
 	}
 
 	// LogRecordWrapper LogRecord的扩展，增加日志时间、哈希字段两个字段
 	LogRecordWrapper struct {
 		HashField string
 		OccurAt   time.Time
+		Response  *RecordedResponse // 可选，日志源中记录的原始响应，不会下发给replayer
 		*pb.LogRecord
+		cursor *sourceCursor // 可选，日志在数据源中的读取位置，用于断点续传
+		epoch  int64         // 读取该日志时Fetcher的定位编号，见Seeker
+
+		watermark bool // 仅用于多个来源的归并，表示该来源之后的日志不早于OccurAt，不会交给下游
 	}
 
 	baseFetcher struct {
@@ -66,6 +82,17 @@ type (
 		output   chan<- *LogRecordWrapper
 		parent   ParentTask
 		status   TaskStatus
+
+		done      chan struct{} // Stop时关闭，通知读取循环放弃发送并退出
+		closeOnce sync.Once
+
+		// 重新定位请求，见Seeker
+		seekMu    sync.Mutex
+		seekTo    time.Time
+		seekEpoch int64
+		seeking   bool
+		sealed    bool
+		epoch     int64
 	}
 
 	AliyunSLSConcurrencyFetcher struct {
@@ -82,6 +109,8 @@ type (
 		concurrency  int
 		preDownload  int
 		antsNest     chan *AliyunSLSAnt
+		keepTime     bool // 保留超出时间块的原始日志时间，须配合ReorderStage使用
+		cursors      map[string]int64
 		count        int64
 		qps          int64
 		*baseFetcher
@@ -96,8 +125,13 @@ type (
 	}
 )
 
+var (
+	// FileFollowInterval follow模式下检查文件新内容、轮转与截断的间隔
+	FileFollowInterval = 500 * time.Millisecond
+)
+
 func newBaseFetcher() *baseFetcher {
-	return &baseFetcher{}
+	return &baseFetcher{done: make(chan struct{})}
 }
 
 // TimeRange 设定读去日志的时间范围
@@ -125,21 +159,39 @@ func (bf *baseFetcher) start() {
 	atomic.StoreInt32(&bf.status, StatusRunning)
 }
 
+// Stop 只修改状态并通知读取循环退出，输出管道由读取循环关闭，避免与正在进行的发送冲突
 func (bf *baseFetcher) Stop() {
-	atomic.CompareAndSwapInt32(&bf.status, StatusRunning, StatusStopped)
-	if bf.output != nil {
-		close(bf.output)
+	if atomic.CompareAndSwapInt32(&bf.status, StatusRunning, StatusStopped) {
+		close(bf.done)
 	}
 }
 
+// Finish 由读取循环在读取完毕时调用
 func (bf *baseFetcher) Finish() {
 	Logger.Info("file fetcher finished")
 	atomic.CompareAndSwapInt32(&bf.status, StatusRunning, StatusFinished)
-	if bf.output != nil {
-		close(bf.output) // 关闭通道
+	bf.closeOutput()
+}
+
+// send 向输出管道发送日志，Fetcher被停止时放弃发送并返回false
+func (bf *baseFetcher) send(log *LogRecordWrapper) bool {
+	select {
+	case bf.output <- log:
+		return true
+	case <-bf.done:
+		return false
 	}
 }
 
+// closeOutput 关闭输出管道，只能由发送日志的读取循环调用，Start退出时通过defer保证关闭
+func (bf *baseFetcher) closeOutput() {
+	bf.closeOnce.Do(func() {
+		if bf.output != nil {
+			close(bf.output)
+		}
+	})
+}
+
 func (bf *baseFetcher) Status() TaskStatus {
 	return atomic.LoadInt32(&bf.status)
 }
@@ -149,51 +201,286 @@ func NewFileFetcher(path string) *FileFetcher {
 	return &FileFetcher{path: path, baseFetcher: newBaseFetcher()}
 }
 
+// WithFollow 开启follow模式，读到文件末尾后继续等待新写入的日志（类似tail -F），并处理文件轮转与截断
+//
+// 日志在OccurAt之后delay才交给TimeWheel，用于等待各节点日志落盘；任务End<=0时将持续回放，直到通过/api/job/stop停止
+func (ff *FileFetcher) WithFollow(delay time.Duration) *FileFetcher {
+	ff.follow = true
+	ff.delay = delay
+	return ff
+}
+
+// WithMaxLineSize 设置最大行长度，超过的行被跳过，默认为FileMaxLineSize
+func (ff *FileFetcher) WithMaxLineSize(size int) *FileFetcher {
+	ff.maxLine = size
+	return ff
+}
+
+// WithIndex 为压缩文件维护旁路时间索引（与日志文件同目录，后缀为FileIndexSuffix），再次读取时跳过开始时间之前的内容
+func (ff *FileFetcher) WithIndex(enabled bool) *FileFetcher {
+	ff.index = enabled
+	return ff
+}
+
+// Resume 从断点记录的偏移量继续读取，实现Checkpointer
+func (ff *FileFetcher) Resume(cursors map[string]int64) error {
+	ff.cursors = cursors
+	return nil
+}
+
+// Stats 返回读取统计
+func (ff *FileFetcher) Stats() LineStats {
+	return ff.stats.load()
+}
+
 // Start 读取日志的文件的每一行，解析出LogRecordWrapper对象，交由TimeWheel按时间顺序分发
 func (ff *FileFetcher) Start() error {
 	ff.baseFetcher.start()
+	defer ff.closeOutput()
 	if ff.parent != nil {
 		ff.parent.Notify(ff, StatusRunning)
 	}
-	file, err := os.Open(ff.path)
-	if err != nil {
-		Logger.Error("failed to open file, stop FileFetcher", zap.Error(err))
-		ff.Stop()
-		if ff.parent != nil {
-			ff.parent.Notify(ff, StatusStopped)
+	if ff.follow {
+		lf, err := openLogFile(ff.path)
+		if err == nil && lf.Compressed() {
+			lf.Close()
+			err = errors.New("follow mode does not support compressed file")
 		}
-		return err
+		var offset int64
+		if err == nil {
+			if offset, _, err = locateLogFile(lf, ff.path, ff.cursors, ff.begin, ff.analyzer, false); err != nil {
+				lf.Close()
+			}
+		}
+		if err != nil {
+			return ff.fail(err)
+		}
+		return ff.tail(lf.file, offset)
+	}
+
+	for {
+		if err := ff.scan(); err != nil && err != errSeekPending {
+			return err
+		}
+		if !ff.applySeek(true) {
+			break
+		}
+		ff.cursors = nil // 重新定位后按时间查找，不再使用断点
+	}
+
+	stats := ff.Stats()
+	Logger.Info("finished to fetcher file", zap.Int64("lines", stats.Lines), zap.Int64("oversized", stats.Oversized), zap.Int64("invalid", stats.Invalid))
+	ff.Finish()
+	return nil
+}
+
+// Seek 从日志时间at重新读取文件，实现Seeker，follow模式不支持重新定位
+func (ff *FileFetcher) Seek(at time.Time, epoch int64) error {
+	if ff.follow {
+		return errors.New("follow mode does not support seek")
+	}
+	return ff.requestSeek(at, epoch)
+}
+
+// scan 从开始时间（或者断点）读取文件，读到文件末尾、超出结束时间时返回nil，收到重新定位请求时返回errSeekPending
+func (ff *FileFetcher) scan() error {
+	lf, err := openLogFile(ff.path)
+	var (
+		offset int64
+		idx    *logIndex
+	)
+	if err == nil {
+		if offset, idx, err = locateLogFile(lf, ff.path, ff.cursors, ff.begin, ff.analyzer, ff.index); err != nil {
+			lf.Close()
+		}
+	}
+	if err != nil {
+		return ff.fail(err)
+	}
+	defer lf.Close()
+	if idx != nil {
+		defer idx.save()
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if atomic.LoadInt32(&ff.status) == StatusStopped {
+	reader := newLineReader(lf, ff.path, ff.maxLine, &ff.stats)
+	reader.offset = offset
+	for {
+		if ff.Status() == StatusStopped {
 			return ErrTaskInterrupted
 		}
+		if ff.seekPending() {
+			return errSeekPending
+		}
+
+		line, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			Logger.Error("failed to load file content, stop FileFetcher", zap.Error(err))
+			ff.Stop()
+			return err
+		}
 
-		log := ff.analyzer.Analyze(scanner.Bytes())
+		log := ff.analyzer.Analyze(line)
 		if log == nil {
+			atomic.AddInt64(&ff.stats.Invalid, 1)
 			continue
 		}
+		if idx != nil {
+			idx.add(reader.start, log.OccurAt)
+		}
 
 		if log.OccurAt.After(ff.end) { // 日志时间超出，退出循环
 			Logger.Info("time of log is later than end time", zap.String("occurAt", log.OccurAt.String()),
 				zap.String("end", ff.end.String()))
-			break
+			return nil
 		}
 
 		if !log.OccurAt.Before(ff.begin) {
-			ff.output <- log
+			log.cursor = &sourceCursor{source: ff.path, offset: reader.offset}
+			log.epoch = ff.epoch
+			if !ff.send(log) {
+				return ErrTaskInterrupted
+			}
 		}
 	}
+}
 
-	if err = scanner.Err(); err != nil {
-		Logger.Error("failed to load file content, stop FileFetcher", zap.Error(err))
-		ff.Stop()
-		return err
+// fail 打开或者定位文件失败时停止FileFetcher
+func (ff *FileFetcher) fail(err error) error {
+	Logger.Error("failed to open file, stop FileFetcher", zap.Error(err))
+	ff.baseFetcher.Stop()
+	if ff.parent != nil {
+		ff.parent.Notify(ff, StatusStopped)
 	}
-	Logger.Info("finished to fetcher file")
+	return err
+}
+
+// tail follow模式的主循环
+func (ff *FileFetcher) tail(file *os.File, offset int64) error {
+	defer func() { file.Close() }()
+
+	reader := bufio.NewReaderSize(file, 64<<10)
+	max := maxLineSize(ff.maxLine)
+	var (
+		partial  []byte
+		skipping bool // 当前行超过最大长度，读到换行符后跳过
+		draining bool // 已发现文件轮转，读完旧文件后切换
+	)
+	for {
+		if ff.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+
+		line, err := reader.ReadSlice('\n')
+		offset += int64(len(line))
+		if !skipping {
+			partial = append(partial, line...)
+			if len(partial) > max+2 {
+				skipping, partial = true, nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == nil {
+			if skipping || len(bytes.TrimRight(partial, "\r\n")) > max {
+				skipping, partial = false, nil
+				ff.stats.skipOversized(ff.path, max)
+				continue
+			}
+			if !ff.release(partial, offset) {
+				return ff.exitTail()
+			}
+			partial = nil
+			continue
+		}
+		if err != io.EOF {
+			Logger.Error("failed to load file content, stop FileFetcher", zap.Error(err))
+			ff.Stop()
+			return err
+		}
+
+		info, err := os.Stat(ff.path)
+		if err != nil { // 文件被移走，新文件尚未创建
+			time.Sleep(FileFollowInterval)
+			continue
+		}
+		current, _ := file.Stat()
+
+		switch {
+		case !os.SameFile(info, current) && !draining:
+			draining = true
+			continue
+		case !os.SameFile(info, current):
+			next, err := os.Open(ff.path)
+			if err != nil {
+				time.Sleep(FileFollowInterval)
+				continue
+			}
+			if len(partial) > 0 && !ff.release(partial, offset) {
+				next.Close()
+				return ff.exitTail()
+			}
+			Logger.Info("log file was rotated, reopen it", zap.String("path", ff.path))
+			file.Close()
+			file, offset, partial, skipping, draining = next, 0, nil, false, false
+			reader.Reset(file)
+		case info.Size() < offset:
+			Logger.Info("log file was truncated, read it from the beginning", zap.String("path", ff.path))
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				Logger.Error("failed to seek file, stop FileFetcher", zap.Error(err))
+				ff.Stop()
+				return err
+			}
+			offset, partial, skipping = 0, nil, false
+			reader.Reset(file)
+		default:
+			time.Sleep(FileFollowInterval)
+		}
+	}
+}
+
+// release 解析一行日志，延迟到OccurAt+delay之后再投递，返回false表示超出结束时间或者已被停止，offset为该行之后的偏移量
+func (ff *FileFetcher) release(line []byte, offset int64) bool {
+	atomic.AddInt64(&ff.stats.Lines, 1)
+	log := ff.analyzer.Analyze(bytes.TrimRight(line, "\r\n"))
+	if log == nil {
+		atomic.AddInt64(&ff.stats.Invalid, 1)
+		return true
+	}
+	if log.OccurAt.Before(ff.begin) {
+		return true
+	}
+	if log.OccurAt.After(ff.end) {
+		Logger.Info("time of log is later than end time", zap.String("occurAt", log.OccurAt.String()),
+			zap.String("end", ff.end.String()))
+		return false
+	}
+
+	for wait := time.Until(log.OccurAt.Add(ff.delay)); wait > 0; wait = time.Until(log.OccurAt.Add(ff.delay)) {
+		if ff.Status() == StatusStopped {
+			return false
+		}
+		if wait > FileFollowInterval {
+			wait = FileFollowInterval
+		}
+		select {
+		case <-time.After(wait):
+		case <-ff.done:
+			return false
+		}
+	}
+	log.cursor = &sourceCursor{source: ff.path, offset: offset}
+	return ff.send(log)
+}
+
+func (ff *FileFetcher) exitTail() error {
+	if ff.Status() == StatusStopped {
+		return ErrTaskInterrupted
+	}
+	Logger.Info("finished to follow file")
 	ff.Finish()
 	return nil
 }
@@ -248,10 +535,17 @@ func (sa *AliyunSLSAnt) work() {
 				data, _ := json.Marshal(log)
 				record := sa.queen.analyzer.Analyze(data)
 				if record != nil && sa.output != nil {
-					if record.OccurAt.Unix() < sa.from || record.OccurAt.Unix() >= sa.end {
-						record.OccurAt = time.Unix(sa.from, rand.Int63n(1000)*1e6) // sls查询结果中的日志会超出时间范围
+					// sls按写入时间查询，日志时间可能超出当前时间块；未开启ReorderStage时修正到时间块内，避免乱序的日志直接进入TimeWheel
+					if !sa.queen.keepTime && (record.OccurAt.Unix() < sa.from || record.OccurAt.Unix() >= sa.end) {
+						record.OccurAt = time.Unix(sa.from, rand.Int63n(1000)*1e6)
+					}
+					record.cursor = &sourceCursor{source: sa.queen.source(), offset: sa.from}
+					select {
+					case sa.output <- record:
+					case <-sa.queen.done: // 任务被停止，不再读取
+						close(sa.output)
+						return
 					}
-					sa.output <- record
 				}
 			}
 		}
@@ -295,10 +589,32 @@ func NewAliyunSLSConcurrencyFetcher(key, secret, region, project, logstore, exp
 		nil
 }
 
+// WithKeepTime 保留超出查询时间块的原始日志时间，默认修正到时间块内；开启后跨时间块的乱序须由ReorderStage处理
+func (scf *AliyunSLSConcurrencyFetcher) WithKeepTime(keep bool) *AliyunSLSConcurrencyFetcher {
+	scf.keepTime = keep
+	return scf
+}
+
+// Resume 从断点记录的时间块（秒）重新查询，实现Checkpointer
+//
+// sls按写入时间查询，同一时间块内的查询结果无法保序，因此以时间块为读取位置，断点所在时间块内早于任务开始时间的日志由TimeWheel忽略
+func (scf *AliyunSLSConcurrencyFetcher) Resume(cursors map[string]int64) error {
+	scf.cursors = cursors
+	return nil
+}
+
+func (scf *AliyunSLSConcurrencyFetcher) source() string {
+	return scf.Project + "/" + scf.LogStore
+}
+
 // next sls的查询精度为秒，需要特殊处理
 func (scf *AliyunSLSConcurrencyFetcher) next() (int64, int64, bool) {
 	if scf.cursor.IsZero() {
 		scf.cursor = scf.baseFetcher.begin
+		if from, ok := scf.cursors[scf.source()]; ok && from > 0 && from <= scf.cursor.Unix() {
+			Logger.Info("resume sls from checkpoint", zap.Int64("from", from))
+			scf.cursor = time.Unix(from, 0)
+		}
 	}
 	begin := scf.cursor
 	if !begin.Before(scf.end) {
@@ -315,6 +631,7 @@ func (scf *AliyunSLSConcurrencyFetcher) next() (int64, int64, bool) {
 
 func (scf *AliyunSLSConcurrencyFetcher) Start() error {
 	scf.start()
+	defer scf.closeOutput()
 	if scf.parent != nil {
 		scf.parent.Notify(scf, StatusRunning)
 	}
@@ -340,7 +657,12 @@ func (scf *AliyunSLSConcurrencyFetcher) Start() error {
 
 			ant := NewAliyunSLSAnt(scf, scf.preDownload, from, end)
 			go ant.work()
-			scf.antsNest <- ant
+			select {
+			case scf.antsNest <- ant:
+			case <-scf.done:
+				close(scf.antsNest)
+				return
+			}
 		}
 		close(scf.antsNest)
 	}()
@@ -374,15 +696,19 @@ func (scf *AliyunSLSConcurrencyFetcher) Start() error {
 					t = r.OccurAt
 				}
 				if r.OccurAt.Before(t) {
-					Logger.Warn("out-of-order", zap.Time("log_time", r.OccurAt), zap.Time("last_time", t))
+					Logger.Debug("out-of-order", zap.Time("log_time", r.OccurAt), zap.Time("last_time", t))
 				} else {
 					t = r.OccurAt
 				}
 				atomic.AddInt64(&scf.count, 1)
-				scf.output <- r
+				if !scf.send(r) {
+					return ErrTaskInterrupted
+				}
 			}
 		}
-
+		if scf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
 	}
 
 	scf.Finish()
@@ -414,29 +740,68 @@ func (scf *AliyunSLSConcurrencyFetcher) Provide() []ProviderMethod {
 	}
 }
 
+// NewKafkaSinglePartitionFetcher KafkaSinglePartitionFetcher的构造函数，默认读取partition 0，offset为起始offset，-2表示最早、-1表示最新
 func NewKafkaSinglePartitionFetcher(brokers []string, topic string, offset int64) (*KafkaSinglePartitionFetcher, error) {
 	if len(brokers) == 0 {
 		Logger.Error("bad broker")
 		return nil, errors.New("empty broker")
 	}
 
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          topic,
-		Partition:      0,
-		MinBytes:       10e3,
-		MaxBytes:       10e6,
-		CommitInterval: time.Second,
-	})
-	r.SetOffset(offset)
 	Logger.Info("created KafkaSinglePartitionFetcher", zap.Strings("brokers", brokers), zap.String("topic", topic), zap.Int64("offset", offset))
 	return &KafkaSinglePartitionFetcher{
 		baseFetcher: newBaseFetcher(),
-		reader:      r,
+		brokers:     brokers,
+		topic:       topic,
+		offset:      offset,
 	}, nil
 }
 
+// WithPartition 设置读取的partition
+func (kspf *KafkaSinglePartitionFetcher) WithPartition(partition int) *KafkaSinglePartitionFetcher {
+	kspf.partition = partition
+	return kspf
+}
+
+// WithOffsetByTime 根据任务开始时间（向前KafkaOffsetLookBack）确定起始offset，忽略构造时传入的offset
+func (kspf *KafkaSinglePartitionFetcher) WithOffsetByTime(enabled bool) *KafkaSinglePartitionFetcher {
+	kspf.byTime = enabled
+	return kspf
+}
+
+// WithGroup 以消费组成员的身份读取topic，partition由消费组分配，offset定期提交，
+// 多个dispatcher使用同一个消费组时可以分摊线上流量的镜像。消费组没有已提交的offset时从构造时传入的offset（-2或者-1）开始，
+// 不支持WithPartition、WithOffsetByTime
+func (kspf *KafkaSinglePartitionFetcher) WithGroup(groupID string) *KafkaSinglePartitionFetcher {
+	kspf.groupID = groupID
+	return kspf
+}
+
+// WithEnvelope 将消息的key、headers、timestamp连同消息体封装为JSON交给Analyzer，见kafkaEnvelope
+func (kspf *KafkaSinglePartitionFetcher) WithEnvelope(enabled bool) *KafkaSinglePartitionFetcher {
+	kspf.envelope = enabled
+	return kspf
+}
+
+// WithKeyHash 消息key不为空时作为HashField，使同一个key的请求由同一个replayer回放
+func (kspf *KafkaSinglePartitionFetcher) WithKeyHash(enabled bool) *KafkaSinglePartitionFetcher {
+	kspf.keyHash = enabled
+	return kspf
+}
+
+// Resume 从断点记录的offset继续读取，实现Checkpointer，消费组模式下由消费组提交的offset决定，忽略断点
+func (kspf *KafkaSinglePartitionFetcher) Resume(cursors map[string]int64) error {
+	kspf.cursors = cursors
+	return nil
+}
+
+func (kspf *KafkaSinglePartitionFetcher) source() string {
+	return fmt.Sprintf("%s-%d", kspf.topic, kspf.partition)
+}
+
 func (kspf *KafkaSinglePartitionFetcher) Stop() {
+	if kspf.cancel != nil {
+		kspf.cancel()
+	}
 	kspf.baseFetcher.Stop()
 	if kspf.parent != nil {
 		kspf.parent.Notify(kspf, StatusStopped)
@@ -450,16 +815,63 @@ func (kspf *KafkaSinglePartitionFetcher) Finish() {
 	}
 }
 
+// newReader 按照消费组、开始时间或者指定offset创建reader
+func (kspf *KafkaSinglePartitionFetcher) newReader(ctx context.Context) (*kafka.Reader, error) {
+	conf := kafka.ReaderConfig{
+		Brokers:        kspf.brokers,
+		Topic:          kspf.topic,
+		MinBytes:       10e3,
+		MaxBytes:       10e6,
+		CommitInterval: time.Second,
+	}
+	if kspf.groupID != "" {
+		conf.GroupID = kspf.groupID
+		conf.StartOffset = kspf.offset
+		return kafka.NewReader(conf), nil
+	}
+
+	conf.Partition = kspf.partition
+	r := kafka.NewReader(conf)
+	var err error
+	if cursor, ok := kspf.cursors[kspf.source()]; ok && cursor >= 0 {
+		Logger.Info("resume partition from checkpoint", zap.Int("partition", kspf.partition), zap.Int64("offset", cursor))
+		err = r.SetOffset(cursor)
+	} else if kspf.byTime {
+		err = r.SetOffsetAt(ctx, kspf.begin.Add(-KafkaOffsetLookBack))
+	} else {
+		err = r.SetOffset(kspf.offset)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
 func (kspf *KafkaSinglePartitionFetcher) Start() error {
 	kspf.baseFetcher.start()
+	defer kspf.closeOutput()
 	if kspf.parent != nil {
 		kspf.parent.Notify(kspf, StatusRunning)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	kspf.cancel = cancel
+	reader, err := kspf.newReader(ctx)
+	if err != nil {
+		Logger.Error("failed to create kafka reader, stop KafkaSinglePartitionFetcher", zap.Error(err))
+		kspf.Stop()
+		return err
+	}
+	kspf.reader = reader
+	defer reader.Close()
+	Logger.Info("start to read message from kafka", zap.String("topic", kspf.topic), zap.Int("partition", kspf.partition),
+		zap.String("group", kspf.groupID), zap.Bool("by_time", kspf.byTime))
+
 	go func() {
 		var last int64
 		var current int64
-		for {
+		for kspf.Status() == StatusRunning {
 			time.Sleep(time.Second)
 			current = atomic.LoadInt64(&kspf.counter)
 			kspf.qps = current - last
@@ -469,21 +881,28 @@ func (kspf *KafkaSinglePartitionFetcher) Start() error {
 	}()
 
 	for {
-		msg, err := kspf.reader.ReadMessage(context.Background())
-		atomic.AddInt64(&kspf.counter, 1)
+		msg, err := reader.ReadMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ErrTaskInterrupted
+			}
 			Logger.Error("occur error when reading message", zap.Error(err))
+			kspf.Stop()
 			return err
 		}
+		atomic.AddInt64(&kspf.counter, 1)
 
 		if kspf.analyzer == nil {
 			continue
 		}
 
-		log := kspf.analyzer.Analyze(msg.Value)
+		log := kspf.analyze(kspf.analyzer, msg)
 		if log == nil {
 			continue
 		}
+		if kspf.groupID == "" {
+			log.cursor = &sourceCursor{source: kspf.source(), offset: msg.Offset + 1}
+		}
 
 		if log.OccurAt.After(kspf.end) {
 			Logger.Info("time of log record is later than end time, finish fetching from kafka", zap.Time("occurAt", log.OccurAt), zap.Time("end", kspf.end))
@@ -491,10 +910,15 @@ func (kspf *KafkaSinglePartitionFetcher) Start() error {
 		}
 
 		if !log.OccurAt.Before(kspf.begin) {
-			kspf.output <- log
+			select {
+			case kspf.output <- log:
+			case <-ctx.Done():
+				return ErrTaskInterrupted
+			}
 		}
 	}
 
+	kspf.Finish()
 	return nil
 }
 
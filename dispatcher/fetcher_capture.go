@@ -0,0 +1,127 @@
+package dispatcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// CaptureFetcher 重放CaptureExporter生成的抓取文件，按文件中的顺序输出日志，OccurAt与HashField保持不变，不依赖Analyzer
+	CaptureFetcher struct {
+		path string
+		*baseFetcher
+	}
+)
+
+var (
+	// CaptureMaxRecordSize 抓取文件中单条记录的最大长度
+	CaptureMaxRecordSize uint64 = 64 << 20
+)
+
+// NewCaptureFetcher CaptureFetcher的构造函数
+func NewCaptureFetcher(path string) *CaptureFetcher {
+	return &CaptureFetcher{path: path, baseFetcher: newBaseFetcher()}
+}
+
+// Start 顺序读取抓取文件，交由TimeWheel按时间顺序分发
+func (cf *CaptureFetcher) Start() error {
+	cf.baseFetcher.start()
+	defer cf.closeOutput()
+	if cf.parent != nil {
+		cf.parent.Notify(cf, StatusRunning)
+	}
+
+	file, err := os.Open(cf.path)
+	if err != nil {
+		Logger.Error("failed to open capture file, stop CaptureFetcher", zap.Error(err))
+		cf.Stop()
+		return err
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		Logger.Error("failed to open capture file, stop CaptureFetcher", zap.Error(err))
+		cf.Stop()
+		return err
+	}
+	defer gr.Close()
+
+	reader := bufio.NewReader(gr)
+	for {
+		if cf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+
+		log, err := decodeCapturedRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			Logger.Error("failed to read capture file, stop CaptureFetcher", zap.Error(err))
+			cf.Stop()
+			return err
+		}
+		if log.OccurAt.Before(cf.begin) || log.OccurAt.After(cf.end) { // 抓取时可能尚未重排序，因此不提前退出
+			continue
+		}
+		if !cf.send(log) {
+			return ErrTaskInterrupted
+		}
+	}
+
+	Logger.Info("finished to fetch capture file")
+	cf.Finish()
+	return nil
+}
+
+func (cf *CaptureFetcher) Finish() {
+	cf.baseFetcher.Finish()
+	if cf.parent != nil {
+		cf.parent.Notify(cf, StatusFinished)
+	}
+}
+
+func (cf *CaptureFetcher) Stop() {
+	cf.baseFetcher.Stop()
+	if cf.parent != nil {
+		cf.parent.Notify(cf, StatusStopped)
+	}
+}
+
+// decodeCapturedRecord 读取一条varint长度前缀的CapturedRecord，文件结束时返回io.EOF
+func decodeCapturedRecord(r *bufio.Reader) (*LogRecordWrapper, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > CaptureMaxRecordSize {
+		return nil, fmt.Errorf("capture record too large: %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	record := &pb.CapturedRecord{}
+	if err = proto.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	if record.Log == nil {
+		return nil, errors.New("capture record without log")
+	}
+	return &LogRecordWrapper{HashField: record.HashField, OccurAt: time.Unix(0, record.OccurAt), LogRecord: record.Log}, nil
+}
@@ -0,0 +1,44 @@
+package dispatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCaptureFetcher_RoundTrip(t *testing.T) {
+	base := time.Unix(1606118400, 123456789)
+	input := []*LogRecordWrapper{
+		{HashField: "u1", OccurAt: base, LogRecord: &pb.LogRecord{Url: "http://a.com/x?id=1", Method: "POST", Header: map[string]string{"X-A": "1"}, Body: []byte{0, 1, 2, '\n'}}},
+		{OccurAt: base.Add(-time.Second), LogRecord: &pb.LogRecord{Url: "http://a.com/y", Method: "GET"}},
+		{HashField: "u2", OccurAt: base.Add(time.Hour), LogRecord: &pb.LogRecord{Url: "http://a.com/z", Method: "GET"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "traffic.cap")
+	ce, err := NewCaptureExporter(path)
+	assert.Nil(t, err)
+	assert.Len(t, runStage(t, ce, input...), 3)
+
+	logs := fetchAll(t, NewCaptureFetcher(path), base.Add(-time.Minute), base.Add(time.Minute))
+	assert.Len(t, logs, 2)
+	for i, log := range logs {
+		assert.Equal(t, input[i].HashField, log.HashField)
+		assert.True(t, input[i].OccurAt.Equal(log.OccurAt))
+		assert.True(t, proto.Equal(input[i].LogRecord, log.LogRecord))
+	}
+
+	// 文件被截断时返回错误
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	truncated := filepath.Join(t.TempDir(), "truncated.cap")
+	assert.Nil(t, os.WriteFile(truncated, data[:len(data)-12], 0644))
+	cf := NewCaptureFetcher(truncated)
+	cf.TimeRange(base.Add(-time.Minute), base.Add(time.Minute))
+	cf.SetOutput(make(chan *LogRecordWrapper, 10))
+	assert.NotNil(t, cf.Start())
+}
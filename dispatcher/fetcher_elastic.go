@@ -0,0 +1,243 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/olivere/elastic.v5"
+)
+
+type (
+	// ElasticFetcher ElasticSearch的日志收集对象，按时间字段顺序滚动读取索引中的日志
+	ElasticFetcher struct {
+		*baseFetcher
+		client    *elastic.Client
+		index     string
+		query     string
+		timeField string
+		pageSize  int
+		keepAlive string
+		counter   int64
+		qps       int64
+	}
+)
+
+var (
+	// ElasticDefaultTimeField 默认的日志时间字段
+	ElasticDefaultTimeField = "@timestamp"
+	// ElasticDefaultPageSize 默认每次scroll拉取的日志条数
+	ElasticDefaultPageSize = 1000
+	// ElasticDefaultKeepAlive scroll上下文的保持时间，TimeWheel回放较慢时需要适当调大
+	ElasticDefaultKeepAlive = "10m"
+)
+
+// NewElasticFetcher ElasticFetcher的构造函数，index支持通配符，如gateway-access-*
+func NewElasticFetcher(urls []string, user, password, index, query string) (*ElasticFetcher, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("empty elasticsearch url")
+	}
+	if index == "" {
+		return nil, errors.New("empty elasticsearch index")
+	}
+
+	options := []elastic.ClientOptionFunc{elastic.SetURL(urls...), elastic.SetSniff(false)}
+	if user != "" {
+		options = append(options, elastic.SetBasicAuth(user, password))
+	}
+	client, err := elastic.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	Logger.Info("created ElasticFetcher", zap.Strings("urls", urls), zap.String("index", index), zap.String("query", query))
+
+	return &ElasticFetcher{
+		baseFetcher: newBaseFetcher(),
+		client:      client,
+		index:       index,
+		query:       query,
+		timeField:   ElasticDefaultTimeField,
+		pageSize:    ElasticDefaultPageSize,
+		keepAlive:   ElasticDefaultKeepAlive,
+	}, nil
+}
+
+// WithTimeField 设置用于范围查询及排序的时间字段
+func (ef *ElasticFetcher) WithTimeField(field string) *ElasticFetcher {
+	if field != "" {
+		ef.timeField = field
+	}
+	return ef
+}
+
+// WithPageSize 设置每次scroll拉取的日志条数
+func (ef *ElasticFetcher) WithPageSize(size int) *ElasticFetcher {
+	if size > 0 {
+		ef.pageSize = size
+	}
+	return ef
+}
+
+// WithKeepAlive 设置scroll上下文的保持时间，如"10m"，两次拉取的间隔超过该时间时scroll上下文过期
+func (ef *ElasticFetcher) WithKeepAlive(keepAlive string) *ElasticFetcher {
+	if keepAlive != "" {
+		ef.keepAlive = keepAlive
+	}
+	return ef
+}
+
+// buildQuery 按时间字段查询[begin, end)内的日志，任务没有结束时间时不设上限
+func (ef *ElasticFetcher) buildQuery() elastic.Query {
+	rq := elastic.NewRangeQuery(ef.timeField).
+		Gte(ef.begin.UnixNano() / 1e6).
+		Format("epoch_millis")
+	if !ef.end.Equal(openEnd) { // openEnd超出UnixNano的表示范围
+		rq.Lt(ef.end.UnixNano() / 1e6)
+	}
+	if ef.query == "" {
+		return rq
+	}
+	return elastic.NewBoolQuery().Filter(rq).Must(elastic.NewQueryStringQuery(ef.query))
+}
+
+// Start 按时间字段升序滚动读取日志，解析出LogRecordWrapper对象，交由TimeWheel按时间顺序分发
+func (ef *ElasticFetcher) Start() error {
+	ef.baseFetcher.start()
+	defer ef.closeOutput()
+	if ef.parent != nil {
+		ef.parent.Notify(ef, StatusRunning)
+	}
+
+	go func() {
+		var last int64
+		var current int64
+		for ef.Status() == StatusRunning {
+			time.Sleep(time.Second)
+			current = atomic.LoadInt64(&ef.counter)
+			ef.qps = current - last
+			last = current
+			Logger.Info("ElasticFetcher QPS", zap.Int64("fetcher_qps", ef.qps), zap.Int64("count", last))
+		}
+	}()
+
+	for {
+		if err := ef.scroll(); err != nil && err != errSeekPending {
+			return err
+		}
+		if !ef.applySeek(true) {
+			break
+		}
+	}
+
+	Logger.Info("finished to fetch logs from elasticsearch")
+	ef.Finish()
+	return nil
+}
+
+// Seek 从日志时间at重新按时间范围查询并滚动读取，实现Seeker
+func (ef *ElasticFetcher) Seek(at time.Time, epoch int64) error {
+	return ef.requestSeek(at, epoch)
+}
+
+// scroll 按[begin, end)滚动读取日志直到超出结束时间，收到重新定位请求时返回errSeekPending
+func (ef *ElasticFetcher) scroll() error {
+	scroll := ef.client.Scroll(ef.index).
+		Query(ef.buildQuery()).
+		Sort(ef.timeField, true).
+		Size(ef.pageSize).
+		KeepAlive(ef.keepAlive)
+	defer scroll.Clear(context.Background())
+
+	for pages := 0; ; pages++ {
+		res, err := scroll.Do(context.Background())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if pages > 0 && isScrollExpired(err) {
+				err = fmt.Errorf("scroll context expired after keep_alive %s, replay is slower than expected, try a larger keep_alive: %w", ef.keepAlive, err)
+			}
+			Logger.Error("failed to scroll elasticsearch, stop ElasticFetcher", zap.Error(err))
+			ef.Stop()
+			return err
+		}
+
+		for _, hit := range res.Hits.Hits {
+			if ef.Status() == StatusStopped {
+				return ErrTaskInterrupted
+			}
+			if ef.seekPending() {
+				return errSeekPending
+			}
+			atomic.AddInt64(&ef.counter, 1)
+			if hit.Source == nil || ef.analyzer == nil {
+				continue
+			}
+
+			log := ef.analyzer.Analyze(*hit.Source)
+			if log == nil {
+				continue
+			}
+
+			if !log.OccurAt.Before(ef.end) { // 结果按时间排序，后续日志均超出范围
+				Logger.Info("time of log record is later than end time, finish fetching from elasticsearch",
+					zap.Time("occurAt", log.OccurAt), zap.Time("end", ef.end))
+				return nil
+			}
+
+			if !log.OccurAt.Before(ef.begin) {
+				log.epoch = ef.epoch
+				if !ef.send(log) {
+					return ErrTaskInterrupted
+				}
+			}
+		}
+	}
+}
+
+// isScrollExpired scroll上下文过期时elasticsearch返回404以及search_context_missing_exception
+func isScrollExpired(err error) bool {
+	var e *elastic.Error
+	if !errors.As(err, &e) || e.Status != http.StatusNotFound {
+		return false
+	}
+	if e.Details == nil || e.Details.Type == "search_context_missing_exception" {
+		return true
+	}
+	for _, cause := range e.Details.RootCause {
+		if cause.Type == "search_context_missing_exception" {
+			return true
+		}
+	}
+	return false
+}
+
+func (ef *ElasticFetcher) Finish() {
+	ef.baseFetcher.Finish()
+	if ef.parent != nil {
+		ef.parent.Notify(ef, StatusFinished)
+	}
+}
+
+func (ef *ElasticFetcher) Stop() {
+	ef.baseFetcher.Stop()
+	if ef.parent != nil {
+		ef.parent.Notify(ef, StatusStopped)
+	}
+}
+
+func (ef *ElasticFetcher) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/elastic/qps",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderResponse(w, []byte(fmt.Sprintf("{\"code\":200, \"elastic_qps\": \"%d\", \"total\": \"%d\"}", ef.qps, atomic.LoadInt64(&ef.counter))), "application/json")
+			},
+		},
+	}
+}
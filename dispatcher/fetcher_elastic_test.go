@@ -0,0 +1,201 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeElastic 模拟elasticsearch的scroll接口，每个scroll请求返回一页日志
+type fakeElastic struct {
+	mu      sync.Mutex
+	pages   [][]string
+	queries []string // 首次查询的请求体
+	cleared bool
+	onPage  func(page int)
+	fail    bool
+	expired bool     // 继续滚动时scroll上下文已过期
+	scrolls []string // 首次查询请求中的scroll保持时间
+}
+
+func (fe *fakeElastic) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	switch {
+	case req.Method == http.MethodHead:
+		return
+	case req.Method == http.MethodDelete:
+		fe.cleared = true
+		w.Write([]byte(`{"succeeded":true}`))
+		return
+	case strings.HasSuffix(req.URL.Path, "/_search"):
+		fe.queries = append(fe.queries, string(body))
+		fe.scrolls = append(fe.scrolls, req.URL.Query().Get("scroll"))
+	}
+	if fe.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"type":"search_phase_execution_exception","reason":"all shards failed"}}`))
+		return
+	}
+
+	page := len(fe.queries) - 1
+	if strings.HasSuffix(req.URL.Path, "/_search/scroll") {
+		if fe.expired {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"root_cause":[{"type":"search_context_missing_exception","reason":"No search context found for id [1]"}],"type":"search_phase_execution_exception","reason":"all shards failed"},"status":404}`))
+			return
+		}
+		var s struct {
+			ScrollID string `json:"scroll_id"`
+		}
+		json.Unmarshal(body, &s)
+		fmt.Sscanf(s.ScrollID, "scroll-%d", &page)
+		page++
+	}
+	if fe.onPage != nil {
+		fe.onPage(page)
+	}
+	var hits []string
+	if page < len(fe.pages) {
+		for _, line := range fe.pages[page] {
+			hits = append(hits, fmt.Sprintf(`{"_index":"access","_type":"log","_id":"%s","_source":{"line":"%s"}}`, line, line))
+		}
+	}
+	fmt.Fprintf(w, `{"_scroll_id":"scroll-%d","hits":{"total":%d,"hits":[%s]}}`, page, len(hits), strings.Join(hits, ","))
+}
+
+// elasticLineAnalyzeFunc 解析_source中line字段的测试日志
+func elasticLineAnalyzeFunc(data []byte) (*LogRecordWrapper, bool) {
+	var source struct {
+		Line string `json:"line"`
+	}
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, false
+	}
+	return msecAnalyzeFunc([]byte(source.Line))
+}
+
+func newTestElasticFetcher(t *testing.T, fe *fakeElastic) *ElasticFetcher {
+	server := httptest.NewServer(fe)
+	t.Cleanup(server.Close)
+	ef, err := NewElasticFetcher([]string{server.URL}, "", "", "access-*", "status:200")
+	assert.Nil(t, err)
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(elasticLineAnalyzeFunc)
+	ef.WithPageSize(2).WithAnalyzer(analyzer)
+	return ef
+}
+
+func TestElasticFetcher_Scroll(t *testing.T) {
+	fe := &fakeElastic{pages: [][]string{
+		{"500 /a0", "1000 /a1"},
+		{"2000 /a2", "3000 /a3"},
+		{"4000 /a4", "12000 /a12"},
+		{"13000 /a13"},
+	}}
+	ef := newTestElasticFetcher(t, fe)
+
+	logs := fetchAll(t, ef, ParseMSec(1000), ParseMSec(10000))
+	assert.Equal(t, []int64{1000, 2000, 3000, 4000}, occurAtMSec(logs))
+	assert.Equal(t, StatusFinished, ef.Status())
+
+	// 按时间字段范围查询并升序排序，读取结束时清除scroll上下文
+	assert.Len(t, fe.queries, 1)
+	var query map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(fe.queries[0]), &query))
+	filter := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].(map[string]interface{})
+	timeRange := filter["range"].(map[string]interface{})["@timestamp"].(map[string]interface{})
+	assert.EqualValues(t, 1000, timeRange["from"])
+	assert.EqualValues(t, 10000, timeRange["to"])
+	assert.Equal(t, false, timeRange["include_upper"])
+	assert.Contains(t, fe.queries[0], `"status:200"`)
+	assert.Contains(t, fe.queries[0], `{"@timestamp":{"order":"asc"}}`)
+	assert.True(t, fe.cleared)
+
+	// 任务没有结束时间时不设上限
+	fe = &fakeElastic{pages: [][]string{{"1000 /a1"}}}
+	ef = newTestElasticFetcher(t, fe)
+	logs = fetchAll(t, ef, ParseMSec(1000), parseJobEnd(0))
+	assert.Equal(t, []int64{1000}, occurAtMSec(logs))
+	assert.Nil(t, json.Unmarshal([]byte(fe.queries[0]), &query))
+	filter = query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].(map[string]interface{})
+	timeRange = filter["range"].(map[string]interface{})["@timestamp"].(map[string]interface{})
+	assert.EqualValues(t, 1000, timeRange["from"])
+	assert.Nil(t, timeRange["to"])
+}
+
+func TestElasticFetcher_Stop(t *testing.T) {
+	fe := &fakeElastic{pages: [][]string{{"1000 /a1", "2000 /a2"}, {"3000 /a3", "4000 /a4"}}}
+	ef := newTestElasticFetcher(t, fe)
+	fe.onPage = func(page int) {
+		if page == 1 { // 读取第二页时任务被停止
+			ef.Stop()
+		}
+	}
+	ef.TimeRange(ParseMSec(0), ParseMSec(10000))
+	output := make(chan *LogRecordWrapper, 10)
+	ef.SetOutput(output)
+	assert.Equal(t, ErrTaskInterrupted, ef.Start())
+	assert.Equal(t, StatusStopped, ef.Status())
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		logs = append(logs, log)
+	}
+	assert.Equal(t, []int64{1000, 2000}, occurAtMSec(logs))
+}
+
+func TestElasticFetcher_Error(t *testing.T) {
+	fe := &fakeElastic{fail: true}
+	ef := newTestElasticFetcher(t, fe)
+	ef.TimeRange(ParseMSec(0), ParseMSec(10000))
+	ef.SetOutput(make(chan *LogRecordWrapper, 10))
+	assert.NotNil(t, ef.Start())
+	assert.Equal(t, StatusStopped, ef.Status())
+
+	// scroll上下文过期时提示调大keep_alive
+	fe = &fakeElastic{pages: [][]string{{"1000 /a1", "2000 /a2"}, {"3000 /a3"}}, expired: true}
+	ef = newTestElasticFetcher(t, fe).WithKeepAlive("30m")
+	ef.TimeRange(ParseMSec(0), ParseMSec(10000))
+	ef.SetOutput(make(chan *LogRecordWrapper, 10))
+	err := ef.Start()
+	assert.ErrorContains(t, err, "keep_alive 30m")
+	assert.True(t, isScrollExpired(err))
+	assert.Equal(t, StatusStopped, ef.Status())
+	assert.Equal(t, []string{"30m"}, fe.scrolls)
+}
+
+func TestElasticFetcher_Seek(t *testing.T) {
+	fe := &fakeElastic{pages: [][]string{{"1000 /a1", "2000 /a2"}, {"3000 /a3", "4000 /a4"}}}
+	ef := newTestElasticFetcher(t, fe)
+	fe.onPage = func(page int) {
+		if page == 1 && len(fe.queries) == 1 { // 读取第二页时重新定位
+			assert.Nil(t, ef.Seek(ParseMSec(500), 1))
+		}
+	}
+	logs := fetchAll(t, ef, ParseMSec(1000), ParseMSec(10000))
+	assert.Equal(t, []int64{1000, 2000, 3000, 4000}, occurAtMSec(logs))
+	var epochs []int64
+	for _, log := range logs {
+		epochs = append(epochs, log.epoch)
+	}
+	assert.Equal(t, []int64{0, 0, 1, 1}, epochs)
+
+	// 从新位置重新查询
+	assert.Len(t, fe.queries, 2)
+	var query map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(fe.queries[1]), &query))
+	filter := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].(map[string]interface{})
+	assert.EqualValues(t, 500, filter["range"].(map[string]interface{})["@timestamp"].(map[string]interface{})["from"])
+
+	// 读取完毕后无法重新定位
+	assert.Equal(t, ErrSeekUnavailable, ef.Seek(ParseMSec(500), 2))
+}
@@ -0,0 +1,254 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// MultipleFilesFetcher 多文件日志收集对象，每个文件内的日志需有序，文件之间按OccurAt归并后再交给TimeWheel
+	//
+	// 与FileFetcher一样透明解压gzip、zstd、bzip2压缩的文件，并跳过超长以及无法解析的行
+	MultipleFilesFetcher struct {
+		paths   []string
+		buffer  int
+		maxLine int
+		index   bool
+		stats   LineStats
+		cursors map[string]int64
+		err     error
+		mu      sync.Mutex
+		*baseFetcher
+	}
+)
+
+var (
+	// MultipleFilesFetcherBuffer 每个文件预读取的日志条数
+	MultipleFilesFetcherBuffer = 100
+)
+
+// NewMultipleFilesFetcher MultipleFilesFetcher的构造函数，支持传入文件路径或者glob表达式，如/var/log/gateway/*.log
+func NewMultipleFilesFetcher(patterns ...string) (*MultipleFilesFetcher, error) {
+	var paths []string
+	seen := make(map[string]struct{})
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if matches == nil {
+			Logger.Warn("no file matched", zap.String("pattern", pattern))
+		}
+		for _, m := range matches {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			paths = append(paths, m)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no log file to fetch")
+	}
+	Logger.Info("created MultipleFilesFetcher", zap.Strings("files", paths))
+
+	return &MultipleFilesFetcher{paths: paths, buffer: MultipleFilesFetcherBuffer, baseFetcher: newBaseFetcher()}, nil
+}
+
+// WithMaxLineSize 设置最大行长度，超过的行被跳过，默认为FileMaxLineSize
+func (mff *MultipleFilesFetcher) WithMaxLineSize(size int) *MultipleFilesFetcher {
+	mff.maxLine = size
+	return mff
+}
+
+// WithIndex 为压缩文件维护旁路时间索引，与FileFetcher.WithIndex相同
+func (mff *MultipleFilesFetcher) WithIndex(enabled bool) *MultipleFilesFetcher {
+	mff.index = enabled
+	return mff
+}
+
+// Resume 从断点记录的各文件偏移量继续读取，实现Checkpointer
+func (mff *MultipleFilesFetcher) Resume(cursors map[string]int64) error {
+	mff.cursors = cursors
+	return nil
+}
+
+// Stats 返回所有文件的读取统计
+func (mff *MultipleFilesFetcher) Stats() LineStats {
+	return mff.stats.load()
+}
+
+// Start 同时读取所有文件，按OccurAt做k路归并后交由TimeWheel按时间顺序分发
+func (mff *MultipleFilesFetcher) Start() error {
+	mff.baseFetcher.start()
+	defer mff.closeOutput()
+	if mff.parent != nil {
+		mff.parent.Notify(mff, StatusRunning)
+	}
+
+	for {
+		if err := mff.scan(); err != nil && err != errSeekPending {
+			return err
+		}
+		if !mff.applySeek(true) {
+			break
+		}
+		mff.cursors = nil // 重新定位后按时间查找，不再使用断点
+	}
+
+	stats := mff.Stats()
+	Logger.Info("finished to fetch files", zap.Int("files", len(mff.paths)), zap.Int64("lines", stats.Lines),
+		zap.Int64("oversized", stats.Oversized), zap.Int64("invalid", stats.Invalid))
+	mff.Finish()
+	return nil
+}
+
+// Seek 从日志时间at重新读取所有文件，实现Seeker
+func (mff *MultipleFilesFetcher) Seek(at time.Time, epoch int64) error {
+	return mff.requestSeek(at, epoch)
+}
+
+// scan 从开始时间（或者断点）归并读取所有文件，收到重新定位请求时返回errSeekPending
+func (mff *MultipleFilesFetcher) scan() error {
+	var files []*logFile
+	for _, path := range mff.paths {
+		file, err := openLogFile(path)
+		if err != nil {
+			Logger.Error("failed to open file, stop MultipleFilesFetcher", zap.String("file", path), zap.Error(err))
+			for _, f := range files {
+				f.Close()
+			}
+			mff.Stop()
+			return err
+		}
+		files = append(files, file)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sources := make([]<-chan *LogRecordWrapper, len(files))
+	for i, file := range files {
+		c := make(chan *LogRecordWrapper, mff.buffer)
+		sources[i] = c
+		go mff.read(ctx, mff.paths[i], file, c)
+	}
+
+	completed := mergeSorted(sources, func(log *LogRecordWrapper) bool {
+		if mff.Status() == StatusStopped || mff.seekPending() {
+			return false
+		}
+		log.epoch = mff.epoch
+		return mff.send(log)
+	})
+	if !completed {
+		cancel()
+		for _, src := range sources { // 等待仍在读取的文件关闭
+			for range src {
+			}
+		}
+		if mff.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+		return errSeekPending
+	}
+
+	if err := mff.lastError(); err != nil {
+		Logger.Error("failed to load file content, stop MultipleFilesFetcher", zap.Error(err))
+		mff.Stop()
+		return err
+	}
+	return nil
+}
+
+// read 读取单个文件并解析，超出时间范围、读取完毕或者ctx被取消时关闭输出管道
+func (mff *MultipleFilesFetcher) read(ctx context.Context, path string, file *logFile, output chan<- *LogRecordWrapper) {
+	defer close(output)
+	defer file.Close()
+
+	// 各文件内部有序，分别跳过开始时间之前的内容
+	offset, idx, err := locateLogFile(file, path, mff.cursors, mff.begin, mff.analyzer, mff.index)
+	if err != nil {
+		Logger.Error("failed to seek file", zap.String("file", path), zap.Error(err))
+		mff.mu.Lock()
+		mff.err = err
+		mff.mu.Unlock()
+		return
+	}
+	if idx != nil {
+		defer idx.save()
+	}
+
+	reader := newLineReader(file, path, mff.maxLine, &mff.stats)
+	reader.offset = offset
+	for {
+		if mff.Status() == StatusStopped || ctx.Err() != nil {
+			return
+		}
+
+		line, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			Logger.Error("failed to read file", zap.String("file", path), zap.Error(err))
+			mff.mu.Lock()
+			mff.err = err
+			mff.mu.Unlock()
+			return
+		}
+
+		log := mff.analyzer.Analyze(line)
+		if log == nil {
+			atomic.AddInt64(&mff.stats.Invalid, 1)
+			continue
+		}
+		if idx != nil {
+			idx.add(reader.start, log.OccurAt)
+		}
+
+		if log.OccurAt.After(mff.end) {
+			Logger.Info("time of log is later than end time", zap.String("file", path),
+				zap.Time("occurAt", log.OccurAt), zap.Time("end", mff.end))
+			return
+		}
+
+		if !log.OccurAt.Before(mff.begin) {
+			log.cursor = &sourceCursor{source: path, offset: reader.offset}
+			select {
+			case output <- log:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (mff *MultipleFilesFetcher) lastError() error {
+	mff.mu.Lock()
+	defer mff.mu.Unlock()
+	return mff.err
+}
+
+func (mff *MultipleFilesFetcher) Finish() {
+	mff.baseFetcher.Finish()
+	if mff.parent != nil {
+		mff.parent.Notify(mff, StatusFinished)
+	}
+}
+
+func (mff *MultipleFilesFetcher) Stop() {
+	if mff.Status() == StatusStopped {
+		return
+	}
+	mff.baseFetcher.Stop()
+	if mff.parent != nil {
+		mff.parent.Notify(mff, StatusStopped)
+	}
+}
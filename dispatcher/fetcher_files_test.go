@@ -0,0 +1,101 @@
+package dispatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+// msecAnalyzeFunc 解析"毫秒时间戳 url"格式的测试日志
+func msecAnalyzeFunc(data []byte) (*LogRecordWrapper, bool) {
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return nil, false
+	}
+	ms, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &LogRecordWrapper{OccurAt: ParseMSec(ms), LogRecord: &pb.LogRecord{Url: fields[1], Method: "GET"}}, true
+}
+
+func writeTestLog(t *testing.T, dir, name string, lines ...string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	return path
+}
+
+func TestMultipleFilesFetcher_Merge(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLog(t, dir, "node1.log", "1000 /a1", "3000 /a3", "5000 /a5", "9000 /a9")
+	writeTestLog(t, dir, "node2.log", "2000 /b2", "bad line", "3000 /b3", "4000 /b4")
+	writeTestLog(t, dir, "node3.log", "500 /c0", "6000 /c6")
+
+	mff, err := NewMultipleFilesFetcher(filepath.Join(dir, "*.log"))
+	assert.Nil(t, err)
+	assert.Len(t, mff.paths, 3)
+
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	mff.WithAnalyzer(analyzer)
+	mff.TimeRange(ParseMSec(1000), ParseMSec(8000))
+	output := make(chan *LogRecordWrapper, 20)
+	mff.SetOutput(output)
+
+	assert.Nil(t, mff.Start())
+	assert.Equal(t, StatusFinished, mff.Status())
+
+	var urls []string
+	for log := range output {
+		urls = append(urls, log.Url)
+	}
+	assert.Equal(t, []string{"/a1", "/b2", "/a3", "/b3", "/b4", "/a5", "/c6"}, urls)
+}
+
+func TestNewMultipleFilesFetcher_NoMatch(t *testing.T) {
+	_, err := NewMultipleFilesFetcher(filepath.Join(t.TempDir(), "*.log"))
+	assert.NotNil(t, err)
+}
+
+func TestMultipleFilesFetcher_Compressed(t *testing.T) {
+	dir := t.TempDir()
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("1000 /a1\n3000 /a" + strings.Repeat("3", 100) + "\n5000 /a5\n"))
+	gw.Close()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "node1.log.gz"), gz.Bytes(), 0644))
+
+	var zs bytes.Buffer
+	zw, err := zstd.NewWriter(&zs)
+	assert.Nil(t, err)
+	zw.Write([]byte("2500 /c2\nbad line\n4000 /c4\n"))
+	zw.Close()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "node2.log.zst"), zs.Bytes(), 0644))
+
+	// "1000 /b1\n2000 /b2\n"的bzip2压缩结果
+	bz, _ := hex.DecodeString("425a683931415926535992a0c458000006d90000104000f000100020002129a1ea086015348179cc9c78bb9229c28484950622c0")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "node3.log.bz2"), bz, 0644))
+
+	mff, err := NewMultipleFilesFetcher(filepath.Join(dir, "node*"))
+	assert.Nil(t, err)
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	mff.WithMaxLineSize(64).WithAnalyzer(analyzer)
+
+	logs := fetchAll(t, mff, ParseMSec(0), ParseMSec(9000))
+	var urls []string
+	for _, log := range logs {
+		urls = append(urls, log.Url)
+	}
+	assert.Equal(t, []string{"/a1", "/b1", "/b2", "/c2", "/c4", "/a5"}, urls)
+	assert.Equal(t, LineStats{Lines: 8, Oversized: 1, Invalid: 1}, mff.Stats())
+}
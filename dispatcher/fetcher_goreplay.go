@@ -0,0 +1,179 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// GoReplayFetcher GoReplay（--output-file）录制文件收集者，只读取类型为1的请求，gzip、zstd、bzip2压缩的文件透明解压
+	//
+	// 每条记录由"1 <id> <纳秒时间戳> <latency>"头部、原始HTTP请求以及分隔符组成，不依赖Analyzer。
+	// 录制文件按请求完成的顺序写入，不保证严格有序，读取时在window内按时间重新排序
+	GoReplayFetcher struct {
+		path   string
+		scheme string
+		window time.Duration
+		*baseFetcher
+	}
+)
+
+const (
+	goreplayPayloadSeparator = "\n🐵🙈🙉\n"
+	goreplayRequestType      = "1"
+)
+
+var (
+	// GoReplayMaxPayloadSize 单条记录的最大长度
+	GoReplayMaxPayloadSize = 64 << 20
+	// GoReplaySortWindow 默认的排序窗口，晚于已读取的最大时间超过该值的记录仍按读取顺序输出
+	GoReplaySortWindow = 2 * time.Second
+)
+
+// NewGoReplayFetcher GoReplayFetcher的构造函数
+func NewGoReplayFetcher(path string) *GoReplayFetcher {
+	return &GoReplayFetcher{path: path, scheme: "http", window: GoReplaySortWindow, baseFetcher: newBaseFetcher()}
+}
+
+// WithSortWindow 设置排序窗口，为0时按文件顺序输出，乱序更严重时可以调大或者使用ReorderStage
+func (gf *GoReplayFetcher) WithSortWindow(window time.Duration) *GoReplayFetcher {
+	if window >= 0 {
+		gf.window = window
+	}
+	return gf
+}
+
+// WithScheme 设置回放时使用的scheme，默认为http
+func (gf *GoReplayFetcher) WithScheme(scheme string) *GoReplayFetcher {
+	if scheme != "" {
+		gf.scheme = scheme
+	}
+	return gf
+}
+
+// Start 顺序读取录制文件中的请求，在排序窗口内按时间排序后交由TimeWheel分发
+func (gf *GoReplayFetcher) Start() error {
+	gf.baseFetcher.start()
+	defer gf.closeOutput()
+	if gf.parent != nil {
+		gf.parent.Notify(gf, StatusRunning)
+	}
+
+	file, err := openLogFile(gf.path)
+	if err != nil {
+		Logger.Error("failed to open gor file, stop GoReplayFetcher", zap.Error(err))
+		gf.Stop()
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), GoReplayMaxPayloadSize)
+	scanner.Split(splitGoReplayPayload)
+
+	var skipped, sequence int
+	var pending recordHeap
+	var maxSeen time.Time
+	release := func(watermark time.Time) bool { // 输出不晚于水位的记录，被停止时返回false
+		for pending.Len() > 0 && !pending[0].log.OccurAt.After(watermark) {
+			if !gf.send(heap.Pop(&pending).(*mergeItem).log) {
+				return false
+			}
+		}
+		return true
+	}
+	for scanner.Scan() {
+		if gf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+
+		log, ok := parseGoReplayPayload(scanner.Bytes(), gf.scheme)
+		if !ok {
+			skipped++
+			continue
+		}
+		if log.OccurAt.Before(gf.begin) || log.OccurAt.After(gf.end) { // 录制文件不保证严格有序，因此不提前退出
+			continue
+		}
+		sequence++
+		heap.Push(&pending, &mergeItem{log: log, source: sequence})
+		if log.OccurAt.After(maxSeen) {
+			maxSeen = log.OccurAt
+		}
+		if !release(maxSeen.Add(-gf.window)) {
+			return ErrTaskInterrupted
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		Logger.Error("failed to read gor file, stop GoReplayFetcher", zap.Error(err))
+		gf.Stop()
+		return err
+	}
+	if !release(maxSeen) {
+		return ErrTaskInterrupted
+	}
+	Logger.Info("finished to fetch gor file", zap.Int("skipped", skipped))
+	gf.Finish()
+	return nil
+}
+
+func (gf *GoReplayFetcher) Finish() {
+	gf.baseFetcher.Finish()
+	if gf.parent != nil {
+		gf.parent.Notify(gf, StatusFinished)
+	}
+}
+
+func (gf *GoReplayFetcher) Stop() {
+	gf.baseFetcher.Stop()
+	if gf.parent != nil {
+		gf.parent.Notify(gf, StatusStopped)
+	}
+}
+
+// splitGoReplayPayload 实现bufio.SplitFunc，按GoReplay的分隔符切分记录
+func splitGoReplayPayload(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.Index(data, []byte(goreplayPayloadSeparator)); i >= 0 {
+		return i + len(goreplayPayloadSeparator), data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), bytes.TrimRight(data, "\n"), nil
+	}
+	return 0, nil, nil
+}
+
+// parseGoReplayPayload 解析单条记录，非请求类型或者格式有误时返回false
+func parseGoReplayPayload(payload []byte, scheme string) (*LogRecordWrapper, bool) {
+	idx := bytes.IndexByte(payload, '\n')
+	if idx < 0 {
+		return nil, false
+	}
+	meta := strings.Fields(string(payload[:idx]))
+	if len(meta) < 3 || meta[0] != goreplayRequestType {
+		return nil, false
+	}
+	ns, err := strconv.ParseInt(meta[2], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(payload[idx+1:])))
+	if err != nil {
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, false
+	}
+
+	return &LogRecordWrapper{OccurAt: time.Unix(0, ns), LogRecord: newHTTPLogRecord(req, body, scheme, "")}, true
+}
@@ -0,0 +1,103 @@
+package dispatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func fetchAll(t *testing.T, f Fetcher, begin, end time.Time) []*LogRecordWrapper {
+	f.TimeRange(begin, end)
+	output := make(chan *LogRecordWrapper, 100)
+	f.SetOutput(output)
+	assert.Nil(t, f.Start())
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+func TestGoReplayFetcher_Start(t *testing.T) {
+	payloads := []string{
+		"1 8e0f0a6d2b3c4d5e6f708192 1606118400000000000 -1\nPOST /orders?id=1 HTTP/1.1\r\nHost: api.example.com\r\nContent-Type: application/json\r\nContent-Length: 7\r\n\r\n{\"a\":1}",
+		"2 8e0f0a6d2b3c4d5e6f708192 1606118400005000000 5000000\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+		"1 8e0f0a6d2b3c4d5e6f708193 1606118401000000000\nPUT /upload HTTP/1.1\r\nHost: api.example.com\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n",
+		"1 bad\nGET / HTTP/1.1\r\n\r\n",
+		"1 8e0f0a6d2b3c4d5e6f708194 1606118500000000000 -1\nGET /late HTTP/1.1\r\nHost: api.example.com\r\n\r\n",
+	}
+	path := filepath.Join(t.TempDir(), "requests.gor")
+	assert.Nil(t, os.WriteFile(path, []byte(strings.Join(payloads, goreplayPayloadSeparator)+goreplayPayloadSeparator), 0644))
+
+	logs := fetchAll(t, NewGoReplayFetcher(path).WithScheme("https"), time.Unix(1606118400, 0), time.Unix(1606118460, 0))
+	assert.Len(t, logs, 2)
+
+	assert.Equal(t, "https://api.example.com/orders?id=1", logs[0].Url)
+	assert.Equal(t, "POST", logs[0].Method)
+	assert.Equal(t, `{"a":1}`, string(logs[0].Body))
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, logs[0].Header)
+	assert.Equal(t, time.Unix(1606118400, 0), logs[0].OccurAt)
+
+	assert.Equal(t, "PUT", logs[1].Method)
+	assert.Equal(t, "abc", string(logs[1].Body))
+}
+
+func TestGoReplayFetcher_SortWindow(t *testing.T) {
+	var payloads []string
+	for i, ms := range []int64{1000, 1500, 1200, 4000, 3900, 1100} {
+		payloads = append(payloads, fmt.Sprintf("1 %d %d -1\nGET /%d HTTP/1.1\r\nHost: api.example.com\r\n\r\n", i, ms*1e6, ms))
+	}
+	path := filepath.Join(t.TempDir(), "requests.gor")
+	assert.Nil(t, os.WriteFile(path, []byte(strings.Join(payloads, goreplayPayloadSeparator)+goreplayPayloadSeparator), 0644))
+
+	// 早于排序窗口的迟到记录直接输出
+	logs := fetchAll(t, NewGoReplayFetcher(path).WithSortWindow(time.Second), ParseMSec(0), ParseMSec(10000))
+	assert.Equal(t, []int64{1000, 1200, 1500, 1100, 3900, 4000}, occurAtMSec(logs))
+
+	logs = fetchAll(t, NewGoReplayFetcher(path).WithSortWindow(0), ParseMSec(0), ParseMSec(10000))
+	assert.Equal(t, []int64{1000, 1500, 1200, 4000, 3900, 1100}, occurAtMSec(logs))
+}
+
+func TestGoReplayExporter_Start(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.gor.gz")
+	ge, err := NewGoReplayExporter(path)
+	assert.Nil(t, err)
+
+	output := make(chan *LogRecordWrapper, 10)
+	ge.SetOutput(output)
+	done := make(chan error)
+	go func() { done <- ge.Start() }()
+
+	logs := []*LogRecordWrapper{
+		{OccurAt: time.Unix(100, 1), LogRecord: &pb.LogRecord{Url: "http://a.com/x?b=1", Method: "POST",
+			Header: map[string]string{"X-Token": "t", "Content-Length": "99"}, Body: []byte("hello")}},
+		{OccurAt: time.Unix(101, 0), LogRecord: &pb.LogRecord{Url: "http://a.com:8080/y"}},
+	}
+	for _, log := range logs {
+		ge.Recv() <- log
+	}
+	close(ge.Recv())
+	assert.Nil(t, <-done)
+
+	var passed []*LogRecordWrapper
+	for log := range output {
+		passed = append(passed, log)
+	}
+	assert.Equal(t, logs, passed)
+
+	fetched := fetchAll(t, NewGoReplayFetcher(path), time.Unix(0, 0), time.Unix(200, 0))
+	assert.Len(t, fetched, 2)
+	assert.Equal(t, "http://a.com/x?b=1", fetched[0].Url)
+	assert.Equal(t, map[string]string{"X-Token": "t"}, fetched[0].Header)
+	assert.Equal(t, "hello", string(fetched[0].Body))
+	assert.Equal(t, time.Unix(100, 1), fetched[0].OccurAt)
+	assert.Equal(t, "http://a.com:8080/y", fetched[1].Url)
+	assert.Equal(t, "GET", fetched[1].Method)
+}
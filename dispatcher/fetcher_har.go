@@ -0,0 +1,204 @@
+package dispatcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// HARFetcher HTTP Archive(HAR 1.2)文件收集者，用于回放浏览器、Charles、mitmproxy等工具导出的抓包文件
+	//
+	// HAR本身是结构化数据，因此不依赖Analyzer，每个entries[].request直接转换为LogRecord，startedDateTime作为OccurAt
+	HARFetcher struct {
+		path         string
+		keepResponse bool
+		*baseFetcher
+	}
+
+	// RecordedResponse 抓包文件中记录的原始响应，用于回放结果比对
+	RecordedResponse struct {
+		Status int
+		Header map[string]string
+		Body   []byte
+	}
+
+	harFile struct {
+		Log struct {
+			Version string      `json:"version"`
+			Entries []*harEntry `json:"entries"`
+		} `json:"log"`
+	}
+
+	harEntry struct {
+		StartedDateTime time.Time `json:"startedDateTime"`
+		Request         struct {
+			Method   string          `json:"method"`
+			URL      string          `json:"url"`
+			Headers  []*harNameValue `json:"headers"`
+			PostData *struct {
+				MimeType string          `json:"mimeType"`
+				Text     string          `json:"text"`
+				Encoding string          `json:"encoding"`
+				Params   []*harNameValue `json:"params"`
+			} `json:"postData"`
+		} `json:"request"`
+		Response struct {
+			Status  int             `json:"status"`
+			Headers []*harNameValue `json:"headers"`
+			Content struct {
+				Text     string `json:"text"`
+				Encoding string `json:"encoding"`
+			} `json:"content"`
+		} `json:"response"`
+	}
+
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+// NewHARFetcher HARFetcher的构造函数
+func NewHARFetcher(path string) *HARFetcher {
+	return &HARFetcher{path: path, baseFetcher: newBaseFetcher()}
+}
+
+// WithResponse 保留抓包中记录的响应，存放在LogRecordWrapper.Response中，不会下发给replayer
+func (hf *HARFetcher) WithResponse(keep bool) *HARFetcher {
+	hf.keepResponse = keep
+	return hf
+}
+
+// Start 读取HAR文件，按startedDateTime排序后交由TimeWheel按时间顺序分发
+func (hf *HARFetcher) Start() error {
+	hf.baseFetcher.start()
+	defer hf.closeOutput()
+	if hf.parent != nil {
+		hf.parent.Notify(hf, StatusRunning)
+	}
+
+	file, err := openLogFile(hf.path)
+	if err != nil {
+		Logger.Error("failed to open har file, stop HARFetcher", zap.Error(err))
+		hf.Stop()
+		return err
+	}
+	defer file.Close()
+
+	var har harFile
+	if err = json.NewDecoder(file).Decode(&har); err != nil {
+		Logger.Error("failed to decode har file, stop HARFetcher", zap.Error(err))
+		hf.Stop()
+		return err
+	}
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	Logger.Info("loaded har file", zap.String("path", hf.path), zap.String("version", har.Log.Version), zap.Int("entries", len(entries)))
+
+	for _, entry := range entries {
+		if hf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+		if entry.StartedDateTime.After(hf.end) {
+			break
+		}
+		if entry.StartedDateTime.Before(hf.begin) {
+			continue
+		}
+
+		log, err := hf.convert(entry)
+		if err != nil {
+			Logger.Warn("skip bad har entry", zap.String("url", entry.Request.URL), zap.Error(err))
+			continue
+		}
+		if !hf.send(log) {
+			return ErrTaskInterrupted
+		}
+	}
+
+	Logger.Info("finished to fetch har file")
+	hf.Finish()
+	return nil
+}
+
+func (hf *HARFetcher) convert(entry *harEntry) (*LogRecordWrapper, error) {
+	header := map[string]string{}
+	for _, h := range entry.Request.Headers {
+		if strings.HasPrefix(h.Name, ":") || strings.EqualFold(h.Name, "Content-Length") { // 忽略HTTP/2伪头部
+			continue
+		}
+		header[h.Name] = h.Value
+	}
+
+	var body []byte
+	if pd := entry.Request.PostData; pd != nil {
+		switch {
+		case pd.Text != "":
+			b, err := decodeHARText(pd.Text, pd.Encoding)
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		case len(pd.Params) > 0:
+			values := url.Values{}
+			for _, p := range pd.Params {
+				values.Add(p.Name, p.Value)
+			}
+			body = []byte(values.Encode())
+		}
+	}
+
+	log := &LogRecordWrapper{
+		OccurAt: entry.StartedDateTime,
+		LogRecord: &pb.LogRecord{
+			Url:    entry.Request.URL,
+			Method: strings.ToUpper(entry.Request.Method),
+			Header: header,
+			Body:   body,
+		},
+	}
+
+	if hf.keepResponse {
+		resp := &RecordedResponse{Status: entry.Response.Status, Header: map[string]string{}}
+		for _, h := range entry.Response.Headers {
+			resp.Header[h.Name] = h.Value
+		}
+		b, err := decodeHARText(entry.Response.Content.Text, entry.Response.Content.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = b
+		log.Response = resp
+	}
+	return log, nil
+}
+
+func decodeHARText(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+func (hf *HARFetcher) Finish() {
+	hf.baseFetcher.Finish()
+	if hf.parent != nil {
+		hf.parent.Notify(hf, StatusFinished)
+	}
+}
+
+func (hf *HARFetcher) Stop() {
+	hf.baseFetcher.Stop()
+	if hf.parent != nil {
+		hf.parent.Notify(hf, StatusStopped)
+	}
+}
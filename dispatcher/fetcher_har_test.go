@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHAR = `{"log":{"version":"1.2","entries":[
+{"startedDateTime":"2020-11-23T08:00:02.000Z","request":{"method":"post","url":"https://api.example.com/v2/orders","headers":[{"name":":authority","value":"api.example.com"},{"name":"Content-Type","value":"application/json"},{"name":"Content-Length","value":"7"}],"postData":{"mimeType":"application/json","text":"{\"a\":1}"}},"response":{"status":201,"headers":[{"name":"Content-Type","value":"application/json"}],"content":{"text":"eyJvayI6dHJ1ZX0=","encoding":"base64"}}},
+{"startedDateTime":"2020-11-23T08:00:01.000Z","request":{"method":"POST","url":"https://api.example.com/login","headers":[],"postData":{"mimeType":"application/x-www-form-urlencoded","params":[{"name":"user","value":"a b"}]}},"response":{"status":200,"headers":[],"content":{"text":"ok"}}},
+{"startedDateTime":"2020-11-23T09:00:00.000Z","request":{"method":"GET","url":"https://api.example.com/late","headers":[]},"response":{"status":200,"headers":[],"content":{}}}
+]}}`
+
+func TestHARFetcher_Start(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.har")
+	assert.Nil(t, os.WriteFile(path, []byte(testHAR), 0644))
+
+	hf := NewHARFetcher(path).WithResponse(true)
+	begin, _ := parseLogTime("2020-11-23T08:00:00Z")
+	end, _ := parseLogTime("2020-11-23T08:30:00Z")
+	hf.TimeRange(begin, end)
+	output := make(chan *LogRecordWrapper, 10)
+	hf.SetOutput(output)
+	assert.Nil(t, hf.Start())
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		logs = append(logs, log)
+	}
+	assert.Len(t, logs, 2)
+
+	assert.Equal(t, "https://api.example.com/login", logs[0].Url)
+	assert.Equal(t, "user=a+b", string(logs[0].Body))
+
+	assert.Equal(t, "POST", logs[1].Method)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, logs[1].Header)
+	assert.Equal(t, `{"a":1}`, string(logs[1].Body))
+	assert.Equal(t, 201, logs[1].Response.Status)
+	assert.Equal(t, `{"ok":true}`, string(logs[1].Response.Body))
+}
@@ -0,0 +1,238 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/buger/jsonparser"
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// IngestFetcher 推送式的日志收集者，通过/api/ingest接收网关等推送的日志，用于线上流量的实时镜像
+	//
+	// 请求体为JSON数组或者NDJSON，每个元素交由Analyzer解析；缓冲区剩余空间不足以容纳整批日志时返回429，由推送方重试，
+	// 因此回放速度跟不上时不会无限占用内存。任务End<=0时持续接收，直到通过/api/job/stop停止
+	IngestFetcher struct {
+		buffer   chan *LogRecordWrapper
+		mu       sync.Mutex
+		received int64
+		rejected int64
+		invalid  int64
+		*baseFetcher
+	}
+
+	// logRecordJSON LogRecord的JSON格式（body为base64编码），附加日志时间与哈希字段
+	logRecordJSON struct {
+		*pb.LogRecord
+		OccurAt   json.RawMessage `json:"occur_at"`
+		HashField string          `json:"hash_field"`
+	}
+)
+
+var (
+	// IngestBufferSize IngestFetcher缓冲区的默认大小
+	IngestBufferSize = 10000
+	// IngestMaxBodySize 单次推送请求体的最大长度
+	IngestMaxBodySize int64 = 32 << 20
+)
+
+func init() {
+	RegisterAnalyzeFunc("log_record", AnalyzeLogRecordJSON)
+}
+
+// NewIngestFetcher IngestFetcher的构造函数
+func NewIngestFetcher() *IngestFetcher {
+	return &IngestFetcher{
+		buffer:      make(chan *LogRecordWrapper, IngestBufferSize),
+		baseFetcher: newBaseFetcher(),
+	}
+}
+
+// WithBuffer 设置缓冲区大小，须在Start之前调用
+func (ing *IngestFetcher) WithBuffer(size int) *IngestFetcher {
+	if size > 0 {
+		ing.buffer = make(chan *LogRecordWrapper, size)
+	}
+	return ing
+}
+
+// Start 将接收到的日志交给TimeWheel，直到被停止或者收到晚于结束时间的日志
+func (ing *IngestFetcher) Start() error {
+	ing.baseFetcher.start()
+	defer ing.closeOutput()
+	if ing.parent != nil {
+		ing.parent.Notify(ing, StatusRunning)
+	}
+
+	for {
+		select {
+		case <-ing.done:
+			return ErrTaskInterrupted
+		case log := <-ing.buffer:
+			if log.OccurAt.Before(ing.begin) {
+				continue
+			}
+			if log.OccurAt.After(ing.end) {
+				Logger.Info("time of log is later than end time", zap.String("occurAt", log.OccurAt.String()))
+				ing.Finish()
+				return nil
+			}
+			if !ing.send(log) {
+				return ErrTaskInterrupted
+			}
+		}
+	}
+}
+
+func (ing *IngestFetcher) Finish() {
+	ing.baseFetcher.Finish()
+	if ing.parent != nil {
+		ing.parent.Notify(ing, StatusFinished)
+	}
+}
+
+// Stop 停止接收
+func (ing *IngestFetcher) Stop() {
+	ing.baseFetcher.Stop()
+	if ing.parent != nil {
+		ing.parent.Notify(ing, StatusStopped)
+	}
+}
+
+// Provide 实现Provider接口
+func (ing *IngestFetcher) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/ingest",
+			Func: ing.serveIngest,
+		},
+		{
+			Path: "/api/ingest/stats",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderResponse(w, []byte(fmt.Sprintf("{\"code\":200, \"received\": %d, \"rejected\": %d, \"invalid\": %d, \"buffered\": %d}",
+					atomic.LoadInt64(&ing.received), atomic.LoadInt64(&ing.rejected), atomic.LoadInt64(&ing.invalid), len(ing.buffer))), "application/json")
+			},
+		},
+	}
+}
+
+func (ing *IngestFetcher) serveIngest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		renderStatusError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if ing.Status() != StatusRunning {
+		renderStatusError(w, http.StatusServiceUnavailable, errors.New("ingest fetcher is not running"))
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, IngestMaxBodySize))
+	if err != nil {
+		renderStatusError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	var logs []*LogRecordWrapper
+	var invalid int
+	err = splitIngestBody(data, func(item []byte) {
+		if log := ing.analyze(item); log != nil {
+			logs = append(logs, log)
+		} else {
+			invalid++
+		}
+	})
+	if err != nil {
+		renderStatusError(w, http.StatusBadRequest, err)
+		return
+	}
+	atomic.AddInt64(&ing.invalid, int64(invalid))
+
+	// 整批放入缓冲区，避免部分成功导致推送方重试时重复
+	ing.mu.Lock()
+	if cap(ing.buffer)-len(ing.buffer) < len(logs) {
+		ing.mu.Unlock()
+		atomic.AddInt64(&ing.rejected, int64(len(logs)))
+		renderStatusError(w, http.StatusTooManyRequests, errors.New("ingest buffer is full"))
+		return
+	}
+	for _, log := range logs {
+		ing.buffer <- log
+	}
+	ing.mu.Unlock()
+
+	atomic.AddInt64(&ing.received, int64(len(logs)))
+	renderResponse(w, []byte(fmt.Sprintf("{\"code\": 200, \"accepted\": %d, \"invalid\": %d}", len(logs), invalid)), "application/json")
+}
+
+func (ing *IngestFetcher) analyze(data []byte) *LogRecordWrapper {
+	if ing.analyzer == nil {
+		if log, ok := AnalyzeLogRecordJSON(data); ok {
+			return log
+		}
+		return nil
+	}
+	return ing.analyzer.Analyze(data)
+}
+
+// splitIngestBody 将JSON数组或者NDJSON拆分为单条日志
+func splitIngestBody(data []byte, f func([]byte)) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var err error
+		_, perr := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, e error) {
+			if e != nil {
+				err = e
+				return
+			}
+			f(value)
+		})
+		if perr != nil {
+			return perr
+		}
+		return err
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			f(line)
+		}
+	}
+	return nil
+}
+
+// AnalyzeLogRecordJSON 解析LogRecord的JSON格式，如{"url": "...", "method": "POST", "header": {}, "body": "base64", "occur_at": 1532058494000}
+//
+// occur_at可以是时间戳或者带时区的时间字符串，缺失时使用当前时间，用于实时推送的场景
+func AnalyzeLogRecordJSON(data []byte) (*LogRecordWrapper, bool) {
+	var record logRecordJSON
+	if err := json.Unmarshal(data, &record); err != nil || record.LogRecord == nil || record.Url == "" {
+		return nil, false
+	}
+	if record.Method == "" {
+		record.Method = "GET"
+	}
+
+	at := time.Now()
+	if len(record.OccurAt) > 0 {
+		s := string(record.OccurAt)
+		if record.OccurAt[0] == '"' {
+			if err := json.Unmarshal(record.OccurAt, &s); err != nil {
+				return nil, false
+			}
+		}
+		var ok bool
+		if at, ok = parseLogTime(s); !ok {
+			return nil, false
+		}
+	}
+	return &LogRecordWrapper{HashField: record.HashField, OccurAt: at, LogRecord: record.LogRecord}, true
+}
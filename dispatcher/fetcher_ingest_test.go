@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postIngest(ing *IngestFetcher, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ing.serveIngest(w, httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body)))
+	return w
+}
+
+func TestAnalyzeLogRecordJSON(t *testing.T) {
+	log, ok := AnalyzeLogRecordJSON([]byte(`{"url":"http://a.com/x","method":"POST","header":{"X-A":"1"},"body":"aGVsbG8=","occur_at":1532058494123,"hash_field":"u1"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "http://a.com/x", log.Url)
+	assert.Equal(t, map[string]string{"X-A": "1"}, log.Header)
+	assert.Equal(t, "hello", string(log.Body))
+	assert.Equal(t, "u1", log.HashField)
+	assert.Equal(t, ParseMSec(1532058494123), log.OccurAt)
+
+	log, ok = AnalyzeLogRecordJSON([]byte(`{"url":"http://a.com/y","occur_at":"2018-07-20T03:48:14Z"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "GET", log.Method)
+	assert.Equal(t, time.Date(2018, 7, 20, 3, 48, 14, 0, time.UTC), log.OccurAt.UTC())
+
+	log, ok = AnalyzeLogRecordJSON([]byte(`{"url":"http://a.com/z"}`))
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), log.OccurAt, time.Second)
+
+	for _, bad := range []string{`{}`, `{"url":"http://a.com","occur_at":"yesterday"}`, `not json`} {
+		_, ok = AnalyzeLogRecordJSON([]byte(bad))
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestIngestFetcher_Backpressure(t *testing.T) {
+	ing := NewIngestFetcher().WithBuffer(3)
+	assert.Equal(t, http.StatusServiceUnavailable, postIngest(ing, `{"url":"http://a.com"}`).Code)
+
+	ing.baseFetcher.start() // 不消费缓冲区
+	w := postIngest(ing, "{\"url\":\"http://a.com/1\"}\n\nbad\n{\"url\":\"http://a.com/2\"}\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"accepted": 2, "invalid": 1`)
+
+	assert.Equal(t, http.StatusTooManyRequests, postIngest(ing, `[{"url":"http://a.com/3"},{"url":"http://a.com/4"}]`).Code)
+	assert.Equal(t, http.StatusOK, postIngest(ing, `[{"url":"http://a.com/3"}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, postIngest(ing, `[{"url":`).Code)
+	assert.Len(t, ing.buffer, 3)
+	assert.Equal(t, int64(2), ing.rejected)
+}
+
+func TestIngestFetcher_Start(t *testing.T) {
+	ing := NewIngestFetcher()
+	ing.TimeRange(ParseMSec(1532058494000), parseJobEnd(0))
+	output := make(chan *LogRecordWrapper)
+	ing.SetOutput(output)
+	done := make(chan error)
+	go func() { done <- ing.Start() }()
+
+	for ing.Status() != StatusRunning {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, http.StatusOK, postIngest(ing, `[{"url":"http://a.com/old","occur_at":1532058493000},{"url":"http://a.com/new","occur_at":1532058495000}]`).Code)
+	log := <-output
+	assert.Equal(t, "http://a.com/new", log.Url)
+
+	ing.Stop()
+	assert.Equal(t, ErrTaskInterrupted, <-done)
+	_, ok := <-output
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, postIngest(ing, `{"url":"http://a.com"}`).Code)
+}
@@ -2,7 +2,10 @@ package dispatcher
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,214 +15,409 @@ import (
 )
 
 type (
-	PartitionLogRecord struct {
-		*LogRecordWrapper
-		PID      int
-		Previous *PartitionLogRecord
-		Next     *PartitionLogRecord
+	// KafkaFetcher kafka日志收集者，同时读取topic下所有partition，按OccurAt归并后交给TimeWheel
+	KafkaFetcher struct {
+		*baseFetcher
+		brokers    []string
+		topic      string
+		partitions []int
+		buffer     int
+		cancel     context.CancelFunc
+		cursors    map[string]int64
+		counter    int64
+		qps        int64
+		newReader  func(partition int) kafkaReader
+		kafkaMessageOptions
 	}
 
-	SortedLogRecords struct {
-		gate        *gateMan
-		len         int32
-		count       int32
-		firstRecord *PartitionLogRecord
-		mu          sync.RWMutex
+	// kafkaReader 读取单个partition所需的方法，由kafka.Reader实现
+	kafkaReader interface {
+		SetOffset(offset int64) error
+		ReadMessage(ctx context.Context) (kafka.Message, error)
+		Close() error
 	}
 
-	gateMan struct {
-		gates  map[int]chan struct{}
-		inputs map[int]chan *LogRecordWrapper
-		slr    *SortedLogRecords
-		count  int32
+	// kafkaMessageOptions 消息元数据的使用方式，KafkaFetcher与KafkaSinglePartitionFetcher共用
+	kafkaMessageOptions struct {
+		envelope bool
+		keyHash  bool
 	}
 
-	GateManV2 struct {
-		gates  map[int]chan struct{}
-		inputs map[int]chan *LogRecordWrapper
-		first  *PartitionLogRecord
-		count  int32
-		mu     sync.RWMutex
+	// kafkaEnvelope 开启envelope时交给Analyzer的JSON，消息体是合法的JSON时原样嵌入value，否则作为字符串，
+	// 可以在FieldMapping中使用key、headers.X-Trace-Id、timestamp、value.request.path等路径
+	kafkaEnvelope struct {
+		Key       string            `json:"key"`
+		Headers   map[string]string `json:"headers,omitempty"`
+		Timestamp int64             `json:"timestamp"` // 消息时间，毫秒
+		Partition int               `json:"partition"`
+		Offset    int64             `json:"offset"`
+		Value     json.RawMessage   `json:"value"`
 	}
 
-	// KafkaFetcher kafka日志收集者
-	KafkaFetcher struct {
-		*baseFetcher
-		brokers     []string
-		topic       string
-		wg          sync.WaitGroup
-		offsetStart int
-		offsetEnd   int
-		buffer      map[int]*LogRecordWrapper
-		counter     int64
-		qps         int64
+	// partitionRange 单个partition需要读取的offset区间，last为-1时表示不设上限
+	partitionRange struct {
+		partition int
+		first     int64
+		last      int64
 	}
 )
 
-func newGateman() *gateMan {
-	return &gateMan{gates: make(map[int]chan struct{}), inputs: make(map[int]chan *LogRecordWrapper)}
+var (
+	// KafkaPartitionBuffer 每个partition预读取的日志条数
+	KafkaPartitionBuffer = 100
+	// KafkaOffsetLookBack 根据任务开始时间查找offset时向前多读取的时间，用于容忍日志时间与消息写入时间的偏差
+	KafkaOffsetLookBack = 10 * time.Second
+	// KafkaIdleTimeout 持续读取新消息时，partition超过该时间没有新消息则发出水位（当前时间减去该值），
+	// 避免空闲的partition阻塞其他partition的归并；之后到达的更早的日志会晚于其他partition的日志发出
+	KafkaIdleTimeout = 3 * time.Second
+)
+
+// NewKafkaFetcher KafkaFetcher的构造函数
+func NewKafkaFetcher(brokers []string, topic string) (*KafkaFetcher, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("empty broker")
+	}
+
+	ps, err := kafka.DefaultDialer.LookupPartitions(context.Background(), "tcp", brokers[0], topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("no partition found in topic " + topic)
+	}
+	Logger.Info("look up partitions of topic", zap.String("topic", topic), zap.Int("partition_count", len(ps)), zap.String("broker", brokers[0]))
+
+	fetcher := &KafkaFetcher{
+		baseFetcher: newBaseFetcher(),
+		brokers:     brokers,
+		topic:       topic,
+		buffer:      KafkaPartitionBuffer,
+	}
+	for _, p := range ps {
+		fetcher.partitions = append(fetcher.partitions, p.ID)
+	}
+	fetcher.newReader = fetcher.openReader
+	return fetcher, nil
 }
 
-func (gm *gateMan) register(p int, input chan *LogRecordWrapper) {
-	gm.inputs[p] = input
-	gm.gates[p] = make(chan struct{}, 1)
+func (kf *KafkaFetcher) openReader(partition int) kafkaReader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   kf.brokers,
+		Topic:     kf.topic,
+		Partition: partition,
+		MinBytes:  10e3,
+		MaxBytes:  10e6,
+	})
+}
 
-	go func(p int, c1 chan struct{}, c2 chan *LogRecordWrapper) {
-		atomic.AddInt32(&gm.count, 1)
-		for msg := range c2 {
-			c1 <- struct{}{}
-			gm.slr.Push(&PartitionLogRecord{LogRecordWrapper: msg, PID: p})
-		}
-		close(c1)
-		atomic.AddInt32(&gm.count, -1)
-	}(p, gm.gates[p], gm.inputs[p])
+// Resume 从断点记录的各partition的offset继续读取，实现Checkpointer
+func (kf *KafkaFetcher) Resume(cursors map[string]int64) error {
+	kf.cursors = cursors
+	return nil
 }
 
-func (gm *gateMan) open(p int) {
-	<-gm.gates[p]
+// WithEnvelope 将消息的key、headers、timestamp连同消息体封装为JSON交给Analyzer，见kafkaEnvelope
+func (kf *KafkaFetcher) WithEnvelope(enabled bool) *KafkaFetcher {
+	kf.envelope = enabled
+	return kf
 }
 
-func (gm *gateMan) gateCount() int {
-	return int(atomic.LoadInt32(&gm.count))
+// WithKeyHash 消息key不为空时作为HashField，使同一个key的请求由同一个replayer回放
+func (kf *KafkaFetcher) WithKeyHash(enabled bool) *KafkaFetcher {
+	kf.keyHash = enabled
+	return kf
 }
 
-func (s *SortedLogRecords) Push(p *PartitionLogRecord) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.count++
+// source 断点中partition的名称，如topic-0
+func (kf *KafkaFetcher) source(partition int) string {
+	return fmt.Sprintf("%s-%d", kf.topic, partition)
+}
 
-	// 首次压栈
-	if s.firstRecord == nil {
-		s.firstRecord = p
-		return
+// locate 根据任务开始时间确定partition的起始offset，回放历史数据时以当前最新offset作为终点
+func (kf *KafkaFetcher) locate(ctx context.Context, partition int) (*partitionRange, error) {
+	var conn *kafka.Conn
+	var err error
+	for _, broker := range kf.brokers {
+		conn, err = kafka.DialLeader(ctx, "tcp", broker, kf.topic, partition)
+		if err == nil {
+			break
+		}
 	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
-	o := s.firstRecord
-	if o.OccurAt.After(p.OccurAt) {
-		s.firstRecord = p
-		p.Next = o
-		o.Previous = p
-		return
+	last, err := conn.ReadLastOffset()
+	if err != nil {
+		return nil, err
+	}
+	first, err := conn.ReadOffset(kf.begin.Add(-KafkaOffsetLookBack))
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 { // 不存在晚于开始时间的消息
+		first = last
+	}
+	if cursor, ok := kf.cursors[kf.source(partition)]; ok && cursor >= 0 && cursor <= last {
+		Logger.Info("resume partition from checkpoint", zap.Int("partition", partition), zap.Int64("offset", cursor))
+		first = cursor
 	}
 
-	o = s.firstRecord.Next
+	pr := &partitionRange{partition: partition, first: first, last: last}
+	if kf.end.After(time.Now()) { // 任务结束时间未到，需要持续读取新消息
+		pr.last = -1
+	}
+	return pr, nil
+}
+
+// Start 每个partition独立读取、解析日志，再按OccurAt做k路归并，保证交给TimeWheel的日志有序
+func (kf *KafkaFetcher) Start() error {
+	kf.baseFetcher.start()
+	defer kf.closeOutput()
+	if kf.parent != nil {
+		kf.parent.Notify(kf, StatusRunning)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	kf.cancel = cancel
+
+	go func() {
+		var last int64
+		var current int64
+		for kf.Status() == StatusRunning {
+			time.Sleep(time.Second)
+			current = atomic.LoadInt64(&kf.counter)
+			kf.qps = current - last
+			last = current
+			Logger.Info("KafkaFetcher QPS", zap.Int64("fetcher_qps", kf.qps), zap.Int64("counter", last))
+		}
+	}()
+
 	for {
-		if o.OccurAt.After(p.OccurAt) {
-			o.Previous.Next = p
-			p.Previous = o.Previous
-			p.Next = o
-			o.Previous = p
-			return
+		if err := kf.scan(ctx); err != nil && err != errSeekPending {
+			return err
 		}
-		if o.Next == nil {
+		if !kf.applySeek(true) {
 			break
 		}
-		o = o.Next
+		kf.cursors = nil // 重新定位后按时间查找offset，不再使用断点
 	}
-	o.Next = p
-	p.Previous = o
+
+	Logger.Info("all partitions have passed end time, finish fetching from kafka", zap.String("topic", kf.topic))
+	cancel()
+	kf.Finish()
+	return nil
 }
 
-func (s *SortedLogRecords) Pop() (*LogRecordWrapper, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.count--
+// Seek 根据日志时间at重新查找各partition的offset并读取，实现Seeker
+func (kf *KafkaFetcher) Seek(at time.Time, epoch int64) error {
+	return kf.requestSeek(at, epoch)
+}
 
-	if s.firstRecord == nil {
-		return nil, errors.New("<nil>")
+// scan 从开始时间（或者断点）定位各partition并归并读取，收到重新定位请求时返回errSeekPending
+func (kf *KafkaFetcher) scan(ctx context.Context) error {
+	var ranges []*partitionRange
+	for _, p := range kf.partitions {
+		pr, err := kf.locate(ctx, p)
+		if err != nil {
+			Logger.Error("failed to locate offset of partition, stop KafkaFetcher", zap.Int("partition", p), zap.Error(err))
+			kf.Stop()
+			return err
+		}
+		Logger.Info("located offsets of partition", zap.Int("partition", p), zap.Int64("first", pr.first), zap.Int64("last", pr.last))
+		ranges = append(ranges, pr)
 	}
-
-	f := s.firstRecord
-	s.firstRecord = f.Next
-	s.firstRecord.Previous = nil
-	s.gate.open(f.PID)
-	return f.LogRecordWrapper, nil
+	return kf.merge(ctx, ranges)
 }
 
-func (gm *GateManV2) Register(p int, input chan *LogRecordWrapper) {
-	gm.inputs[p] = input
-	gm.gates[p] = make(chan struct{}, 1)
-	atomic.AddInt32(&gm.count, 1)
+// merge 并发读取各partition并按OccurAt归并，任一partition读取出错时停止KafkaFetcher并返回error
+//
+// 归并假设每个partition内的日志按OccurAt有序，partition内乱序的日志原样输出，需要配合ReorderStage使用
+func (kf *KafkaFetcher) merge(parent context.Context, ranges []*partitionRange) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	var failure error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
 
-	go func(pid int) {
-		for msg := range gm.inputs[pid] {
-			gm.gates[pid] <- struct{}{}
+	sources := make([]<-chan *LogRecordWrapper, len(ranges))
+	for i, pr := range ranges {
+		c := make(chan *LogRecordWrapper, kf.buffer)
+		sources[i] = c
+		go kf.read(ctx, pr, c, fail)
+	}
 
-			// todo:
-			gm.Push(&PartitionLogRecord{LogRecordWrapper: msg, PID: pid})
+	completed := mergeSorted(sources, func(log *LogRecordWrapper) bool {
+		if ctx.Err() != nil || kf.Status() == StatusStopped || kf.seekPending() {
+			return false
 		}
-		atomic.AddInt32(&gm.count, -1)
-		close(gm.gates[pid])
-		delete(gm.inputs, pid)
-		delete(gm.gates, pid)
-	}(p)
-}
-
-func (gm *GateManV2) Push(p *PartitionLogRecord) {
-
-}
+		if log.watermark {
+			return true
+		}
+		log.epoch = kf.epoch
+		return kf.send(log)
+	})
+	cancel()
+	for _, src := range sources { // 等待各partition的reader关闭
+		for range src {
+		}
+	}
 
-func (gm *GateManV2) Pop() *LogRecordWrapper {
-	return nil
+	switch {
+	case failure != nil: // 出错的partition提前关闭，不能视为读取完毕
+		Logger.Error("failed to read messages from kafka, stop KafkaFetcher", zap.Error(failure))
+		kf.Stop()
+		return failure
+	case completed:
+		return nil
+	case kf.Status() == StatusStopped || parent.Err() != nil:
+		return ErrTaskInterrupted
+	}
+	return errSeekPending
 }
 
-func NewKafkaFetcher(brokers []string, topic string, start, end int) (*KafkaFetcher, error) {
-	if len(brokers) == 0 {
-		return nil, errors.New("empty broker")
+// read 读取单个partition，日志时间超过任务结束时间、或者读到回放终点时关闭输出管道；读取出错时调用fail后关闭
+//
+// 持续读取新消息时，超过KafkaIdleTimeout没有新消息则输出水位，见KafkaIdleTimeout
+func (kf *KafkaFetcher) read(ctx context.Context, pr *partitionRange, output chan<- *LogRecordWrapper, fail func(error)) {
+	defer close(output)
+	if pr.last >= 0 && pr.first >= pr.last {
+		Logger.Info("no message to read from partition", zap.Int("partition", pr.partition))
+		return
 	}
 
-	ps, err := kafka.DefaultDialer.LookupPartitions(context.Background(), "tcp", brokers[0], topic)
-	if err != nil {
-		return nil, err
+	reader := kf.newReader(pr.partition)
+	defer reader.Close()
+	if err := reader.SetOffset(pr.first); err != nil {
+		fail(fmt.Errorf("failed to set offset %d of partition %d: %w", pr.first, pr.partition, err))
+		return
 	}
-	Logger.Info("loop up partitions of topic", zap.String("topic", topic), zap.Int("partition_count", len(ps)), zap.String("broker", brokers[0]))
+	Logger.Info("start to read message from partition", zap.Int("partition", pr.partition), zap.String("topic", kf.topic))
 
-	fetcher := &KafkaFetcher{
-		baseFetcher: newBaseFetcher(),
-		brokers:     brokers,
-		topic:       topic,
-		offsetStart: start,
-		offsetEnd:   end,
-		buffer:      make(map[int]*LogRecordWrapper),
-	}
-
-	for _, partition := range ps {
-		fetcher.wg.Add(1)
-		go func(p kafka.Partition) {
-			defer fetcher.wg.Done()
-
-			reader := kafka.NewReader(kafka.ReaderConfig{
-				Brokers:   fetcher.brokers,
-				Topic:     fetcher.topic,
-				Partition: p.ID,
-				MinBytes:  10e3,
-				MaxBytes:  10e6,
-			})
-			reader.SetOffset(kafka.FirstOffset)
-			Logger.Info("start to read message from partition", zap.Int("partition", p.ID), zap.String("topic", fetcher.topic))
-			for {
-				_, err := reader.ReadMessage(context.Background())
-				if err != nil {
-					Logger.Error("occur error when reading messages from kafka", zap.Error(err), zap.Int("partition", p.ID))
-					break
+	live := pr.last < 0
+	var last time.Time // 最后输出的日志时间或者水位
+	for {
+		readCtx, cancelRead := ctx, context.CancelFunc(func() {})
+		if live {
+			readCtx, cancelRead = context.WithTimeout(ctx, KafkaIdleTimeout)
+		}
+		msg, err := reader.ReadMessage(readCtx)
+		cancelRead()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if live && errors.Is(err, context.DeadlineExceeded) {
+				if wm := time.Now().Add(-KafkaIdleTimeout); wm.After(last) {
+					last = wm
+				}
+				select {
+				case output <- &LogRecordWrapper{OccurAt: last, watermark: true}:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			fail(fmt.Errorf("failed to read message from partition %d: %w", pr.partition, err))
+			return
+		}
+		atomic.AddInt64(&kf.counter, 1)
+
+		if kf.analyzer != nil {
+			if log := kf.analyze(kf.analyzer, msg); log != nil {
+				if log.OccurAt.After(kf.end) {
+					Logger.Info("time of log record is later than end time, partition is finished",
+						zap.Int("partition", pr.partition), zap.Time("occurAt", log.OccurAt), zap.Time("end", kf.end))
+					return
+				}
+				if !log.OccurAt.Before(kf.begin) {
+					if log.OccurAt.After(last) {
+						last = log.OccurAt
+					}
+					log.cursor = &sourceCursor{source: kf.source(pr.partition), offset: msg.Offset + 1}
+					select {
+					case output <- log:
+					case <-ctx.Done():
+						return
+					}
 				}
-				atomic.AddInt64(&fetcher.counter, 1)
 			}
-			Logger.Warn("quit for loop")
-		}(partition)
+		}
+
+		if pr.last >= 0 && msg.Offset >= pr.last-1 {
+			Logger.Info("reached the last offset of partition", zap.Int("partition", pr.partition), zap.Int64("offset", msg.Offset))
+			return
+		}
 	}
+}
 
-	go func() {
-		var last = fetcher.counter
-		var current int64
-		for {
-			time.Sleep(1 * time.Second)
-			current = atomic.LoadInt64(&fetcher.counter)
-			fetcher.qps = current - last
-			last = current
-			Logger.Info("KafkaFetcher QPS", zap.Int64("fetcher_qps", fetcher.qps), zap.Int64("counter", last))
+// analyze 解析消息，开启keyHash时使用消息key作为HashField
+func (o kafkaMessageOptions) analyze(analyzer Analyzer, msg kafka.Message) *LogRecordWrapper {
+	data := msg.Value
+	if o.envelope {
+		data = encodeKafkaEnvelope(msg)
+	}
+	log := analyzer.Analyze(data)
+	if log == nil {
+		return nil
+	}
+	if o.keyHash && len(msg.Key) > 0 {
+		log.HashField = string(msg.Key)
+	}
+	return log
+}
+
+func encodeKafkaEnvelope(msg kafka.Message) []byte {
+	env := &kafkaEnvelope{
+		Key:       string(msg.Key),
+		Timestamp: msg.Time.UnixNano() / 1e6,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Value:     msg.Value,
+	}
+	if len(msg.Headers) > 0 {
+		env.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			env.Headers[h.Key] = string(h.Value)
 		}
-	}()
+	}
+	if !json.Valid(msg.Value) {
+		env.Value, _ = json.Marshal(string(msg.Value))
+	}
+	data, _ := json.Marshal(env)
+	return data
+}
 
-	return fetcher, nil
+func (kf *KafkaFetcher) Finish() {
+	kf.baseFetcher.Finish()
+	if kf.parent != nil {
+		kf.parent.Notify(kf, StatusFinished)
+	}
+}
+
+func (kf *KafkaFetcher) Stop() {
+	if kf.cancel != nil {
+		kf.cancel()
+	}
+	kf.baseFetcher.Stop()
+	if kf.parent != nil {
+		kf.parent.Notify(kf, StatusStopped)
+	}
+}
+
+func (kf *KafkaFetcher) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/kafka/qps",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderResponse(w, []byte(fmt.Sprintf("{\"code\":200, \"kafka_qps\": \"%d\", \"total\": \"%d\", \"partitions\": %d}", kf.qps, atomic.LoadInt64(&kf.counter), len(kf.partitions))), "application/json")
+			},
+		},
+	}
 }
@@ -0,0 +1,166 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestKafkaMessageOptions_Analyze(t *testing.T) {
+	msg := kafka.Message{
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("user-1"),
+		Value:     []byte(`{"request":{"host":"api.example.com","path":"/orders"}}`),
+		Headers:   []kafka.Header{{Key: "X-Trace-Id", Value: []byte("t1")}},
+		Time:      time.Unix(1606118400, 5e8),
+	}
+
+	// 消息体中没有时间与hash字段，从envelope中的消息元数据获取
+	ja, err := NewJSONAnalyzer(&FieldMapping{
+		Host:          "value.request.host",
+		Path:          "value.request.path",
+		Headers:       "headers",
+		Timestamp:     "timestamp",
+		TimestampUnit: "ms",
+		HashField:     "key",
+	})
+	assert.Nil(t, err)
+	log := kafkaMessageOptions{envelope: true}.analyze(ja, msg)
+	assert.NotNil(t, log)
+	assert.Equal(t, "http://api.example.com/orders", log.Url)
+	assert.Equal(t, "user-1", log.HashField)
+	assert.Equal(t, "t1", log.Header["X-Trace-Id"])
+	assert.True(t, msg.Time.Equal(log.OccurAt))
+
+	// 消息体不是JSON时作为字符串
+	assert.Equal(t, `{"key":"","timestamp":1606118400500,"partition":0,"offset":0,"value":"GET /a"}`,
+		string(encodeKafkaEnvelope(kafka.Message{Value: []byte("GET /a"), Time: msg.Time})))
+
+	// 不使用envelope时，keyHash覆盖HashField
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(func(data []byte) (*LogRecordWrapper, bool) {
+		return &LogRecordWrapper{HashField: "payload", OccurAt: msg.Time, LogRecord: &pb.LogRecord{Url: string(data)}}, true
+	})
+	assert.Equal(t, "user-1", kafkaMessageOptions{keyHash: true}.analyze(analyzer, msg).HashField)
+	assert.Equal(t, "payload", kafkaMessageOptions{}.analyze(analyzer, msg).HashField)
+}
+
+// fakeKafkaReader 按offset返回预置的消息，消息读完之后返回err，err为nil时一直等待到ctx结束
+type fakeKafkaReader struct {
+	values    []string
+	offset    int64
+	err       error
+	offsetErr error
+}
+
+func (r *fakeKafkaReader) SetOffset(offset int64) error {
+	r.offset = offset
+	return r.offsetErr
+}
+
+func (r *fakeKafkaReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if r.offset < int64(len(r.values)) {
+		r.offset++
+		return kafka.Message{Offset: r.offset - 1, Value: []byte(r.values[r.offset-1])}, nil
+	}
+	if r.err != nil {
+		return kafka.Message{}, r.err
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeKafkaReader) Close() error {
+	return nil
+}
+
+func newTestKafkaFetcher(readers ...*fakeKafkaReader) (*KafkaFetcher, []*partitionRange, chan *LogRecordWrapper) {
+	kf := &KafkaFetcher{baseFetcher: newBaseFetcher(), topic: "access", buffer: 10}
+	kf.newReader = func(partition int) kafkaReader { return readers[partition] }
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	kf.WithAnalyzer(analyzer)
+	kf.TimeRange(ParseMSec(1000), ParseMSec(10000))
+	output := make(chan *LogRecordWrapper, 100)
+	kf.SetOutput(output)
+	kf.baseFetcher.start()
+
+	var ranges []*partitionRange
+	for i, r := range readers {
+		ranges = append(ranges, &partitionRange{partition: i, last: int64(len(r.values))})
+	}
+	return kf, ranges, output
+}
+
+func TestKafkaFetcher_Merge(t *testing.T) {
+	kf, ranges, output := newTestKafkaFetcher(
+		&fakeKafkaReader{values: []string{"500 /a0", "1000 /a1", "3000 /a3", "12000 /a12", "13000 /a13"}},
+		&fakeKafkaReader{values: []string{"2000 /b2", "4000 /b4"}},
+		&fakeKafkaReader{},
+	)
+	ranges[0].last = 10 // 超过结束时间的日志之后不再读取
+	assert.Nil(t, kf.merge(context.Background(), ranges))
+	close(output)
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		logs = append(logs, log)
+	}
+	assert.Equal(t, []int64{1000, 2000, 3000, 4000}, occurAtMSec(logs))
+	assert.Equal(t, "access-0", logs[0].cursor.source)
+	assert.EqualValues(t, 2, logs[0].cursor.offset)
+}
+
+func TestKafkaFetcher_MergeIdle(t *testing.T) {
+	defer func(timeout time.Duration) { KafkaIdleTimeout = timeout }(KafkaIdleTimeout)
+	KafkaIdleTimeout = 20 * time.Millisecond
+
+	// 持续读取时，空闲的partition不阻塞其他partition
+	kf, ranges, output := newTestKafkaFetcher(
+		&fakeKafkaReader{values: []string{"1000 /a1", "2000 /a2"}},
+		&fakeKafkaReader{},
+	)
+	for _, pr := range ranges {
+		pr.last = -1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- kf.merge(ctx, ranges) }()
+
+	for _, ms := range []int64{1000, 2000} {
+		select {
+		case log := <-output:
+			assert.EqualValues(t, ms, log.OccurAt.UnixNano()/1e6)
+		case <-time.After(time.Second):
+			t.Fatal("idle partition blocks the merge")
+		}
+	}
+	cancel()
+	assert.Equal(t, ErrTaskInterrupted, <-done)
+}
+
+func TestKafkaFetcher_MergeError(t *testing.T) {
+	broken := errors.New("broker is unavailable")
+	kf, ranges, output := newTestKafkaFetcher(
+		&fakeKafkaReader{values: []string{"1000 /a1"}, err: broken},
+		&fakeKafkaReader{values: []string{"2000 /b2", "3000 /b3"}},
+	)
+	ranges[0].last = 10
+	// partition读取出错时不能当作读取完毕
+	assert.ErrorIs(t, kf.merge(context.Background(), ranges), broken)
+	assert.Equal(t, StatusStopped, kf.Status())
+	// 输出管道由Start退出时关闭
+	kf.closeOutput()
+	for range output {
+	}
+
+	kf, ranges, _ = newTestKafkaFetcher(&fakeKafkaReader{values: []string{"1000 /a1"}, offsetErr: broken})
+	assert.ErrorIs(t, kf.merge(context.Background(), ranges), broken)
+	assert.Equal(t, StatusStopped, kf.Status())
+}
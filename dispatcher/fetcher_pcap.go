@@ -0,0 +1,452 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// PCAPFetcher tcpdump抓包文件（pcap/pcapng）收集者，用于没有请求日志的服务
+	//
+	// 按TCP流重组数据后解析HTTP/1.x请求（支持keep-alive、pipeline以及chunked请求体），请求首个字节所在数据包的时间作为OccurAt。
+	// 不依赖Analyzer，HTTPS流量无法解析
+	PCAPFetcher struct {
+		path   string
+		filter packetFilter
+		scheme string
+		*baseFetcher
+	}
+
+	// tcpAssembler 按抓包时间顺序重组TCP流，解析出的请求在低水位之前按OccurAt排序输出
+	tcpAssembler struct {
+		streams   map[streamKey]*tcpStream
+		scheme    string
+		ready     recordHeap
+		sequence  int
+		requests  int
+		malformed int
+	}
+
+	streamKey struct {
+		src, dst         [16]byte
+		srcPort, dstPort uint16
+	}
+
+	// tcpStream 单向的TCP数据流，只重组客户端到服务端方向中以HTTP方法开头的数据
+	tcpStream struct {
+		dst      string
+		synced   bool
+		nextSeq  uint32
+		buf      []byte
+		marks    []streamMark
+		pending  []*tcpPacket // 乱序到达的数据包
+		lastSeen time.Time
+		hdrEnd   int // 当前请求头的结束位置，0表示尚未找到
+		scanned  int // 已经查找过的位置，避免大请求反复扫描
+	}
+
+	// streamMark 记录缓冲区中每一段数据对应的抓包时间
+	streamMark struct {
+		offset int
+		ts     time.Time
+	}
+)
+
+var (
+	// PCAPStreamTimeout TCP流超过该时间（抓包时间）没有数据包则丢弃未完成的请求
+	PCAPStreamTimeout = 2 * time.Minute
+	// PCAPMaxOutOfOrder 每个TCP流最多缓存的乱序数据包，超过时视为丢包并重新同步
+	PCAPMaxOutOfOrder = 1024
+	// PCAPMaxHeaderSize 请求头的最大长度，超过时视为非HTTP数据
+	PCAPMaxHeaderSize = 1 << 20
+
+	httpMethods = []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH", "TRACE", "CONNECT"}
+
+	errMalformedRequest = errors.New("malformed http request")
+)
+
+// NewPCAPFetcher PCAPFetcher的构造函数，filter为类BPF语法的过滤表达式，如"tcp port 8080 and dst host 10.0.0.1"
+func NewPCAPFetcher(path, filter string) (*PCAPFetcher, error) {
+	f, err := compilePacketFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &PCAPFetcher{path: path, filter: f, scheme: "http", baseFetcher: newBaseFetcher()}, nil
+}
+
+// WithScheme 设置回放时使用的scheme，默认为http
+func (pf *PCAPFetcher) WithScheme(scheme string) *PCAPFetcher {
+	if scheme != "" {
+		pf.scheme = scheme
+	}
+	return pf
+}
+
+// Start 顺序读取抓包文件并重组请求
+func (pf *PCAPFetcher) Start() error {
+	pf.baseFetcher.start()
+	defer pf.closeOutput()
+	if pf.parent != nil {
+		pf.parent.Notify(pf, StatusRunning)
+	}
+
+	file, err := openLogFile(pf.path)
+	if err != nil {
+		Logger.Error("failed to open capture file, stop PCAPFetcher", zap.Error(err))
+		pf.Stop()
+		return err
+	}
+	defer file.Close()
+
+	src, err := newPacketSource(file)
+	if err != nil {
+		Logger.Error("failed to read capture file, stop PCAPFetcher", zap.Error(err))
+		pf.Stop()
+		return err
+	}
+
+	asm := newTCPAssembler(pf.scheme)
+	emit := func(log *LogRecordWrapper) bool {
+		if pf.Status() == StatusStopped {
+			return false
+		}
+		if !log.OccurAt.Before(pf.begin) && !log.OccurAt.After(pf.end) {
+			return pf.send(log)
+		}
+		return true
+	}
+	deadline := pf.end.Add(PCAPStreamTimeout)
+
+	for packets := 1; ; packets++ {
+		if pf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+		p, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			Logger.Error("failed to read capture file, stop PCAPFetcher", zap.Error(err))
+			pf.Stop()
+			return err
+		}
+		tp, ok := decodeTCP(p)
+		if !ok || !pf.filter(tp) {
+			continue
+		}
+		if tp.ts.After(deadline) {
+			break
+		}
+
+		asm.feed(tp)
+		if packets%1024 == 0 {
+			asm.expire(tp.ts)
+		}
+		if asm.ready.Len() > 0 && packets%256 == 0 && !asm.release(asm.watermark(tp.ts), emit) {
+			return ErrTaskInterrupted
+		}
+	}
+
+	if !asm.flush(emit) {
+		return ErrTaskInterrupted
+	}
+	Logger.Info("finished to fetch capture file", zap.Int("requests", asm.requests), zap.Int("malformed", asm.malformed))
+	pf.Finish()
+	return nil
+}
+
+func (pf *PCAPFetcher) Finish() {
+	pf.baseFetcher.Finish()
+	if pf.parent != nil {
+		pf.parent.Notify(pf, StatusFinished)
+	}
+}
+
+func (pf *PCAPFetcher) Stop() {
+	pf.baseFetcher.Stop()
+	if pf.parent != nil {
+		pf.parent.Notify(pf, StatusStopped)
+	}
+}
+
+func newTCPAssembler(scheme string) *tcpAssembler {
+	return &tcpAssembler{streams: map[streamKey]*tcpStream{}, scheme: scheme}
+}
+
+func (ta *tcpAssembler) feed(tp *tcpPacket) {
+	var key streamKey
+	copy(key.src[:], tp.src.To16())
+	copy(key.dst[:], tp.dst.To16())
+	key.srcPort, key.dstPort = tp.srcPort, tp.dstPort
+
+	s, ok := ta.streams[key]
+	if tp.syn || !ok {
+		if !tp.syn && !isRequestStart(tp.payload) {
+			return
+		}
+		// 新建连接，或者抓包开始时连接已经建立，从请求的开头同步
+		s = &tcpStream{dst: net.JoinHostPort(tp.dst.String(), strconv.Itoa(int(tp.dstPort)))}
+		ta.streams[key] = s
+	}
+	s.lastSeen = tp.ts
+
+	switch {
+	case tp.syn:
+		s.synced, s.nextSeq = true, tp.seq+1
+	case !s.synced:
+		if isRequestStart(tp.payload) {
+			s.synced, s.nextSeq = true, tp.seq
+		}
+	}
+
+	if s.synced && len(tp.payload) > 0 {
+		if int32(tp.seq-s.nextSeq) > 0 {
+			s.pending = append(s.pending, tp)
+			if len(s.pending) > PCAPMaxOutOfOrder {
+				s.reset()
+			}
+		} else {
+			s.append(tp)
+			s.drain()
+		}
+		ta.parse(s)
+	}
+
+	if tp.rst || (tp.fin && len(s.pending) == 0) {
+		delete(ta.streams, key)
+	}
+}
+
+// parse 从缓冲区中解析出所有完整的请求
+func (ta *tcpAssembler) parse(s *tcpStream) {
+	for len(s.buf) > 0 {
+		if len(s.buf) >= 8 && !isRequestStart(s.buf) {
+			s.reset() // 服务端方向的响应数据
+			return
+		}
+		log, n, err := s.next(ta.scheme)
+		if err == errMalformedRequest {
+			ta.malformed++
+			s.reset()
+			return
+		}
+		if log == nil {
+			return
+		}
+
+		s.consume(n)
+		ta.requests++
+		ta.sequence++
+		heap.Push(&ta.ready, &mergeItem{log: log, source: ta.sequence})
+	}
+}
+
+// watermark 未完成的请求中最早的数据包时间，在此之前的请求不会再出现
+func (ta *tcpAssembler) watermark(now time.Time) time.Time {
+	for _, s := range ta.streams {
+		if len(s.marks) > 0 && s.marks[0].ts.Before(now) {
+			now = s.marks[0].ts
+		}
+		for _, p := range s.pending {
+			if p.ts.Before(now) {
+				now = p.ts
+			}
+		}
+	}
+	return now
+}
+
+func (ta *tcpAssembler) release(watermark time.Time, emit func(*LogRecordWrapper) bool) bool {
+	for ta.ready.Len() > 0 && !ta.ready[0].log.OccurAt.After(watermark) {
+		if !emit(heap.Pop(&ta.ready).(*mergeItem).log) {
+			return false
+		}
+	}
+	return true
+}
+
+// expire 丢弃长时间没有数据包的TCP流
+func (ta *tcpAssembler) expire(now time.Time) {
+	for key, s := range ta.streams {
+		if now.Sub(s.lastSeen) > PCAPStreamTimeout {
+			delete(ta.streams, key)
+		}
+	}
+}
+
+// flush 抓包文件读取完毕，输出全部已完成的请求
+func (ta *tcpAssembler) flush(emit func(*LogRecordWrapper) bool) bool {
+	for ta.ready.Len() > 0 {
+		if !emit(heap.Pop(&ta.ready).(*mergeItem).log) {
+			return false
+		}
+	}
+	return true
+}
+
+func isRequestStart(payload []byte) bool {
+	for _, m := range httpMethods {
+		if len(payload) > len(m) && payload[len(m)] == ' ' && string(payload[:len(m)]) == m {
+			return true
+		}
+	}
+	return false
+}
+
+// append 追加数据包，与已有数据重叠的部分（重传）被忽略
+func (s *tcpStream) append(tp *tcpPacket) {
+	data := tp.payload
+	if overlap := int(s.nextSeq - tp.seq); overlap > 0 {
+		if overlap >= len(data) {
+			return
+		}
+		data = data[overlap:]
+	}
+	s.marks = append(s.marks, streamMark{offset: len(s.buf), ts: tp.ts})
+	s.buf = append(s.buf, data...)
+	s.nextSeq += uint32(len(data))
+}
+
+// drain 将已经连续的乱序数据包追加到缓冲区
+func (s *tcpStream) drain() {
+	for found := true; found; {
+		found = false
+		for i, p := range s.pending {
+			if int32(p.seq-s.nextSeq) <= 0 {
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				s.append(p)
+				found = true
+				break
+			}
+		}
+	}
+}
+
+// reset 丢弃缓冲的数据，等待下一个请求的开头重新同步
+func (s *tcpStream) reset() {
+	s.synced = false
+	s.buf, s.marks, s.pending = nil, nil, nil
+	s.hdrEnd, s.scanned = 0, 0
+}
+
+func (s *tcpStream) consume(n int) {
+	s.hdrEnd, s.scanned = 0, 0
+	if n >= len(s.buf) {
+		s.buf, s.marks = nil, nil
+		return
+	}
+	s.buf = s.buf[n:]
+	i := 0
+	for i+1 < len(s.marks) && s.marks[i+1].offset <= n {
+		i++
+	}
+	s.marks = s.marks[i:]
+	for j := range s.marks {
+		s.marks[j].offset -= n
+	}
+	s.marks[0].offset = 0
+}
+
+// next 尝试解析缓冲区开头的请求，数据不完整时返回nil
+func (s *tcpStream) next(scheme string) (*LogRecordWrapper, int, error) {
+	if s.hdrEnd == 0 {
+		from := s.scanned - 3
+		if from < 0 {
+			from = 0
+		}
+		idx := bytes.Index(s.buf[from:], []byte("\r\n\r\n"))
+		if idx < 0 {
+			s.scanned = len(s.buf)
+			if len(s.buf) > PCAPMaxHeaderSize {
+				return nil, 0, errMalformedRequest
+			}
+			return nil, 0, nil
+		}
+		s.hdrEnd = from + idx + 4
+		s.scanned = s.hdrEnd
+	}
+
+	header, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(s.buf[:s.hdrEnd])))
+	if err != nil {
+		return nil, 0, errMalformedRequest
+	}
+
+	data := s.buf
+	if len(header.TransferEncoding) > 0 {
+		// 只有出现结束块时才尝试完整解析
+		from := s.scanned - 5
+		if from < s.hdrEnd {
+			from = s.hdrEnd
+		}
+		found := bytes.Contains(s.buf[from:], []byte("0\r\n"))
+		s.scanned = len(s.buf)
+		if !found {
+			return nil, 0, nil
+		}
+	} else {
+		total := s.hdrEnd + int(header.ContentLength)
+		if header.ContentLength < 0 {
+			total = s.hdrEnd
+		}
+		if len(s.buf) < total {
+			return nil, 0, nil
+		}
+		data = s.buf[:total]
+	}
+
+	rd := bytes.NewReader(data)
+	br := bufio.NewReader(rd)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, 0, errMalformedRequest
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, 0, nil // chunked请求体不完整
+	}
+	if err != nil {
+		return nil, 0, errMalformedRequest
+	}
+
+	log := &LogRecordWrapper{OccurAt: s.marks[0].ts, LogRecord: newHTTPLogRecord(req, body, scheme, s.dst)}
+	return log, len(data) - rd.Len() - br.Buffered(), nil
+}
+
+// newHTTPLogRecord 将解析出的原始HTTP请求转换为LogRecord，请求中没有Host时使用defaultHost
+func newHTTPLogRecord(req *http.Request, body []byte, scheme, defaultHost string) *pb.LogRecord {
+	headers := map[string]string{}
+	for k, v := range req.Header {
+		if k == "Content-Length" {
+			continue
+		}
+		headers[k] = strings.Join(v, ", ")
+	}
+
+	reqURL := req.RequestURI
+	if !req.URL.IsAbs() {
+		host := req.Host
+		if host == "" {
+			host = defaultHost
+		}
+		reqURL = buildLogURL(scheme, host, req.RequestURI)
+	}
+
+	return &pb.LogRecord{
+		Url:    reqURL,
+		Method: req.Method,
+		Header: headers,
+		Body:   body,
+	}
+}
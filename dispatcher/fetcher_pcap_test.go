@@ -0,0 +1,141 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPacket struct {
+	ms               int64
+	src, dst         string
+	srcPort, dstPort uint16
+	seq              uint32
+	flags            byte
+	payload          string
+}
+
+// writeTestPCAP 生成以太网链路的pcap文件
+func writeTestPCAP(t *testing.T, packets ...testPacket) string {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{0xa1b2c3d4, 0x00040002, 0, 0, 65535, linkTypeEthernet})
+
+	for _, p := range packets {
+		frame := make([]byte, 14+20+20)
+		binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+		ip := frame[14:]
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(40+len(p.payload)))
+		ip[9] = ipProtocolTCP
+		copy(ip[12:16], net.ParseIP(p.src).To4())
+		copy(ip[16:20], net.ParseIP(p.dst).To4())
+		tcp := ip[20:]
+		binary.BigEndian.PutUint16(tcp[0:2], p.srcPort)
+		binary.BigEndian.PutUint16(tcp[2:4], p.dstPort)
+		binary.BigEndian.PutUint32(tcp[4:8], p.seq)
+		tcp[12] = 5 << 4
+		tcp[13] = p.flags
+		frame = append(frame, p.payload...)
+
+		binary.Write(buf, binary.LittleEndian, []uint32{uint32(p.ms / 1000), uint32(p.ms % 1000 * 1000), uint32(len(frame)), uint32(len(frame))})
+		buf.Write(frame)
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	assert.Nil(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func TestPCAPFetcher_Start(t *testing.T) {
+	const (
+		client = "10.0.0.2"
+		other  = "10.0.0.3"
+		server = "10.0.0.1"
+	)
+	post := "POST /orders?id=1 HTTP/1.1\r\nHost: api.example.com\r\nContent-Type: application/json\r\nContent-Length: 7\r\n\r\n{\"a\":1}"
+	get := "GET /ping HTTP/1.1\r\nHost: api.example.com\r\n\r\n"
+	chunked := "PUT /upload HTTP/1.1\r\nHost: api.example.com\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n"
+
+	path := writeTestPCAP(t,
+		testPacket{ms: 1000, src: client, dst: server, srcPort: 40000, dstPort: 8080, seq: 99, flags: 0x02},
+		testPacket{ms: 1001, src: server, dst: client, srcPort: 8080, dstPort: 40000, seq: 499, flags: 0x12},
+		// POST分成三段，第三段先于第二段到达
+		testPacket{ms: 1002, src: client, dst: server, srcPort: 40000, dstPort: 8080, seq: 100, payload: post[:20]},
+		testPacket{ms: 1003, src: client, dst: server, srcPort: 40000, dstPort: 8080, seq: 140, payload: post[40:]},
+		// 连接在抓包前已经建立，之后在同一个keep-alive连接中发送chunked请求，并pipeline一个GET
+		testPacket{ms: 1500, src: other, dst: server, srcPort: 50000, dstPort: 8080, seq: 7000, payload: get},
+		testPacket{ms: 1600, src: client, dst: server, srcPort: 40000, dstPort: 8080, seq: 120, payload: post[20:40]},
+		// 重传
+		testPacket{ms: 1601, src: client, dst: server, srcPort: 40000, dstPort: 8080, seq: 120, payload: post[20:40]},
+		testPacket{ms: 1700, src: server, dst: client, srcPort: 8080, dstPort: 40000, seq: 500, payload: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		testPacket{ms: 2000, src: other, dst: server, srcPort: 50000, dstPort: 8080, seq: 7000 + uint32(len(get)), payload: chunked[:50]},
+		testPacket{ms: 2100, src: other, dst: server, srcPort: 50000, dstPort: 8080, seq: 7000 + uint32(len(get)) + 50, payload: chunked[50:] + get},
+		// 被过滤的端口
+		testPacket{ms: 2200, src: client, dst: server, srcPort: 40001, dstPort: 9090, seq: 1, payload: get},
+	)
+
+	pf, err := NewPCAPFetcher(path, "tcp port 8080")
+	assert.Nil(t, err)
+	pf.TimeRange(ParseMSec(0), ParseMSec(10000))
+	output := make(chan *LogRecordWrapper, 10)
+	pf.SetOutput(output)
+	assert.Nil(t, pf.Start())
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		logs = append(logs, log)
+	}
+	assert.Len(t, logs, 4)
+
+	assert.Equal(t, "http://api.example.com/orders?id=1", logs[0].Url)
+	assert.Equal(t, "POST", logs[0].Method)
+	assert.Equal(t, `{"a":1}`, string(logs[0].Body))
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, logs[0].Header)
+	assert.Equal(t, ParseMSec(1002), logs[0].OccurAt)
+
+	assert.Equal(t, "http://api.example.com/ping", logs[1].Url)
+	assert.Equal(t, ParseMSec(1500), logs[1].OccurAt)
+
+	assert.Equal(t, "PUT", logs[2].Method)
+	assert.Equal(t, "abcde", string(logs[2].Body))
+	assert.Equal(t, ParseMSec(2000), logs[2].OccurAt)
+
+	assert.Equal(t, "GET", logs[3].Method)
+	assert.Equal(t, ParseMSec(2100), logs[3].OccurAt)
+}
+
+func TestCompilePacketFilter(t *testing.T) {
+	tp := &tcpPacket{src: net.ParseIP("10.0.0.2"), dst: net.ParseIP("10.0.0.1"), srcPort: 40000, dstPort: 8080}
+
+	cases := map[string]bool{
+		"":                                    true,
+		"tcp port 8080":                       true,
+		"port 80":                             false,
+		"dst port 8080 and src host 10.0.0.2": true,
+		"src port 8080":                       false,
+		"not dst net 10.0.0.0/24":             false,
+		"port 80 or (dst host 10.0.0.1 && !src port 22)": true,
+	}
+	for expr, expected := range cases {
+		f, err := compilePacketFilter(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, expected, f(tp), expr)
+	}
+
+	for _, expr := range []string{"port", "port http", "host example.com", "(port 80", "port 80)", "proto udp"} {
+		_, err := compilePacketFilter(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestPcapngInterface_Timestamp(t *testing.T) {
+	assert.Equal(t, time.Unix(1, 500000000), (&pcapngInterface{tsresol: 6}).timestamp(1500000))
+	assert.Equal(t, time.Unix(1, 5), (&pcapngInterface{tsresol: 9}).timestamp(1000000005))
+	assert.Equal(t, time.Unix(2, 500000000), (&pcapngInterface{tsresol: 0x81}).timestamp(5))
+}
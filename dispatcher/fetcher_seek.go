@@ -0,0 +1,238 @@
+package dispatcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// logIndex 压缩日志文件的旁路时间索引，记录解压后的行首偏移量与该行的日志时间
+	//
+	// 压缩文件无法随机访问，定位时仍需解压索引位置之前的内容，但可以省去逐行分析的开销
+	logIndex struct {
+		Size    int64           `json:"size"`     // 源文件大小，用于判断索引是否过期
+		ModTime int64           `json:"mod_time"` // 源文件修改时间，纳秒
+		Entries []logIndexEntry `json:"entries"`
+		path    string
+		dirty   bool
+	}
+
+	logIndexEntry struct {
+		Offset int64 `json:"offset"`
+		Time   int64 `json:"time"` // 毫秒
+	}
+)
+
+var (
+	// FileSeekMinSpan 二分查找的最小区间，区间小于该值时停止查找，从区间起点顺序读取
+	FileSeekMinSpan int64 = 1 << 20
+	// FileSeekProbeLines 二分查找时每次最多尝试解析的行数
+	FileSeekProbeLines = 100
+	// FileIndexStep 旁路索引相邻记录之间解压后的字节数
+	FileIndexStep int64 = 64 << 20
+	// FileIndexSuffix 旁路索引文件的后缀
+	FileIndexSuffix = ".havokidx"
+)
+
+// seekBegin 跳过开始时间之前的内容，返回（解压后的）当前偏移量，压缩文件开启索引时同时返回索引
+func seekBegin(lf *logFile, path string, begin time.Time, analyzer Analyzer, index bool) (int64, *logIndex, error) {
+	info, err := lf.file.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if !lf.Compressed() {
+		offset, err := seekLogFile(lf.file, info.Size(), begin, analyzer.Analyze)
+		if err == nil {
+			_, err = lf.file.Seek(offset, io.SeekStart)
+		}
+		if offset > 0 {
+			Logger.Info("seek to begin time", zap.String("path", path), zap.Int64("offset", offset))
+		}
+		return offset, nil, err
+	}
+	if !index {
+		return 0, nil, nil
+	}
+
+	idx := loadLogIndex(path, info)
+	offset := idx.lookup(begin)
+	if offset > 0 {
+		if _, err = io.CopyN(ioutil.Discard, lf, offset); err != nil {
+			return 0, nil, err
+		}
+		Logger.Info("seek to begin time by log index", zap.String("path", path), zap.Int64("offset", offset))
+	}
+	return offset, idx, nil
+}
+
+// locateLogFile 断点中记录了该文件的读取位置时从断点继续，否则跳过开始时间之前的内容
+func locateLogFile(lf *logFile, path string, cursors map[string]int64, begin time.Time, analyzer Analyzer, index bool) (int64, *logIndex, error) {
+	if offset, ok := cursors[path]; ok {
+		resumed, err := seekCursor(lf, path, offset)
+		if err != nil || resumed {
+			return offset, nil, err
+		}
+	}
+	return seekBegin(lf, path, begin, analyzer, index)
+}
+
+// seekCursor 跳到断点记录的（解压后）偏移量，未压缩的文件比偏移量短时（已被截断或者替换）返回false
+func seekCursor(lf *logFile, path string, offset int64) (bool, error) {
+	if lf.Compressed() {
+		if _, err := io.CopyN(ioutil.Discard, lf, offset); err != nil && err != io.EOF {
+			return false, err
+		}
+	} else {
+		info, err := lf.file.Stat()
+		if err != nil {
+			return false, err
+		}
+		if info.Size() < offset {
+			Logger.Warn("file is shorter than checkpoint offset, seek by begin time", zap.String("path", path),
+				zap.Int64("offset", offset), zap.Int64("size", info.Size()))
+			return false, nil
+		}
+		if _, err = lf.file.Seek(offset, io.SeekStart); err != nil {
+			return false, err
+		}
+	}
+	Logger.Info("resume file from checkpoint", zap.String("path", path), zap.Int64("offset", offset))
+	return true, nil
+}
+
+// seekLogFile 在按时间有序的未压缩文件中按字节偏移量二分查找，返回不晚于第一条OccurAt>=begin的日志的行首偏移量
+//
+// 无法解析的区间按更早的方向收缩，因此结果只会偏早，之前的日志由调用方按时间过滤
+func seekLogFile(file *os.File, size int64, begin time.Time, analyze func([]byte) *LogRecordWrapper) (int64, error) {
+	start, at, ok, err := probeLogFile(file, 0, analyze)
+	if err != nil || !ok || !at.Before(begin) {
+		return 0, err
+	}
+
+	lo, hi := start, size
+	for hi-lo > FileSeekMinSpan {
+		mid := lo + (hi-lo)/2
+		start, at, ok, err = probeLogFile(file, mid, analyze)
+		if err != nil {
+			return 0, err
+		}
+		if ok && start < hi && at.Before(begin) {
+			lo = start
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// probeLogFile 从offset之后的第一个行首开始，返回第一条可以解析的日志的行首偏移量与日志时间
+func probeLogFile(file *os.File, offset int64, analyze func([]byte) *LogRecordWrapper) (int64, time.Time, bool, error) {
+	pos := offset
+	if offset > 0 {
+		pos = offset - 1 // offset恰好是行首时从该行开始
+	}
+	if _, err := file.Seek(pos, io.SeekStart); err != nil {
+		return 0, time.Time{}, false, err
+	}
+
+	reader := bufio.NewReader(file)
+	if offset > 0 {
+		skipped, err := reader.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			pos += int64(len(skipped))
+			skipped, err = reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return 0, time.Time{}, false, ignoreEOF(err)
+		}
+		pos += int64(len(skipped))
+	}
+
+	for i := 0; i < FileSeekProbeLines; i++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && (err == nil || err == io.EOF) {
+			if log := analyze(trimLine(line)); log != nil {
+				return pos, log.OccurAt, true, nil
+			}
+		}
+		if err != nil {
+			return 0, time.Time{}, false, ignoreEOF(err)
+		}
+		pos += int64(len(line))
+	}
+	return 0, time.Time{}, false, nil
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func trimLine(line []byte) []byte {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// loadLogIndex 读取path对应的旁路索引，索引不存在或者已过期时返回空索引
+func loadLogIndex(path string, info os.FileInfo) *logIndex {
+	idx := &logIndex{path: path + FileIndexSuffix, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		return idx
+	}
+
+	saved := &logIndex{}
+	if err = json.Unmarshal(data, saved); err != nil || saved.Size != idx.Size || saved.ModTime != idx.ModTime {
+		Logger.Warn("ignore stale or broken log index", zap.String("index", idx.path), zap.Error(err))
+		return idx
+	}
+	idx.Entries = saved.Entries
+	return idx
+}
+
+// lookup 返回最后一条早于begin的索引记录的偏移量
+func (idx *logIndex) lookup(begin time.Time) int64 {
+	ms := begin.UnixNano() / 1e6
+	i := sort.Search(len(idx.Entries), func(i int) bool { return idx.Entries[i].Time >= ms })
+	if i == 0 {
+		return 0
+	}
+	return idx.Entries[i-1].Offset
+}
+
+// add 距离上一条记录超过FileIndexStep时添加记录
+func (idx *logIndex) add(offset int64, at time.Time) {
+	if n := len(idx.Entries); n > 0 && offset < idx.Entries[n-1].Offset+FileIndexStep {
+		return
+	}
+	idx.Entries = append(idx.Entries, logIndexEntry{Offset: offset, Time: at.UnixNano() / 1e6})
+	idx.dirty = true
+}
+
+func (idx *logIndex) save() {
+	if !idx.dirty {
+		return
+	}
+	data, err := json.Marshal(idx)
+	if err == nil {
+		err = os.WriteFile(idx.path, data, 0644)
+	}
+	if err != nil {
+		Logger.Warn("failed to save log index", zap.String("index", idx.path), zap.Error(err))
+		return
+	}
+	idx.dirty = false
+	Logger.Info("saved log index", zap.String("index", idx.path), zap.Int("entries", len(idx.Entries)))
+}
@@ -0,0 +1,455 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// SyntheticTemplate 合成请求的模板，url、headers、body、hash_field中可以使用{{name args}}形式的占位符：
+	//
+	//	{{seq}}               自增序号
+	//	{{uuid}}              随机UUID
+	//	{{int 1 100}}         闭区间内的随机整数
+	//	{{choice a b c}}      随机选择一个参数
+	//	{{hex 16}}            指定长度的随机十六进制字符串
+	//	{{timestamp}}         日志时间，毫秒
+	//	{{unix}}              日志时间，秒
+	//	{{time 2006-01-02}}   按layout格式化的日志时间
+	SyntheticTemplate struct {
+		Name      string            `toml:"name"`
+		Weight    int               `toml:"weight"` // 在所有模板中被选中的权重，默认为1
+		URL       string            `toml:"url"`
+		Method    string            `toml:"method"` // 默认为GET
+		Headers   map[string]string `toml:"headers"`
+		Body      string            `toml:"body"`
+		HashField string            `toml:"hash_field"`
+	}
+
+	// SyntheticPoint QPS曲线上的一点，At为相对任务开始时间的偏移量（毫秒），相邻两点之间线性变化，最后一点之后保持不变
+	SyntheticPoint struct {
+		At  int64   `toml:"at"`
+		QPS float64 `toml:"qps"`
+	}
+
+	// SyntheticTemplateStats 单个模板的生成统计
+	SyntheticTemplateStats struct {
+		Name      string `json:"name"`
+		Generated int64  `json:"generated"`
+	}
+
+	// SyntheticFetcher 根据请求模板按QPS曲线生成日志，用于没有线上日志的新接口，不依赖Analyzer
+	//
+	// 日志时间从任务开始时间起按QPS曲线递增，与读取到的日志一样经过Stage、TimeWheel、Havok，
+	// 因此倍速、shake/strike以及replayer的processor、报告同样适用。任务End<=0时持续生成，直到通过/api/job/stop停止
+	SyntheticFetcher struct {
+		templates []*syntheticTemplate
+		total     int
+		shape     []SyntheticPoint
+		origin    time.Time // QPS曲线的起点，即任务最初的开始时间
+		poisson   bool
+		rand      *rand.Rand
+		seq       int64
+		*baseFetcher
+	}
+
+	syntheticTemplate struct {
+		name      string
+		weight    int
+		method    string
+		url       syntheticText
+		headers   []syntheticHeader // 按名称排序，固定随机数种子时结果可以复现
+		body      syntheticText
+		hashField syntheticText
+		generated int64
+	}
+
+	syntheticHeader struct {
+		name  string
+		value syntheticText
+	}
+
+	// syntheticText 编译后的模板文本，由字面量与占位符交替组成
+	syntheticText []syntheticPart
+
+	syntheticPart struct {
+		literal string
+		gen     syntheticGen
+	}
+
+	syntheticGen func(*syntheticContext) string
+
+	syntheticContext struct {
+		rand *rand.Rand
+		seq  int64
+		at   time.Time
+	}
+)
+
+var (
+	// SyntheticStep 按QPS曲线推进日志时间的最大步长，QPS变化时按步长累计请求数
+	SyntheticStep = 10 * time.Millisecond
+
+	syntheticPlaceholders = map[string]func(args string) (syntheticGen, error){
+		"seq": func(string) (syntheticGen, error) {
+			return func(ctx *syntheticContext) string { return strconv.FormatInt(ctx.seq, 10) }, nil
+		},
+		"uuid": func(string) (syntheticGen, error) {
+			return func(ctx *syntheticContext) string {
+				b := make([]byte, 16)
+				ctx.rand.Read(b)
+				b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+				return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+			}, nil
+		},
+		"int": func(args string) (syntheticGen, error) {
+			fields := strings.Fields(args)
+			if len(fields) != 2 {
+				return nil, errors.New("int requires min and max")
+			}
+			min, err1 := strconv.ParseInt(fields[0], 10, 64)
+			max, err2 := strconv.ParseInt(fields[1], 10, 64)
+			if err1 != nil || err2 != nil || min > max {
+				return nil, errors.New("bad range of int: " + args)
+			}
+			return func(ctx *syntheticContext) string { return strconv.FormatInt(min+ctx.rand.Int63n(max-min+1), 10) }, nil
+		},
+		"choice": func(args string) (syntheticGen, error) {
+			choices := strings.Fields(args)
+			if len(choices) == 0 {
+				return nil, errors.New("choice requires at least one argument")
+			}
+			return func(ctx *syntheticContext) string { return choices[ctx.rand.Intn(len(choices))] }, nil
+		},
+		"hex": func(args string) (syntheticGen, error) {
+			n, err := strconv.Atoi(strings.TrimSpace(args))
+			if err != nil || n <= 0 {
+				return nil, errors.New("bad length of hex: " + args)
+			}
+			return func(ctx *syntheticContext) string {
+				b := make([]byte, (n+1)/2)
+				ctx.rand.Read(b)
+				return fmt.Sprintf("%x", b)[:n]
+			}, nil
+		},
+		"timestamp": func(string) (syntheticGen, error) {
+			return func(ctx *syntheticContext) string { return strconv.FormatInt(ctx.at.UnixNano()/1e6, 10) }, nil
+		},
+		"unix": func(string) (syntheticGen, error) {
+			return func(ctx *syntheticContext) string { return strconv.FormatInt(ctx.at.Unix(), 10) }, nil
+		},
+		"time": func(layout string) (syntheticGen, error) {
+			if layout == "" {
+				return nil, errors.New("time requires layout")
+			}
+			return func(ctx *syntheticContext) string { return ctx.at.Format(layout) }, nil
+		},
+	}
+)
+
+// NewSyntheticFetcher SyntheticFetcher的构造函数，默认以恒定的qps生成，模板或者占位符有误时返回error
+func NewSyntheticFetcher(templates []*SyntheticTemplate, qps float64) (*SyntheticFetcher, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("no synthetic template")
+	}
+	sf := &SyntheticFetcher{rand: rand.New(rand.NewSource(time.Now().UnixNano())), baseFetcher: newBaseFetcher()}
+	for i, t := range templates {
+		st, err := compileSyntheticTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("synthetic template #%d %s: %w", i, t.Name, err)
+		}
+		sf.templates = append(sf.templates, st)
+		sf.total += st.weight
+	}
+	if _, err := sf.WithShape([]SyntheticPoint{{QPS: qps}}); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// WithShape 使用分段线性的QPS曲线代替恒定的qps，points须按At递增
+func (sf *SyntheticFetcher) WithShape(points []SyntheticPoint) (*SyntheticFetcher, error) {
+	if len(points) == 0 {
+		return sf, nil
+	}
+	for i, p := range points {
+		if p.At < 0 || p.QPS < 0 || (i > 0 && p.At <= points[i-1].At) {
+			return nil, fmt.Errorf("bad qps shape at point #%d", i)
+		}
+	}
+	sf.shape = points
+	return sf, nil
+}
+
+// WithPoisson 请求间隔服从指数分布（泊松到达），默认为均匀间隔
+func (sf *SyntheticFetcher) WithPoisson(enabled bool) *SyntheticFetcher {
+	sf.poisson = enabled
+	return sf
+}
+
+// WithSeed 固定随机数种子，使模板选择、占位符以及请求间隔可以复现
+func (sf *SyntheticFetcher) WithSeed(seed int64) *SyntheticFetcher {
+	sf.rand = rand.New(rand.NewSource(seed))
+	return sf
+}
+
+// Stats 返回各模板的生成统计
+func (sf *SyntheticFetcher) Stats() []SyntheticTemplateStats {
+	stats := make([]SyntheticTemplateStats, len(sf.templates))
+	for i, st := range sf.templates {
+		stats[i] = SyntheticTemplateStats{Name: st.name, Generated: atomic.LoadInt64(&st.generated)}
+	}
+	return stats
+}
+
+// Start 从任务开始时间起按QPS曲线生成日志
+func (sf *SyntheticFetcher) Start() error {
+	sf.baseFetcher.start()
+	defer sf.closeOutput()
+	if sf.parent != nil {
+		sf.parent.Notify(sf, StatusRunning)
+	}
+	Logger.Info("start to generate synthetic logs", zap.Int("templates", len(sf.templates)), zap.Any("shape", sf.shape))
+
+	sf.origin = sf.begin
+	at := sf.first()
+	for {
+		if sf.Status() == StatusStopped {
+			return ErrTaskInterrupted
+		}
+		if sf.seekPending() || at.After(sf.end) {
+			if !sf.applySeek(at.After(sf.end)) {
+				break
+			}
+			at = sf.first()
+			continue
+		}
+		log := sf.generate(at)
+		log.epoch = sf.epoch
+		if !sf.send(log) {
+			return ErrTaskInterrupted
+		}
+		at = sf.next(at)
+	}
+
+	if sf.Status() == StatusStopped {
+		return ErrTaskInterrupted
+	}
+	Logger.Info("finished to generate synthetic logs", zap.Int64("generated", sf.seq))
+	sf.Finish()
+	return nil
+}
+
+// Seek 从日志时间at重新生成，QPS曲线仍以任务最初的开始时间为起点，实现Seeker
+func (sf *SyntheticFetcher) Seek(at time.Time, epoch int64) error {
+	return sf.requestSeek(at, epoch)
+}
+
+// first 返回开始时间之后的第一条日志的时间，开始时QPS为0时从QPS曲线积分达到1的时刻开始
+func (sf *SyntheticFetcher) first() time.Time {
+	if sf.qps(sf.begin.Sub(sf.origin)) <= 0 {
+		return sf.next(sf.begin)
+	}
+	return sf.begin
+}
+
+// next 返回下一条日志的时间，即从at起QPS曲线的积分达到1（泊松到达时为服从指数分布的随机数）的时刻；
+// 最后一点之后QPS为0时不会再有日志，返回晚于结束时间的时刻，任务被停止或者重新定位时直接返回at
+func (sf *SyntheticFetcher) next(at time.Time) time.Time {
+	need := 1.0
+	if sf.poisson {
+		need = sf.rand.ExpFloat64()
+	}
+	last := time.Duration(sf.shape[len(sf.shape)-1].At) * time.Millisecond
+	for need > 0 && !at.After(sf.end) {
+		if sf.Status() == StatusStopped || sf.seekPending() {
+			return at
+		}
+		qps := sf.qps(at.Sub(sf.origin))
+		if qps <= 0 {
+			if at.Sub(sf.origin) >= last {
+				return sf.end.Add(SyntheticStep)
+			}
+			at = at.Add(SyntheticStep)
+			continue
+		}
+		if rest := time.Duration(math.Round(need / qps * float64(time.Second))); rest <= SyntheticStep {
+			return at.Add(rest)
+		}
+		need -= qps * SyntheticStep.Seconds()
+		at = at.Add(SyntheticStep)
+	}
+	return at
+}
+
+// qps 返回任务开始后offset时刻的QPS
+func (sf *SyntheticFetcher) qps(offset time.Duration) float64 {
+	ms := int64(offset / time.Millisecond)
+	if ms <= sf.shape[0].At {
+		return sf.shape[0].QPS
+	}
+	for i := 1; i < len(sf.shape); i++ {
+		if p, q := sf.shape[i-1], sf.shape[i]; ms < q.At {
+			return p.QPS + (q.QPS-p.QPS)*float64(ms-p.At)/float64(q.At-p.At)
+		}
+	}
+	return sf.shape[len(sf.shape)-1].QPS
+}
+
+// generate 按权重选择模板并生成一条日志
+func (sf *SyntheticFetcher) generate(at time.Time) *LogRecordWrapper {
+	n := sf.rand.Intn(sf.total)
+	st := sf.templates[0]
+	for _, t := range sf.templates {
+		if n < t.weight {
+			st = t
+			break
+		}
+		n -= t.weight
+	}
+
+	sf.seq++
+	atomic.AddInt64(&st.generated, 1)
+	ctx := &syntheticContext{rand: sf.rand, seq: sf.seq, at: at}
+	log := &LogRecordWrapper{
+		HashField: st.hashField.render(ctx),
+		OccurAt:   at,
+		LogRecord: &pb.LogRecord{Url: st.url.render(ctx), Method: st.method},
+	}
+	if len(st.headers) > 0 {
+		log.Header = make(map[string]string, len(st.headers))
+		for _, h := range st.headers {
+			log.Header[h.name] = h.value.render(ctx)
+		}
+	}
+	if len(st.body) > 0 {
+		log.Body = []byte(st.body.render(ctx))
+	}
+	return log
+}
+
+func (sf *SyntheticFetcher) Finish() {
+	sf.baseFetcher.Finish()
+	if sf.parent != nil {
+		sf.parent.Notify(sf, StatusFinished)
+	}
+}
+
+func (sf *SyntheticFetcher) Stop() {
+	sf.baseFetcher.Stop()
+	if sf.parent != nil {
+		sf.parent.Notify(sf, StatusStopped)
+	}
+}
+
+func (sf *SyntheticFetcher) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/synthetic/stats",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderJSON(w, &struct {
+					Code int                      `json:"code"`
+					Data []SyntheticTemplateStats `json:"data"`
+				}{Code: http.StatusOK, Data: sf.Stats()})
+			},
+		},
+	}
+}
+
+func compileSyntheticTemplate(t *SyntheticTemplate) (*syntheticTemplate, error) {
+	if t.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	if t.Weight < 0 {
+		return nil, errors.New("weight must not be negative")
+	}
+	st := &syntheticTemplate{name: t.Name, weight: t.Weight, method: strings.ToUpper(t.Method)}
+	if st.weight == 0 {
+		st.weight = 1
+	}
+	if st.method == "" {
+		st.method = "GET"
+	}
+
+	var err error
+	if st.url, err = compileSyntheticText(t.URL); err != nil {
+		return nil, err
+	}
+	if st.body, err = compileSyntheticText(t.Body); err != nil {
+		return nil, err
+	}
+	if st.hashField, err = compileSyntheticText(t.HashField); err != nil {
+		return nil, err
+	}
+	for name, value := range t.Headers {
+		text, err := compileSyntheticText(value)
+		if err != nil {
+			return nil, err
+		}
+		st.headers = append(st.headers, syntheticHeader{name: name, value: text})
+	}
+	sort.Slice(st.headers, func(i, j int) bool { return st.headers[i].name < st.headers[j].name })
+	return st, nil
+}
+
+// compileSyntheticText 解析文本中的{{name args}}占位符
+func compileSyntheticText(s string) (syntheticText, error) {
+	var text syntheticText
+	for s != "" {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			text = append(text, syntheticPart{literal: s})
+			break
+		}
+		if i > 0 {
+			text = append(text, syntheticPart{literal: s[:i]})
+		}
+		j := strings.Index(s[i:], "}}")
+		if j < 0 {
+			return nil, errors.New("unclosed placeholder: " + s[i:])
+		}
+
+		expr := strings.TrimSpace(s[i+2 : i+j])
+		name, args := expr, ""
+		if k := strings.IndexAny(expr, " \t"); k >= 0 {
+			name, args = expr[:k], strings.TrimSpace(expr[k+1:])
+		}
+		newGen, ok := syntheticPlaceholders[name]
+		if !ok {
+			return nil, errors.New("unknown placeholder: " + name)
+		}
+		gen, err := newGen(args)
+		if err != nil {
+			return nil, err
+		}
+		text = append(text, syntheticPart{gen: gen})
+		s = s[i+j+2:]
+	}
+	return text, nil
+}
+
+func (text syntheticText) render(ctx *syntheticContext) string {
+	if len(text) == 1 && text[0].gen == nil {
+		return text[0].literal
+	}
+	var b strings.Builder
+	for _, p := range text {
+		if p.gen != nil {
+			b.WriteString(p.gen(ctx))
+		} else {
+			b.WriteString(p.literal)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyntheticFetcher_Start(t *testing.T) {
+	templates := []*SyntheticTemplate{
+		{Name: "list", Weight: 3, URL: "http://api.example.com/orders/{{seq}}?page={{int 1 3}}"},
+		{
+			Name:      "create",
+			URL:       "http://api.example.com/orders",
+			Method:    "post",
+			Headers:   map[string]string{"X-Request-Id": "{{hex 8}}", "Content-Type": "application/json"},
+			Body:      `{"id":"{{uuid}}","ts":{{timestamp}}}`,
+			HashField: "user-{{choice a b}}",
+		},
+	}
+	sf, err := NewSyntheticFetcher(templates, 10)
+	assert.Nil(t, err)
+	begin := time.Unix(1606118400, 0)
+	logs := fetchAll(t, sf.WithSeed(1), begin, begin.Add(5*time.Second))
+	assert.Len(t, logs, 51)
+
+	stats := sf.Stats()
+	assert.EqualValues(t, 51, stats[0].Generated+stats[1].Generated)
+	assert.True(t, stats[0].Generated > stats[1].Generated)
+
+	list := regexp.MustCompile(`^http://api\.example\.com/orders/\d+\?page=[1-3]$`)
+	for i, log := range logs {
+		assert.Equal(t, begin.Add(time.Duration(i)*100*time.Millisecond), log.OccurAt)
+		if log.Method == "GET" {
+			assert.Regexp(t, list, log.Url)
+			continue
+		}
+		assert.Equal(t, "POST", log.Method)
+		assert.Regexp(t, `^[0-9a-f]{8}$`, log.Header["X-Request-Id"])
+		assert.Contains(t, []string{"user-a", "user-b"}, log.HashField)
+		var body struct {
+			ID string `json:"id"`
+			TS int64  `json:"ts"`
+		}
+		assert.Nil(t, json.Unmarshal(log.Body, &body))
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, body.ID)
+		assert.Equal(t, log.OccurAt.UnixNano()/1e6, body.TS)
+	}
+
+	// 相同的种子生成相同的日志
+	sf, _ = NewSyntheticFetcher(templates, 10)
+	again := fetchAll(t, sf.WithSeed(1), begin, begin.Add(5*time.Second))
+	for i := range logs {
+		assert.Equal(t, logs[i].Url, again[i].Url)
+	}
+}
+
+func TestSyntheticFetcher_Shape(t *testing.T) {
+	sf, err := NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 1)
+	assert.Nil(t, err)
+	_, err = sf.WithShape([]SyntheticPoint{{At: 0, QPS: 0}, {At: 1000, QPS: 0}, {At: 3000, QPS: 20}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, sf.qps(500*time.Millisecond))
+	assert.Equal(t, 10.0, sf.qps(2*time.Second))
+	assert.Equal(t, 20.0, sf.qps(time.Hour))
+
+	// QPS为0的区间不生成日志
+	begin := time.Unix(1606118400, 0)
+	logs := fetchAll(t, sf, begin, begin.Add(2500*time.Millisecond))
+	assert.Len(t, logs, 11) // 1s至2.5s之间QPS从0线性增加到15，共11.25个请求
+	assert.True(t, logs[0].OccurAt.Sub(begin) > time.Second)
+
+	_, err = sf.WithShape([]SyntheticPoint{{At: 1000, QPS: 1}, {At: 1000, QPS: 2}})
+	assert.NotNil(t, err)
+}
+
+func TestSyntheticFetcher_ZeroQPS(t *testing.T) {
+	begin := time.Unix(1606118400, 0)
+
+	// 任务没有结束时间，最后一点之后QPS为0时直接结束
+	sf, err := NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 0)
+	assert.Nil(t, err)
+	assert.Len(t, fetchAll(t, sf, begin, parseJobEnd(0)), 0)
+	assert.Equal(t, StatusFinished, sf.Status())
+
+	sf, err = NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 1)
+	assert.Nil(t, err)
+	_, err = sf.WithShape([]SyntheticPoint{{At: 0, QPS: 10}, {At: 1000, QPS: 0}})
+	assert.Nil(t, err)
+	logs := fetchAll(t, sf, begin, parseJobEnd(0))
+	assert.Len(t, logs, 6) // 开始时刻一条，之后1s内QPS从10线性减少到0，积分共5个请求
+	assert.Equal(t, StatusFinished, sf.Status())
+
+	// QPS为0的区间很长时仍然可以停止
+	sf, err = NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 1)
+	assert.Nil(t, err)
+	_, err = sf.WithShape([]SyntheticPoint{{At: 0, QPS: 0}, {At: 1e12, QPS: 0}, {At: 2e12, QPS: 1}})
+	assert.Nil(t, err)
+	sf.TimeRange(begin, parseJobEnd(0))
+	sf.SetOutput(make(chan *LogRecordWrapper, 10))
+	time.AfterFunc(50*time.Millisecond, sf.Stop)
+	assert.Equal(t, ErrTaskInterrupted, sf.Start())
+
+	// 输出管道已满、发送被阻塞时仍然可以停止，输出管道随后被关闭
+	sf, err = NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 1000)
+	assert.Nil(t, err)
+	sf.TimeRange(begin, parseJobEnd(0))
+	output := make(chan *LogRecordWrapper, 10)
+	sf.SetOutput(output)
+	time.AfterFunc(50*time.Millisecond, sf.Stop)
+	assert.Equal(t, ErrTaskInterrupted, sf.Start())
+	assert.Len(t, output, cap(output))
+	for range output {
+	}
+}
+
+func TestNewSyntheticFetcher_BadTemplate(t *testing.T) {
+	for _, tpl := range []*SyntheticTemplate{
+		{},
+		{URL: "http://a.com/{{nope}}"},
+		{URL: "http://a.com/{{int 5 1}}"},
+		{URL: "http://a.com/{{seq"},
+		{URL: "http://a.com/", Body: "{{hex x}}"},
+		{URL: "http://a.com/", Weight: -1},
+	} {
+		_, err := NewSyntheticFetcher([]*SyntheticTemplate{tpl}, 1)
+		assert.NotNil(t, err, tpl.URL)
+	}
+	_, err := NewSyntheticFetcher(nil, 1)
+	assert.NotNil(t, err)
+}
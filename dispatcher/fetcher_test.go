@@ -0,0 +1,168 @@
+package dispatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendTestLog(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestFileFetcher_LongLine(t *testing.T) {
+	long := "2000 /" + strings.Repeat("x", 100<<10)
+	path := writeTestLog(t, t.TempDir(), "access.log", "1000 /a1", long, "bad", "3000 /a"+strings.Repeat("3", 200<<10), "4000 /a4")
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+
+	// 超过bufio.Scanner默认64KB的行
+	ff := NewFileFetcher(path).WithMaxLineSize(150 << 10)
+	ff.WithAnalyzer(analyzer)
+	logs := fetchAll(t, ff, ParseMSec(0), ParseMSec(9000))
+	assert.Len(t, logs, 3)
+	assert.Equal(t, long[5:], logs[1].Url)
+	assert.Equal(t, "/a4", logs[2].Url)
+	assert.Equal(t, LineStats{Lines: 5, Oversized: 1, Invalid: 1}, ff.Stats())
+}
+
+func TestFileFetcher_Follow(t *testing.T) {
+	defer func(interval time.Duration) { FileFollowInterval = interval }(FileFollowInterval)
+	FileFollowInterval = 10 * time.Millisecond
+
+	path := writeTestLog(t, t.TempDir(), "access.log", "1000 /a1")
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	ff := NewFileFetcher(path).WithFollow(200 * time.Millisecond)
+	ff.WithAnalyzer(analyzer)
+	ff.TimeRange(ParseMSec(0), parseJobEnd(0))
+	output := make(chan *LogRecordWrapper, 10)
+	ff.SetOutput(output)
+
+	done := make(chan error)
+	go func() { done <- ff.Start() }()
+	expect := func(url string) {
+		select {
+		case log := <-output:
+			assert.Equal(t, url, log.Url)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %s", url)
+		}
+	}
+
+	expect("/a1")
+	appendTestLog(t, path, "2000 /a2\n3000 /a")
+	expect("/a2")
+	appendTestLog(t, path, "3\n")
+	expect("/a3")
+
+	// 轮转：旧文件在改名后仍有写入，之后创建新文件
+	assert.Nil(t, os.Rename(path, path+".1"))
+	appendTestLog(t, path+".1", "4000 /a4\n")
+	appendTestLog(t, path, "5000 /a5\n")
+	expect("/a4")
+	expect("/a5")
+
+	// 截断
+	assert.Nil(t, os.WriteFile(path, []byte("6 /a6\n"), 0644))
+	expect("/a6")
+
+	// 实时日志延迟delay后投递
+	start := time.Now()
+	appendTestLog(t, path, fmt.Sprintf("%d /a7\n", start.UnixNano()/1e6))
+	expect("/a7")
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+
+	ff.Stop()
+	assert.Equal(t, ErrTaskInterrupted, <-done)
+	_, ok := <-output
+	assert.False(t, ok)
+}
+
+func TestFileFetcher_Seek(t *testing.T) {
+	defer func(span int64) { FileSeekMinSpan = span }(FileSeekMinSpan)
+	FileSeekMinSpan = 1 << 10
+
+	var lines []string
+	for i := 0; i < 20000; i++ {
+		lines = append(lines, fmt.Sprintf("%d /a%d", 1000+i*10, i))
+		if i%1000 == 0 {
+			lines = append(lines, "bad line")
+		}
+	}
+	path := writeTestLog(t, t.TempDir(), "access.log", lines...)
+
+	var analyzed int
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(func(data []byte) (*LogRecordWrapper, bool) {
+		analyzed++
+		return msecAnalyzeFunc(data)
+	})
+	ff := NewFileFetcher(path)
+	ff.WithAnalyzer(analyzer)
+	logs := fetchAll(t, ff, ParseMSec(151005), ParseMSec(151100))
+	assert.Len(t, logs, 10)
+	assert.Equal(t, "/a15001", logs[0].Url)
+	assert.True(t, analyzed < 1000, analyzed)
+
+	// 开始时间早于第一条日志
+	logs = fetchAll(t, NewFileFetcher(path).withTestAnalyzer(), ParseMSec(0), ParseMSec(1010))
+	assert.Len(t, logs, 2)
+}
+
+func TestFileFetcher_Index(t *testing.T) {
+	defer func(step int64) { FileIndexStep = step }(FileIndexStep)
+	FileIndexStep = 1 << 10
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(gw, "%d /a%d\n", 1000+i*10, i)
+	}
+	gw.Close()
+	path := filepath.Join(t.TempDir(), "access.log.gz")
+	assert.Nil(t, os.WriteFile(path, buf.Bytes(), 0644))
+
+	// 第一次读取时从头解压并建立索引
+	ff := NewFileFetcher(path).WithIndex(true).withTestAnalyzer()
+	assert.Len(t, fetchAll(t, ff, ParseMSec(50500), ParseMSec(60000)), 50)
+	assert.Equal(t, int64(5000), ff.Stats().Lines)
+	_, err := os.Stat(path + FileIndexSuffix)
+	assert.Nil(t, err)
+
+	// 再次读取时跳过索引之前的内容
+	ff = NewFileFetcher(path).WithIndex(true).withTestAnalyzer()
+	logs := fetchAll(t, ff, ParseMSec(40005), ParseMSec(40100))
+	assert.Len(t, logs, 10)
+	assert.Equal(t, "/a3901", logs[0].Url)
+	assert.True(t, ff.Stats().Lines < 200, ff.Stats().Lines)
+
+	// 文件变化后索引失效
+	assert.Nil(t, os.WriteFile(path, buf.Bytes()[:len(buf.Bytes())/2], 0644))
+	assert.Nil(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	assert.Len(t, loadLogIndex(path, mustStat(t, path)).Entries, 0)
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	return info
+}
+
+func (ff *FileFetcher) withTestAnalyzer() *FileFetcher {
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	ff.WithAnalyzer(analyzer)
+	return ff
+}
@@ -108,6 +108,12 @@ func HavokAnalyzer(namespace string, store map[string]interface{}, ch chan<- pro
 					ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, replayerId, k)
 				}
 			}
+			desc = NewDesc(namespace, "_", "DispatcherStat", "performance stats for havok_dispatcher", []string{"source", "index"})
+			for source, stats := range perf.Dispatcher {
+				for k, v := range stats {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, source, k)
+				}
+			}
 		default:
 			t := make(map[string]interface{})
 			desc := NewDesc(namespace, "_", name, "struct field value for havok", []string{"field"})
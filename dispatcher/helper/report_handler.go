@@ -44,6 +44,7 @@ type (
 		MeasurementSucc        string
 		MeasurementFail        string
 		MeasurementAggregation string
+		MeasurementDispatcher  string
 	}
 
 	SLSLogtail struct {
@@ -62,6 +63,8 @@ const (
 	DefaultMeasurementFail = "failures"
 	// DefaultMeasurementAggregation the measurement to store report
 	DefaultMeasurementAggregation = "report"
+	// DefaultMeasurementDispatcher the measurement to store performance stats of dispatcher
+	DefaultMeasurementDispatcher = "dispatcher"
 )
 
 func (b *batchPointsBuffer) addPoint(p *influx.Point) {
@@ -128,6 +131,7 @@ func NewInfluxDBHelperConfig() *InfluxDBHelperConfig {
 		MeasurementSucc:        DefaultMeasurementSucc,
 		MeasurementFail:        DefaultMeasurementFail,
 		MeasurementAggregation: DefaultMeasurementAggregation,
+		MeasurementDispatcher:  DefaultMeasurementDispatcher,
 	}
 }
 
@@ -160,7 +164,8 @@ func NewInfluxDBHelper(conf *InfluxDBHelperConfig) (*InfluxDBHelper, error) {
 
 // HandleReport 处理聚合报告
 func (i *InfluxDBHelper) HandleReport() dispatcher.ReportHandleFunc {
-	return func(r types.Report, _ types.PerformanceStat) {
+	return func(r types.Report, perfStat types.PerformanceStat) {
+		i.writeDispatcherStats(perfStat)
 		for _, report := range r {
 			// 不处理total
 			if report.FullHistory {
@@ -200,6 +205,25 @@ func (i *InfluxDBHelper) HandleReport() dispatcher.ReportHandleFunc {
 	}
 }
 
+// writeDispatcherStats 写入dispatcher自身的性能统计，每个来源一个point
+func (i *InfluxDBHelper) writeDispatcherStats(perfStat types.PerformanceStat) {
+	for source, stats := range perfStat.Dispatcher {
+		if len(stats) == 0 {
+			continue
+		}
+		fields := make(map[string]interface{}, len(stats))
+		for k, v := range stats {
+			fields[k] = v
+		}
+		point, err := influx.NewPoint(i.conf.MeasurementDispatcher, map[string]string{"source": source}, fields, time.Now())
+		if err != nil {
+			dispatcher.Logger.Error("failed to create new point: " + err.Error())
+			continue
+		}
+		i.buffer.addPoint(point)
+	}
+}
+
 func PrintReportToConsole(report types.Report, perfStat types.PerformanceStat) {
 	var full bool
 	var keys []string
@@ -224,6 +248,9 @@ func PrintReportToConsole(report types.Report, perfStat types.PerformanceStat) {
 	op := cutLine + "\n" + s + d + cutLine + "\n"
 	fmt.Println(op)
 	fmt.Println(perfStat.Stats)
+	if len(perfStat.Dispatcher) > 0 {
+		fmt.Println(perfStat.Dispatcher)
+	}
 	//if additionalOutput != "" {
 	//	f, err = os.OpenFile(additionalOutput, os.O_APPEND|os.O_WRONLY, 0666)
 	//	if err == nil {
@@ -21,12 +21,17 @@ type (
 	Job struct {
 		Configuration   *pb.JobConfiguration
 		fetcher         Fetcher
+		stages          []Stage
 		timeWheel       *TimeWheel
 		Havok           *Havok // 不作为子任务，因此不允许子任务直接操作havok
 		status          TaskStatus
 		fetcherStatus   TaskStatus
 		timeWheelStatus TaskStatus
 		feature         *Feature
+		checkpoint      *checkpointer
+		resumed         bool  // 已从断点恢复，开始时间以断点为准
+		epoch           int64 // 重新定位的次数，见Seek
+		profile         *profileRunner
 		lock            sync.Mutex
 	}
 
@@ -45,13 +50,46 @@ type (
 
 const defaultContentType = "application/json"
 
+// openEnd 任务没有结束时间时使用的End，需要通过/api/job/stop停止
+var openEnd = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// parseJobEnd 将JobConfiguration.End转换为时间，End<=0表示任务没有结束时间（如follow模式）
+func parseJobEnd(ms int64) time.Time {
+	if ms <= 0 {
+		return openEnd
+	}
+	return ParseMSec(ms)
+}
+
 func checkConfiguration(c *pb.JobConfiguration) error {
 	if c == nil || ParseMSec(c.Begin).IsZero() || ParseMSec(c.End).IsZero() || c.Rate <= 0 || c.Speed <= 0 || c.Stuck < 0 {
 		return errors.New("bad job configuration value")
 	}
+	return checkAPIRates(c.ApiRates)
+}
+
+// checkAPIRates 按API的回放增益不能为负数
+func checkAPIRates(rates map[string]float32) error {
+	for api, rate := range rates {
+		if api == "" || rate < 0 {
+			return fmt.Errorf("bad rate of api %q: %v", api, rate)
+		}
+	}
 	return nil
 }
 
+// copyAPIRates 复制按API的回放增益，nil保持为nil
+func copyAPIRates(rates map[string]float32) map[string]float32 {
+	if rates == nil {
+		return nil
+	}
+	c := make(map[string]float32, len(rates))
+	for api, rate := range rates {
+		c[api] = rate
+	}
+	return c
+}
+
 // NewJob Job的构造函数
 func NewJob(c *pb.JobConfiguration) (*Job, error) {
 	if err := checkConfiguration(c); err != nil {
@@ -94,6 +132,9 @@ func mergeJob(c1, c2 *pb.JobConfiguration) {
 	if c2.Stuck >= 0 && c2.Stuck != c1.Stuck {
 		c1.Stuck = c2.Stuck
 	}
+	if c2.ApiRates != nil && checkAPIRates(c2.ApiRates) == nil { // 整体替换，空map表示清除
+		c1.ApiRates = copyAPIRates(c2.ApiRates)
+	}
 }
 
 func mergeFeatureConfig(c1, c2 *config) {
@@ -123,10 +164,15 @@ func (job *Job) Provide() []ProviderMethod {
 						renderError(writer, err)
 						return
 					}
+					if err = checkAPIRates(c.ApiRates); err != nil {
+						renderError(writer, err)
+						return
+					}
+					if job.resumed {
+						c.Begin = 0
+					}
 					job.mergeJobConfiguration(c)
-					job.timeWheel.begin = ParseMSec(job.Configuration.Begin)
-					job.timeWheel.end = ParseMSec(job.Configuration.End)
-					job.timeWheel.speed = job.Configuration.Speed
+					job.timeWheel.refreshConfig(job.Configuration)
 					go job.Start()
 					renderResponse(writer, []byte(`{"code": 200, "msg": "job started"}`), defaultContentType)
 					return
@@ -134,6 +180,80 @@ func (job *Job) Provide() []ProviderMethod {
 				renderError(writer, errors.New("bad job status"))
 			},
 		},
+		{
+			Path: "/api/job/stop",
+			Func: func(writer http.ResponseWriter, request *http.Request) {
+				if job.Status() != StatusRunning {
+					renderError(writer, errors.New("bad job status"))
+					return
+				}
+				job.fetcher.Stop()
+				job.timeWheel.Stop()
+				renderResponse(writer, []byte(`{"code": 200, "msg": "job stopped"}`), defaultContentType)
+			},
+		},
+		{
+			Path: "/api/job/pause",
+			Func: func(writer http.ResponseWriter, request *http.Request) {
+				if job.Status() != StatusRunning || !job.timeWheel.Pause() {
+					renderError(writer, errors.New("bad job status"))
+					return
+				}
+				renderResponse(writer, []byte(`{"code": 200, "msg": "job paused"}`), defaultContentType)
+			},
+		},
+		{
+			Path: "/api/job/resume",
+			Func: func(writer http.ResponseWriter, request *http.Request) {
+				if job.Status() != StatusRunning || !job.timeWheel.Resume() {
+					renderError(writer, errors.New("bad job status"))
+					return
+				}
+				renderResponse(writer, []byte(`{"code": 200, "msg": "job resumed"}`), defaultContentType)
+			},
+		},
+		{
+			Path: "/api/job/profile",
+			Func: job.provideLoadProfile,
+		},
+		{
+			Path: "/api/job/api_rates",
+			Func: func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == http.MethodPost {
+					rates := map[string]float32{}
+					if err := json.NewDecoder(request.Body).Decode(&rates); err != nil {
+						renderError(writer, err)
+						return
+					}
+					if err := job.SetAPIRates(rates); err != nil {
+						renderError(writer, err)
+						return
+					}
+				}
+				job.lock.Lock()
+				rates := copyAPIRates(job.Configuration.ApiRates)
+				job.lock.Unlock()
+				renderJSON(writer, &struct {
+					Code int                `json:"code"`
+					Data map[string]float32 `json:"data"`
+				}{Code: http.StatusOK, Data: rates})
+			},
+		},
+		{
+			Path: "/api/job/seek",
+			Func: func(writer http.ResponseWriter, request *http.Request) {
+				to, err := strconv.ParseInt(request.URL.Query().Get("to"), 10, 64)
+				if err != nil || to <= 0 {
+					renderError(writer, errors.New("bad seek position, to should be a timestamp in milliseconds"))
+					return
+				}
+				if err = job.Seek(ParseMSec(to)); err != nil {
+					renderError(writer, err)
+					return
+				}
+				renderResponse(writer, []byte(`{"code": 200, "msg": "job seeked"}`), defaultContentType)
+			},
+		},
 		{
 			Path: "/api/job/description",
 			Func: func(writer http.ResponseWriter, request *http.Request) {
@@ -189,24 +309,45 @@ func (job *Job) Start() error {
 	)
 
 	job.timeWheel.WithHavok(job.Havok)
+	if job.checkpoint != nil {
+		job.timeWheel.dispatched = job.checkpoint.record
+		go job.checkpointing()
+	}
 	go job.timeWheel.Start()
-	job.fetcher.TimeRange(ParseMSec(job.Configuration.Begin), ParseMSec(job.Configuration.End))
-	job.fetcher.SetOutput(job.timeWheel.Recv())
+	job.fetcher.TimeRange(ParseMSec(job.Configuration.Begin), parseJobEnd(job.Configuration.End))
+	output := job.timeWheel.Recv()
+	for i := len(job.stages) - 1; i >= 0; i-- {
+		job.stages[i].SetOutput(output)
+		output = job.stages[i].Recv()
+		go job.stages[i].Start()
+	}
+	job.fetcher.SetOutput(output)
 	go job.fetcher.Start()
 	go job.featureShake()
 	go job.featureStrike()
+	job.lock.Lock()
+	if job.profile != nil {
+		go job.runLoadProfile(job.profile)
+	}
+	job.lock.Unlock()
 	return nil
 }
 
 // Stop 任务停止
 func (job *Job) Stop() {
 	atomic.CompareAndSwapInt32(&job.status, StatusRunning, StatusStopped)
+	if job.checkpoint != nil {
+		job.saveCheckpoint(false)
+	}
 	job.Havok.Broadcast(&pb.DispatcherEvent{Type: pb.DispatcherEvent_JobStop})
 }
 
 // Finish 任务完成
 func (job *Job) Finish() {
 	atomic.CompareAndSwapInt32(&job.status, StatusRunning, StatusFinished)
+	if job.checkpoint != nil {
+		job.saveCheckpoint(true)
+	}
 	job.Havok.Broadcast(&pb.DispatcherEvent{Type: pb.DispatcherEvent_JobFinish})
 }
 
@@ -243,9 +384,37 @@ func (job *Job) Notify(from SubTask, status TaskStatus) {
 		case *TimeWheel:
 			atomic.StoreInt32(&job.timeWheelStatus, StatusRunning)
 		}
+	case StatusPaused:
+		switch from.(type) {
+		case *TimeWheel:
+			Logger.Info("time wheel has be paused")
+			atomic.StoreInt32(&job.timeWheelStatus, StatusPaused)
+		}
 	}
 }
 
+// SetAPIRates 替换按API的回放增益，键为replayer的APISelector计算出的API，实际倍数为Rate乘以该值；
+// 空map表示清除，任务运行中通过JobConfiguration事件下发给replayer
+func (job *Job) SetAPIRates(rates map[string]float32) error {
+	if err := checkAPIRates(rates); err != nil {
+		return err
+	}
+	if rates == nil {
+		rates = map[string]float32{}
+	}
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.Configuration.ApiRates = copyAPIRates(rates)
+	if job.Status() == StatusRunning {
+		job.Havok.Broadcast(&pb.DispatcherEvent{
+			Type: pb.DispatcherEvent_JobConfiguration,
+			Data: &pb.DispatcherEvent_Job{Job: job.Configuration},
+		})
+	}
+	Logger.Info("refresh api rates of job", zap.Any("api_rates", rates))
+	return nil
+}
+
 func (job *Job) Description() map[string]TaskStatus {
 	return map[string]TaskStatus{"Fetcher": job.fetcherStatus, "TimeWheel": job.timeWheelStatus}
 }
@@ -262,6 +431,12 @@ func (job *Job) WithFetcher(f Fetcher) *Job {
 	return job
 }
 
+// WithStage 在Fetcher与TimeWheel之间按顺序添加处理环节
+func (job *Job) WithStage(s ...Stage) *Job {
+	job.stages = append(job.stages, s...)
+	return job
+}
+
 // WithTimeWheel 设置控制日志发送速率的TimeWheel
 func (job *Job) WithTimeWheel(tw *TimeWheel) *Job {
 	job.timeWheel = tw
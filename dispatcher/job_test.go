@@ -0,0 +1,95 @@
+package dispatcher
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestJob_SetAPIRates(t *testing.T) {
+	_, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1, ApiRates: map[string]float32{"/pay": -1}})
+	assert.NotNil(t, err)
+
+	job, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1})
+	assert.Nil(t, err)
+	rates := map[string]float32{"/pay/precreate": 5, "/health": 0}
+	assert.Nil(t, job.SetAPIRates(rates))
+	rates["/pay/precreate"] = 1 // 保存的是副本
+	assert.EqualValues(t, 5, job.Configuration.ApiRates["/pay/precreate"])
+	assert.NotNil(t, job.SetAPIRates(map[string]float32{"": 1}))
+
+	// 未指定时保持不变，空map表示清除
+	job.mergeJobConfiguration(&pb.JobConfiguration{Rate: 2})
+	assert.Len(t, job.Configuration.ApiRates, 2)
+	job.mergeJobConfiguration(&pb.JobConfiguration{ApiRates: map[string]float32{}})
+	assert.Empty(t, job.Configuration.ApiRates)
+}
+
+func TestJob_StartWithBadAPIRates(t *testing.T) {
+	job, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1, ApiRates: map[string]float32{"/pay": 2}})
+	assert.Nil(t, err)
+	var start ProviderMethod
+	for _, m := range job.Provide() {
+		if m.Path == "/api/job/start" {
+			start = m
+		}
+	}
+
+	// 与/api/job/api_rates一致，拒绝不合法的api_rates，任务不会启动
+	rec := httptest.NewRecorder()
+	start.Func(rec, httptest.NewRequest("POST", "/api/job/start", strings.NewReader(`{"rate": 3, "api_rates": {"/pay": -1}}`)))
+	assert.Contains(t, rec.Body.String(), "bad rate of api")
+	assert.Equal(t, StatusReady, job.Status())
+	assert.EqualValues(t, 1, job.Configuration.Rate)
+	assert.Equal(t, map[string]float32{"/pay": 2}, job.Configuration.ApiRates)
+}
+
+func TestJob_StopWithFullInbox(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2*defaultInboxBuffer; i++ {
+		lines = append(lines, fmt.Sprintf("%d /a%d", 1000+i*1000, i))
+	}
+	path := writeTestLog(t, t.TempDir(), "access.log", lines...)
+
+	conf := &pb.JobConfiguration{Begin: 1000, End: 1e10, Rate: 1, Speed: 1}
+	job, err := NewJob(conf)
+	assert.Nil(t, err)
+	tw, err := NewTimeWheel(conf)
+	assert.Nil(t, err)
+	ff := NewFileFetcher(path).withTestAnalyzer()
+	job.WithTimeWheel(tw).WithFetcher(ff).UseDefaultHavok()
+	assert.Nil(t, job.Start())
+	for len(tw.inbox) < cap(tw.inbox) { // 日志间隔1秒，TimeWheel的缓冲很快被填满，Fetcher阻塞在发送上
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 停止时Fetcher不会向已关闭的管道发送，而是放弃发送后由读取循环关闭输出管道
+	var stop ProviderMethod
+	for _, m := range job.Provide() {
+		if m.Path == "/api/job/stop" {
+			stop = m
+		}
+	}
+	rec := httptest.NewRecorder()
+	stop.Func(rec, httptest.NewRequest("POST", "/api/job/stop", nil))
+	assert.Contains(t, rec.Body.String(), "job stopped")
+	assert.Equal(t, StatusStopped, ff.Status())
+	time.Sleep(100 * time.Millisecond) // 等待Fetcher从阻塞的发送中返回
+
+	closed := make(chan struct{})
+	go func() {
+		for range tw.inbox {
+		}
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("output of fetcher was not closed after stop")
+	}
+}
@@ -0,0 +1,171 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+type (
+	// logFile 透明解压的日志文件
+	logFile struct {
+		io.Reader
+		file        *os.File
+		compression string
+		closers     []func() error
+	}
+
+	// lineReader 按行读取，超过最大长度的行被跳过并计数，避免像bufio.Scanner一样因为一行过长中止读取
+	lineReader struct {
+		r      *bufio.Reader
+		name   string
+		max    int
+		line   []byte
+		offset int64 // 已读取的（解压后）字节数
+		start  int64 // Next返回的行的起始偏移量
+		stats  *LineStats
+	}
+
+	// LineStats 文件类Fetcher的读取统计
+	LineStats struct {
+		Lines     int64 `json:"lines"`     // 读取的行数
+		Oversized int64 `json:"oversized"` // 超过最大长度被跳过的行数
+		Invalid   int64 `json:"invalid"`   // Analyzer无法解析的行数
+	}
+)
+
+var (
+	// FileMaxLineSize 文件类Fetcher默认的最大行长度，超过的行被跳过
+	FileMaxLineSize = 16 << 20
+
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// openLogFile 打开日志文件，按magic bytes识别gzip、zstd、bzip2压缩并透明解压
+func openLogFile(path string) (*logFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	lf := &logFile{file: file, closers: []func() error{file.Close}}
+
+	// 使用ReadAt识别压缩格式，不改变文件偏移量，未压缩的文件可以直接交给follow模式读取
+	magic := make([]byte, 4)
+	n, _ := file.ReadAt(magic, 0)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lf.Reader, lf.compression = gr, "gzip"
+		lf.closers = append(lf.closers, gr.Close)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lf.Reader, lf.compression = zr, "zstd"
+		lf.closers = append(lf.closers, func() error { zr.Close(); return nil })
+	case bytes.HasPrefix(magic, bzip2Magic):
+		lf.Reader, lf.compression = bzip2.NewReader(bufio.NewReader(file)), "bzip2"
+	default:
+		lf.Reader = file
+	}
+	if lf.compression != "" {
+		Logger.Info("decompress log file", zap.String("path", path), zap.String("compression", lf.compression))
+	}
+	return lf, nil
+}
+
+// Compressed 文件是否经过压缩
+func (lf *logFile) Compressed() bool {
+	return lf.compression != ""
+}
+
+// Close 关闭解压器与文件
+func (lf *logFile) Close() error {
+	var err error
+	for i := len(lf.closers) - 1; i >= 0; i-- {
+		if e := lf.closers[i](); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func newLineReader(r io.Reader, name string, max int, stats *LineStats) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64<<10), name: name, max: maxLineSize(max), stats: stats}
+}
+
+func maxLineSize(max int) int {
+	if max <= 0 {
+		return FileMaxLineSize
+	}
+	return max
+}
+
+// skipOversized 记录被跳过的超长行
+func (ls *LineStats) skipOversized(name string, max int) {
+	atomic.AddInt64(&ls.Lines, 1)
+	atomic.AddInt64(&ls.Oversized, 1)
+	Logger.Warn("skip oversized line", zap.String("file", name), zap.Int("max", max))
+}
+
+func (ls *LineStats) load() LineStats {
+	return LineStats{
+		Lines:     atomic.LoadInt64(&ls.Lines),
+		Oversized: atomic.LoadInt64(&ls.Oversized),
+		Invalid:   atomic.LoadInt64(&ls.Invalid),
+	}
+}
+
+// Next 返回下一行（不含换行符），返回值在下次调用前有效，读取完毕时返回io.EOF
+func (lr *lineReader) Next() ([]byte, error) {
+	lr.line = lr.line[:0]
+	lr.start = lr.offset
+	oversized := false
+	for {
+		frag, err := lr.r.ReadSlice('\n')
+		lr.offset += int64(len(frag))
+		if !oversized {
+			lr.line = append(lr.line, frag...)
+			if len(lr.line) > lr.max+2 { // 预留\r\n
+				oversized, lr.line = true, lr.line[:0]
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line := bytes.TrimRight(lr.line, "\r\n")
+		if oversized || len(line) > lr.max {
+			lr.stats.skipOversized(lr.name, lr.max)
+			oversized, lr.line, lr.start = false, lr.line[:0], lr.offset
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			continue
+		}
+		if err == io.EOF && len(lr.line) == 0 {
+			return nil, io.EOF
+		}
+		atomic.AddInt64(&lr.stats.Lines, 1)
+		return line, nil
+	}
+}
@@ -0,0 +1,64 @@
+package dispatcher
+
+import "container/heap"
+
+type (
+	// mergeItem 归并过程中各个日志流的当前队首
+	mergeItem struct {
+		log    *LogRecordWrapper
+		source int
+	}
+
+	// recordHeap 按OccurAt排序的小顶堆，时间相同时按日志流序号排序，保证结果稳定
+	recordHeap []*mergeItem
+)
+
+func (h recordHeap) Len() int { return len(h) }
+
+func (h recordHeap) Less(i, j int) bool {
+	if h[i].log.OccurAt.Equal(h[j].log.OccurAt) {
+		return h[i].source < h[j].source
+	}
+	return h[i].log.OccurAt.Before(h[j].log.OccurAt)
+}
+
+func (h recordHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *recordHeap) Push(x interface{}) { *h = append(*h, x.(*mergeItem)) }
+
+func (h *recordHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// mergeSorted 对多个各自有序的日志流做k路归并，按OccurAt从小到大依次交给emit处理
+//
+// 只有当所有未关闭的日志流都给出了队首时才会弹出最小值（低水位），因此慢的日志流会阻塞整体输出，但不会造成乱序。
+// emit返回false时立即终止归并并返回false，日志流全部关闭后返回true
+func mergeSorted(sources []<-chan *LogRecordWrapper, emit func(*LogRecordWrapper) bool) bool {
+	h := make(recordHeap, 0, len(sources))
+	for i, src := range sources {
+		if log, ok := <-src; ok {
+			h = append(h, &mergeItem{log: log, source: i})
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		item := h[0]
+		if !emit(item.log) {
+			return false
+		}
+		if log, ok := <-sources[item.source]; ok {
+			item.log = log
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return true
+}
@@ -0,0 +1,500 @@
+package dispatcher
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// packetSource 抓包文件读取接口，读取完毕时返回io.EOF
+	packetSource interface {
+		next() (*rawPacket, error)
+	}
+
+	// rawPacket 抓包文件中的单个数据包
+	rawPacket struct {
+		ts       time.Time
+		linkType uint32
+		data     []byte
+	}
+
+	// pcapReader 经典pcap格式（tcpdump -w）
+	pcapReader struct {
+		r        *bufio.Reader
+		order    binary.ByteOrder
+		nano     bool
+		linkType uint32
+		header   [16]byte
+	}
+
+	// pcapngReader pcapng格式，只处理Enhanced Packet Block
+	pcapngReader struct {
+		r          *bufio.Reader
+		order      binary.ByteOrder
+		interfaces []*pcapngInterface
+	}
+
+	pcapngInterface struct {
+		linkType uint32
+		tsresol  uint8
+	}
+
+	// tcpPacket 解析后的TCP数据包
+	tcpPacket struct {
+		ts      time.Time
+		src     net.IP
+		dst     net.IP
+		srcPort uint16
+		dstPort uint16
+		seq     uint32
+		syn     bool
+		fin     bool
+		rst     bool
+		payload []byte
+	}
+
+	// packetFilter 类BPF语法编译出的过滤函数
+	packetFilter func(*tcpPacket) bool
+
+	filterParser struct {
+		tokens []string
+		pos    int
+	}
+)
+
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+
+	pcapngSectionHeader   = 0x0A0D0D0A
+	pcapngInterfaceDesc   = 0x00000001
+	pcapngEnhancedPacket  = 0x00000006
+	pcapngByteOrderMagic  = 0x1A2B3C4D
+	pcapngOptionTSResol   = 9
+	pcapMaxPacketSize     = 256 << 10
+	pcapngMaxBlockSize    = 16 << 20
+	ipProtocolTCP         = 6
+	ipv6HeaderHopByHop    = 0
+	ipv6HeaderRouting     = 43
+	ipv6HeaderFragment    = 44
+	ipv6HeaderDestination = 60
+)
+
+var errBadCapture = errors.New("bad capture file")
+
+// newPacketSource 根据文件头识别pcap或pcapng格式
+func newPacketSource(r io.Reader) (packetSource, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		return &pcapngReader{r: br}, nil
+	}
+
+	pr := &pcapReader{r: br}
+	switch binary.LittleEndian.Uint32(magic) {
+	case 0xa1b2c3d4:
+		pr.order = binary.LittleEndian
+	case 0xa1b23c4d:
+		pr.order, pr.nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		pr.order = binary.BigEndian
+	case 0x4d3cb2a1:
+		pr.order, pr.nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("unknown capture file magic: %x", magic)
+	}
+
+	header := make([]byte, 24)
+	if _, err = io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	pr.linkType = pr.order.Uint32(header[20:24])
+	return pr, nil
+}
+
+func (pr *pcapReader) next() (*rawPacket, error) {
+	if _, err := io.ReadFull(pr.r, pr.header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF // 抓包被中断时最后一个包可能不完整
+		}
+		return nil, err
+	}
+	sec := int64(pr.order.Uint32(pr.header[0:4]))
+	frac := int64(pr.order.Uint32(pr.header[4:8]))
+	length := pr.order.Uint32(pr.header[8:12])
+	if length > pcapMaxPacketSize {
+		return nil, errBadCapture
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return nil, io.EOF
+	}
+	if !pr.nano {
+		frac *= 1e3
+	}
+	return &rawPacket{ts: time.Unix(sec, frac), linkType: pr.linkType, data: data}, nil
+}
+
+func (pn *pcapngReader) next() (*rawPacket, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(pn.r, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+
+		if binary.LittleEndian.Uint32(header[0:4]) == pcapngSectionHeader {
+			magic, err := pn.r.Peek(4)
+			if err != nil {
+				return nil, io.EOF
+			}
+			switch binary.LittleEndian.Uint32(magic) {
+			case pcapngByteOrderMagic:
+				pn.order = binary.LittleEndian
+			case 0x4D3C2B1A:
+				pn.order = binary.BigEndian
+			default:
+				return nil, errBadCapture
+			}
+			pn.interfaces = nil
+		}
+		if pn.order == nil {
+			return nil, errBadCapture
+		}
+
+		blockType := pn.order.Uint32(header[0:4])
+		length := pn.order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 || length > pcapngMaxBlockSize {
+			return nil, errBadCapture
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(pn.r, body); err != nil {
+			return nil, io.EOF
+		}
+		body = body[:len(body)-4] // 结尾重复的block长度
+
+		switch blockType {
+		case pcapngInterfaceDesc:
+			if len(body) < 8 {
+				return nil, errBadCapture
+			}
+			iface := &pcapngInterface{linkType: uint32(pn.order.Uint16(body[0:2])), tsresol: 6}
+			for opts := body[8:]; len(opts) >= 4; {
+				code, size := pn.order.Uint16(opts[0:2]), int(pn.order.Uint16(opts[2:4]))
+				if code == 0 || len(opts) < 4+size {
+					break
+				}
+				if code == pcapngOptionTSResol && size >= 1 {
+					iface.tsresol = opts[4]
+				}
+				opts = opts[4+(size+3)/4*4:]
+			}
+			pn.interfaces = append(pn.interfaces, iface)
+
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return nil, errBadCapture
+			}
+			id := pn.order.Uint32(body[0:4])
+			if int(id) >= len(pn.interfaces) {
+				return nil, errBadCapture
+			}
+			iface := pn.interfaces[id]
+			ts := uint64(pn.order.Uint32(body[4:8]))<<32 | uint64(pn.order.Uint32(body[8:12]))
+			capLen := pn.order.Uint32(body[12:16])
+			if int(capLen) > len(body)-20 {
+				return nil, errBadCapture
+			}
+			return &rawPacket{ts: iface.timestamp(ts), linkType: iface.linkType, data: body[20 : 20+capLen]}, nil
+		}
+	}
+}
+
+// timestamp 根据if_tsresol换算时间戳，最高位为0时表示10的负n次方秒，否则为2的负n次方秒
+func (pi *pcapngInterface) timestamp(ts uint64) time.Time {
+	n := uint(pi.tsresol & 0x7f)
+	if pi.tsresol&0x80 == 0 {
+		unit := uint64(1)
+		for i := uint(0); i < n; i++ {
+			unit *= 10
+		}
+		sec := ts / unit
+		frac := ts % unit
+		for ; n < 9; n++ {
+			frac *= 10
+		}
+		for ; n > 9; n-- {
+			frac /= 10
+		}
+		return time.Unix(int64(sec), int64(frac))
+	}
+	if n > 32 {
+		return time.Unix(int64(ts>>n), 0)
+	}
+	return time.Unix(int64(ts>>n), int64((ts&(1<<n-1))*1e9>>n))
+}
+
+// decodeTCP 从链路层数据中解析出TCP数据包，非TCP或者IP分片的数据包返回false
+func decodeTCP(p *rawPacket) (*tcpPacket, bool) {
+	data := p.data
+	switch p.linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 { // VLAN
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86DD {
+			return nil, false
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		data = data[20:]
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return nil, false
+		}
+		data = data[4:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6, 12, 14:
+	default:
+		return nil, false
+	}
+
+	if len(data) < 1 {
+		return nil, false
+	}
+	tp := &tcpPacket{ts: p.ts}
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		if data[9] != ipProtocolTCP || ihl < 20 || total < ihl || len(data) < ihl {
+			return nil, false
+		}
+		if binary.BigEndian.Uint16(data[6:8])&0x3fff != 0 { // MF标记或者分片偏移
+			return nil, false
+		}
+		if total < len(data) {
+			data = data[:total] // 以太网帧的填充字节
+		}
+		tp.src, tp.dst = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:]
+	case 6:
+		if len(data) < 40 {
+			return nil, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+		next := data[6]
+		tp.src, tp.dst = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40:]
+		if payloadLen < len(data) {
+			data = data[:payloadLen]
+		}
+		for next == ipv6HeaderHopByHop || next == ipv6HeaderRouting || next == ipv6HeaderDestination {
+			if len(data) < 8 {
+				return nil, false
+			}
+			size := (int(data[1]) + 1) * 8
+			if len(data) < size {
+				return nil, false
+			}
+			next, data = data[0], data[size:]
+		}
+		if next != ipProtocolTCP {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if len(data) < 20 {
+		return nil, false
+	}
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || len(data) < offset {
+		return nil, false
+	}
+	tp.srcPort = binary.BigEndian.Uint16(data[0:2])
+	tp.dstPort = binary.BigEndian.Uint16(data[2:4])
+	tp.seq = binary.BigEndian.Uint32(data[4:8])
+	flags := data[13]
+	tp.fin, tp.syn, tp.rst = flags&0x01 != 0, flags&0x02 != 0, flags&0x04 != 0
+	tp.payload = data[offset:]
+	return tp, true
+}
+
+// compilePacketFilter 编译类BPF语法的过滤表达式，支持[src|dst] host/port/net、tcp，以及and/or/not和括号，如
+//
+//	tcp port 8080 and (dst host 10.0.0.1 or dst net 10.1.0.0/16) and not src port 22
+func compilePacketFilter(expr string) (packetFilter, error) {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ", "&&", " and ", "||", " or ", "!", " not ").Replace(expr)
+	p := &filterParser{tokens: strings.Fields(expr)}
+	if len(p.tokens) == 0 {
+		return func(*tcpPacket) bool { return true }, nil
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("packet filter: unexpected %q", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *filterParser) take() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) parseOr() (packetFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tp *tcpPacket) bool { return l(tp) || right(tp) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (packetFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "and":
+			p.take()
+		case "", "or", ")":
+			return left, nil
+		} // tcpdump允许省略and，如tcp port 80
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tp *tcpPacket) bool { return l(tp) && right(tp) }
+	}
+}
+
+func (p *filterParser) parseNot() (packetFilter, error) {
+	switch p.peek() {
+	case "not":
+		p.take()
+		f, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(tp *tcpPacket) bool { return !f(tp) }, nil
+	case "(":
+		p.take()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.take() != ")" {
+			return nil, errors.New("packet filter: missing ')'")
+		}
+		return f, nil
+	}
+	return p.parsePrimitive()
+}
+
+func (p *filterParser) parsePrimitive() (packetFilter, error) {
+	dir := ""
+	if t := p.peek(); t == "src" || t == "dst" {
+		dir = p.take()
+	}
+
+	kind := p.take()
+	if kind == "tcp" && dir == "" {
+		return func(*tcpPacket) bool { return true }, nil
+	}
+	value := p.take()
+	if value == "" {
+		return nil, fmt.Errorf("packet filter: missing value after %q", kind)
+	}
+
+	var match func(ip net.IP, port uint16) bool
+	switch kind {
+	case "host":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("packet filter: bad host %q", value)
+		}
+		match = func(addr net.IP, _ uint16) bool { return addr.Equal(ip) }
+	case "net":
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("packet filter: bad net %q", value)
+		}
+		match = func(addr net.IP, _ uint16) bool { return n.Contains(addr) }
+	case "port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("packet filter: bad port %q", value)
+		}
+		match = func(_ net.IP, p uint16) bool { return p == uint16(port) }
+	default:
+		return nil, fmt.Errorf("packet filter: unknown primitive %q", kind)
+	}
+
+	switch dir {
+	case "src":
+		return func(tp *tcpPacket) bool { return match(tp.src, tp.srcPort) }, nil
+	case "dst":
+		return func(tp *tcpPacket) bool { return match(tp.dst, tp.dstPort) }, nil
+	default:
+		return func(tp *tcpPacket) bool { return match(tp.src, tp.srcPort) || match(tp.dst, tp.dstPort) }, nil
+	}
+}
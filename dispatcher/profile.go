@@ -0,0 +1,281 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// LoadProfile 负载曲线，按任务的运行时间（不含暂停）确定性地调整Rate或者Speed，每次变化都通过JobConfiguration事件下发给replayer
+	//
+	//	ramp        在duration内从from线性变化到to，之后保持to
+	//	steps       依次保持每一级的value，时长为hold，最后一级之后保持不变
+	//	target_qps  按TimeWheel实际分发的QPS调整Rate，使replayer发出的请求总数接近qps，与原始日志的疏密无关
+	LoadProfile struct {
+		Type     string     `toml:"type" json:"type"`
+		Target   string     `toml:"target" json:"target"` // rate（默认）或者speed，target_qps只调整rate
+		From     float32    `toml:"from" json:"from"`
+		To       float32    `toml:"to" json:"to"`
+		Duration int64      `toml:"duration" json:"duration"` // 毫秒
+		Steps    []LoadStep `toml:"steps" json:"steps"`
+		QPS      float64    `toml:"qps" json:"qps"`
+		Interval int64      `toml:"interval" json:"interval"` // 调整间隔，毫秒，默认为LoadProfileInterval
+	}
+
+	// LoadStep steps曲线中的一级
+	LoadStep struct {
+		Value float32 `toml:"value" json:"value"`
+		Hold  int64   `toml:"hold" json:"hold"` // 毫秒
+	}
+
+	// LoadProfileState 负载曲线的执行状态
+	LoadProfileState struct {
+		Profile     *LoadProfile `json:"profile"`
+		Elapsed     int64        `json:"elapsed"` // 已运行的时间，毫秒，不含暂停
+		Rate        float32      `json:"rate"`
+		Speed       float32      `json:"speed"`
+		DispatchQPS float64      `json:"dispatch_qps"` // 最近一个调整间隔内TimeWheel分发的QPS
+	}
+
+	// profileRunner 正在执行的负载曲线，替换时关闭stop
+	profileRunner struct {
+		profile *LoadProfile
+		stop    chan struct{}
+		mu      sync.Mutex
+		elapsed time.Duration
+		qps     float64
+	}
+)
+
+const (
+	// LoadProfileRamp 线性变化
+	LoadProfileRamp = "ramp"
+	// LoadProfileSteps 阶梯
+	LoadProfileSteps = "steps"
+	// LoadProfileTargetQPS 目标QPS
+	LoadProfileTargetQPS = "target_qps"
+
+	// LoadTargetRate 调整replayer的回放倍率
+	LoadTargetRate = "rate"
+	// LoadTargetSpeed 调整TimeWheel的回放倍速
+	LoadTargetSpeed = "speed"
+)
+
+var (
+	// LoadProfileInterval 负载曲线默认的调整间隔
+	LoadProfileInterval = time.Second
+	// LoadProfileMinRate target_qps模式下Rate的下限
+	LoadProfileMinRate float32 = 0.01
+	// LoadProfileMaxRate target_qps模式下Rate的上限，避免日志稀疏时单条日志被放大过多
+	LoadProfileMaxRate float32 = 100
+)
+
+// Validate 检查负载曲线的配置，并填充默认值
+func (p *LoadProfile) Validate() error {
+	if p.Target == "" {
+		p.Target = LoadTargetRate
+	}
+	if p.Target != LoadTargetRate && p.Target != LoadTargetSpeed {
+		return fmt.Errorf("unknown target of load profile: %s", p.Target)
+	}
+	if p.Interval < 0 {
+		return errors.New("interval of load profile must not be negative")
+	}
+
+	switch p.Type {
+	case LoadProfileRamp:
+		if p.From <= 0 || p.To <= 0 || p.Duration <= 0 {
+			return errors.New("ramp profile requires positive from, to and duration")
+		}
+	case LoadProfileSteps:
+		if len(p.Steps) == 0 {
+			return errors.New("steps profile requires at least one step")
+		}
+		for i, s := range p.Steps {
+			if s.Value <= 0 || s.Hold < 0 {
+				return fmt.Errorf("bad step #%d of load profile", i)
+			}
+		}
+	case LoadProfileTargetQPS:
+		if p.QPS <= 0 {
+			return errors.New("target_qps profile requires positive qps")
+		}
+		if p.Target != LoadTargetRate {
+			return errors.New("target_qps profile only adjusts rate")
+		}
+	default:
+		return fmt.Errorf("unknown type of load profile: %s", p.Type)
+	}
+	return nil
+}
+
+func (p *LoadProfile) interval() time.Duration {
+	if p.Interval > 0 {
+		return time.Duration(p.Interval) * time.Millisecond
+	}
+	return LoadProfileInterval
+}
+
+// value 返回运行elapsed之后的取值，target_qps模式根据分发的QPS计算Rate，qps为0时返回0表示保持不变
+func (p *LoadProfile) value(elapsed time.Duration, qps float64) float32 {
+	ms := elapsed.Milliseconds()
+	switch p.Type {
+	case LoadProfileRamp:
+		if ms >= p.Duration {
+			return p.To
+		}
+		return p.From + (p.To-p.From)*float32(ms)/float32(p.Duration)
+	case LoadProfileSteps:
+		for _, s := range p.Steps {
+			if ms < s.Hold {
+				return s.Value
+			}
+			ms -= s.Hold
+		}
+		return p.Steps[len(p.Steps)-1].Value
+	case LoadProfileTargetQPS:
+		if qps <= 0 {
+			return 0
+		}
+		rate := float32(p.QPS / qps)
+		return float32(math.Max(float64(LoadProfileMinRate), math.Min(float64(LoadProfileMaxRate), float64(rate))))
+	}
+	return 0
+}
+
+// WithLoadProfile 设置负载曲线，任务开始时执行，配置有误时返回error
+func (job *Job) WithLoadProfile(p *LoadProfile) (*Job, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	job.lock.Lock()
+	job.profile = &profileRunner{profile: p, stop: make(chan struct{})}
+	job.lock.Unlock()
+	return job, nil
+}
+
+// replaceLoadProfile 替换正在执行的负载曲线，新的曲线从头开始计时
+func (job *Job) replaceLoadProfile(p *LoadProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	runner := &profileRunner{profile: p, stop: make(chan struct{})}
+	job.lock.Lock()
+	if job.profile != nil {
+		close(job.profile.stop)
+	}
+	job.profile = runner
+	job.lock.Unlock()
+
+	if job.Status() == StatusRunning {
+		go job.runLoadProfile(runner)
+	}
+	Logger.Info("load profile is replaced", zap.Any("profile", p))
+	return nil
+}
+
+// LoadProfileState 返回负载曲线的执行状态，没有设置负载曲线时返回nil
+func (job *Job) LoadProfileState() *LoadProfileState {
+	job.lock.Lock()
+	runner := job.profile
+	state := &LoadProfileState{Rate: job.Configuration.Rate, Speed: job.Configuration.Speed}
+	job.lock.Unlock()
+	if runner == nil {
+		return nil
+	}
+	runner.mu.Lock()
+	state.Profile, state.Elapsed, state.DispatchQPS = runner.profile, runner.elapsed.Milliseconds(), runner.qps
+	runner.mu.Unlock()
+	return state
+}
+
+// runLoadProfile 按间隔调整Rate或者Speed，TimeWheel暂停期间不计时，任务结束或者曲线被替换时退出
+func (job *Job) runLoadProfile(runner *profileRunner) {
+	p := runner.profile
+	interval := p.interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if p.Type != LoadProfileTargetQPS {
+		job.applyLoadProfile(p, p.value(0, 0))
+	}
+	last := atomic.LoadInt64(&job.timeWheel.counter)
+	for {
+		select {
+		case <-runner.stop:
+			return
+		case <-ticker.C:
+		}
+		if job.Status() != StatusRunning {
+			return
+		}
+		current := atomic.LoadInt64(&job.timeWheel.counter)
+		dispatched := current - last
+		last = current
+		if job.timeWheel.Status() == StatusPaused {
+			continue
+		}
+
+		runner.mu.Lock()
+		runner.elapsed += interval
+		runner.qps = float64(dispatched) / interval.Seconds()
+		elapsed, qps := runner.elapsed, runner.qps
+		runner.mu.Unlock()
+		job.applyLoadProfile(p, p.value(elapsed, qps))
+	}
+}
+
+// applyLoadProfile 取值发生变化时更新任务配置并下发给replayer
+func (job *Job) applyLoadProfile(p *LoadProfile, value float32) {
+	if value <= 0 {
+		return
+	}
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if p.Target == LoadTargetSpeed {
+		if job.Configuration.Speed == value {
+			return
+		}
+		job.Configuration.Speed = value
+		job.timeWheel.setSpeed(value)
+	} else {
+		if job.Configuration.Rate == value {
+			return
+		}
+		job.Configuration.Rate = value
+	}
+	job.Havok.Broadcast(&pb.DispatcherEvent{
+		Type: pb.DispatcherEvent_JobConfiguration,
+		Data: &pb.DispatcherEvent_Job{Job: job.Configuration},
+	})
+	Logger.Info("load profile refreshed job configuration", zap.String("type", p.Type), zap.String("target", p.Target),
+		zap.Float32("value", value))
+}
+
+// provideLoadProfile /api/job/profile，GET返回执行状态，POST替换负载曲线
+func (job *Job) provideLoadProfile(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		p := new(LoadProfile)
+		if err := json.NewDecoder(req.Body).Decode(p); err != nil {
+			renderError(w, err)
+			return
+		}
+		if err := job.replaceLoadProfile(p); err != nil {
+			renderError(w, err)
+			return
+		}
+	}
+	renderJSON(w, &struct {
+		Code int               `json:"code"`
+		Data *LoadProfileState `json:"data"`
+	}{Code: http.StatusOK, Data: job.LoadProfileState()})
+}
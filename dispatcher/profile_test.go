@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestLoadProfile_Value(t *testing.T) {
+	ramp := &LoadProfile{Type: LoadProfileRamp, From: 0.2, To: 3, Duration: 30 * 60 * 1000}
+	assert.Nil(t, ramp.Validate())
+	assert.Equal(t, LoadTargetRate, ramp.Target)
+	assert.InDelta(t, 0.2, ramp.value(0, 0), 1e-6)
+	assert.InDelta(t, 1.6, ramp.value(15*time.Minute, 0), 1e-6)
+	assert.InDelta(t, 3, ramp.value(time.Hour, 0), 1e-6)
+
+	steps := &LoadProfile{Type: LoadProfileSteps, Target: LoadTargetSpeed, Steps: []LoadStep{{1, 300000}, {2, 300000}, {4, 300000}}}
+	assert.Nil(t, steps.Validate())
+	assert.EqualValues(t, 1, steps.value(0, 0))
+	assert.EqualValues(t, 2, steps.value(5*time.Minute, 0))
+	assert.EqualValues(t, 4, steps.value(14*time.Minute, 0))
+	assert.EqualValues(t, 4, steps.value(time.Hour, 0))
+
+	target := &LoadProfile{Type: LoadProfileTargetQPS, QPS: 500}
+	assert.Nil(t, target.Validate())
+	assert.EqualValues(t, 0, target.value(time.Second, 0)) // 没有分发时保持不变
+	assert.EqualValues(t, 2.5, target.value(time.Second, 200))
+	assert.EqualValues(t, LoadProfileMaxRate, target.value(time.Second, 1))
+}
+
+func TestLoadProfile_Validate(t *testing.T) {
+	for _, p := range []*LoadProfile{
+		{},
+		{Type: "sine"},
+		{Type: LoadProfileRamp, From: 1, To: 2},
+		{Type: LoadProfileRamp, From: 0, To: 2, Duration: 1000},
+		{Type: LoadProfileSteps},
+		{Type: LoadProfileSteps, Steps: []LoadStep{{0, 1000}}},
+		{Type: LoadProfileTargetQPS},
+		{Type: LoadProfileTargetQPS, QPS: 10, Target: LoadTargetSpeed},
+		{Type: LoadProfileRamp, From: 1, To: 2, Duration: 1000, Target: "stuck"},
+	} {
+		assert.NotNil(t, p.Validate(), p.Type)
+	}
+}
+
+func TestJob_LoadProfile(t *testing.T) {
+	conf := &pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1}
+	job, err := NewJob(conf)
+	assert.Nil(t, err)
+	tw, _ := NewTimeWheel(conf)
+	job.WithTimeWheel(tw).WithHavok(DefaultHavok)
+	_, err = job.WithLoadProfile(&LoadProfile{Type: LoadProfileSteps, Target: LoadTargetSpeed, Interval: 10,
+		Steps: []LoadStep{{2, 50}, {4, 50}}})
+	assert.Nil(t, err)
+
+	atomic.StoreInt32(&job.status, StatusRunning)
+	go job.runLoadProfile(job.profile)
+	time.Sleep(200 * time.Millisecond)
+	state := job.LoadProfileState()
+	assert.EqualValues(t, 4, state.Speed)
+	assert.True(t, state.Elapsed >= 100, state.Elapsed)
+
+	// 替换为新的曲线，从头开始计时
+	rec := httptest.NewRecorder()
+	job.provideLoadProfile(rec, httptest.NewRequest("POST", "/api/job/profile",
+		strings.NewReader(`{"type": "ramp", "from": 3, "to": 3, "duration": 1000, "interval": 10}`)))
+	assert.Contains(t, rec.Body.String(), `"type":"ramp"`)
+	time.Sleep(50 * time.Millisecond)
+	state = job.LoadProfileState()
+	assert.EqualValues(t, 3, state.Rate)
+	assert.EqualValues(t, 4, state.Speed)
+	assert.True(t, state.Elapsed < 100, state.Elapsed)
+
+	rec = httptest.NewRecorder()
+	job.provideLoadProfile(rec, httptest.NewRequest("POST", "/api/job/profile", strings.NewReader(`{"type": "sine"}`)))
+	assert.Contains(t, rec.Body.String(), "unknown type")
+	atomic.StoreInt32(&job.status, StatusStopped)
+}
@@ -22,6 +22,7 @@ type (
 		lastCompletedBatch int32 // 最后完成的批次
 		signal             chan int32
 		lastReport         types.Report
+		sources            map[string]func() map[string]float64 // dispatcher自身的性能统计，与replayer的统计分开交给ReportHandler
 		mu                 sync.RWMutex
 	}
 
@@ -65,6 +66,17 @@ func (r *Reporter) WithReplayerManager(rm *ReplayerManager) {
 	}
 }
 
+// WithPerformanceSource 添加dispatcher自身的性能统计，每个批次以name为键写入PerformanceStat.Dispatcher交给ReportHandler
+func (r *Reporter) WithPerformanceSource(name string, f func() map[string]float64) *Reporter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sources == nil {
+		r.sources = map[string]func() map[string]float64{}
+	}
+	r.sources[name] = f
+	return r
+}
+
 func (r *Reporter) PeriodicRequest() {
 	for {
 		time.Sleep(r.CollectInterval)
@@ -134,6 +146,9 @@ func (r *Reporter) Run() {
 
 		res := r.reservoirs[batch]
 		r.lastReport = res.summary.Report(false)
+		for name, f := range r.sources {
+			res.perfStat.Dispatcher[name] = f()
+		}
 		if !res.summary.IsZero() {
 			go func(report types.Report, perfStat types.PerformanceStat) {
 				for _, h := range r.ReportHandler {
@@ -173,7 +188,7 @@ func newReservoir(expected int32, timeout time.Duration) *reservoir {
 		expected: expected,
 		since:    time.Now(),
 		timeout:  timeout,
-		perfStat: types.PerformanceStat{Stats: make(map[string]map[string]float64)},
+		perfStat: types.PerformanceStat{Stats: make(map[string]map[string]float64), Dispatcher: make(map[string]map[string]float64)},
 	}
 }
 
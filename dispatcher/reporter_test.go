@@ -0,0 +1,33 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+	"github.com/wosai/havok/types"
+)
+
+func TestReporter_PerformanceSource(t *testing.T) {
+	perfStats := make(chan types.PerformanceStat, 1)
+	r := NewReporter(nil, func(_ types.Report, perfStat types.PerformanceStat) { perfStats <- perfStat })
+	r.WithPerformanceSource("timewheel", func() map[string]float64 { return map[string]float64{"idle_gaps": 2} })
+	go r.Run()
+
+	r.mu.Lock()
+	r.reservoirs[1] = newReservoir(1, time.Second)
+	r.mu.Unlock()
+	now := time.Now().UnixNano() / 1e6
+	r.Collect("replayer-1", 1, map[string]float64{"cpu": 0.5}, &pb.AttackerStatsWrapper{
+		Name: "/pay", Requests: 1, TrendSuccess: map[int64]int64{}, StartTime: now, LastRequestTime: now})
+
+	// dispatcher自身的统计与replayer的统计分开
+	select {
+	case perfStat := <-perfStats:
+		assert.Equal(t, map[string]map[string]float64{"replayer-1": {"cpu": 0.5}}, perfStat.Stats)
+		assert.Equal(t, map[string]map[string]float64{"timewheel": {"idle_gaps": 2}}, perfStat.Dispatcher)
+	case <-time.After(time.Second):
+		t.Fatal("report handler was not called")
+	}
+}
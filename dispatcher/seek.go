@@ -0,0 +1,111 @@
+package dispatcher
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// Seeker 可以在运行中重新定位读取位置的Fetcher
+	//
+	// 每次重新定位都有一个递增的epoch，之后输出的日志带有该epoch，TimeWheel与ReorderStage据此丢弃重新定位之前读取的日志
+	Seeker interface {
+		// Seek 从日志时间at重新读取，读取已经结束时返回error。请求由Fetcher的读取循环异步处理
+		Seek(at time.Time, epoch int64) error
+	}
+)
+
+var (
+	// ErrSeekUnavailable Fetcher未在运行或者已经读取完毕，无法重新定位
+	ErrSeekUnavailable = errors.New("fetcher is not running, could not seek")
+
+	// errSeekPending 读取循环因重新定位请求而中断
+	errSeekPending = errors.New("seek is pending")
+)
+
+// requestSeek 记录重新定位请求，多次请求时只保留最后一次
+func (bf *baseFetcher) requestSeek(at time.Time, epoch int64) error {
+	bf.seekMu.Lock()
+	defer bf.seekMu.Unlock()
+	if bf.Status() != StatusRunning || bf.sealed {
+		return ErrSeekUnavailable
+	}
+	bf.seekTo, bf.seekEpoch, bf.seeking = at, epoch, true
+	return nil
+}
+
+// seekPending 是否有尚未处理的重新定位请求，读取循环据此中断当前的读取
+func (bf *baseFetcher) seekPending() bool {
+	bf.seekMu.Lock()
+	defer bf.seekMu.Unlock()
+	return bf.seeking
+}
+
+// applySeek 取出重新定位请求，更新开始时间与epoch；没有请求时返回false，seal为true时之后的请求都返回ErrSeekUnavailable，
+// 读取完毕时使用，避免请求在Finish之前到达而被忽略
+func (bf *baseFetcher) applySeek(seal bool) bool {
+	bf.seekMu.Lock()
+	defer bf.seekMu.Unlock()
+	if !bf.seeking {
+		bf.sealed = seal
+		return false
+	}
+	bf.begin, bf.epoch, bf.seeking = bf.seekTo, bf.seekEpoch, false
+	Logger.Info("fetcher seeks to new position", zap.Time("at", bf.begin), zap.Int64("epoch", bf.epoch))
+	return true
+}
+
+// seek 通知TimeWheel丢弃epoch之前的日志，新位置的第一条日志到达时回放时钟重新开始
+func (tw *TimeWheel) seek(epoch int64) {
+	for current := atomic.LoadInt64(&tw.epoch); current < epoch; current = atomic.LoadInt64(&tw.epoch) {
+		if atomic.CompareAndSwapInt64(&tw.epoch, current, epoch) {
+			break
+		}
+	}
+	tw.wakeup()
+}
+
+// stale 日志是否在重新定位之前读取
+func (tw *TimeWheel) stale(log *LogRecordWrapper) bool {
+	return log.epoch < atomic.LoadInt64(&tw.epoch)
+}
+
+// Seek 将运行中的任务重新定位到日志时间to，Fetcher须实现Seeker
+//
+// 已经进入Stage与TimeWheel的日志被丢弃，回放时钟从新位置的第一条日志重新开始，暂停中的任务保持暂停；
+// 任务配置的Begin更新为to，并通过JobConfiguration事件通知replayer，不影响replayer的订阅
+func (job *Job) Seek(to time.Time) error {
+	if job.Status() != StatusRunning {
+		return errors.New("bad job status")
+	}
+	seeker, ok := job.fetcher.(Seeker)
+	if !ok {
+		return errors.New("fetcher does not support seek")
+	}
+	if to.IsZero() || to.After(parseJobEnd(job.Configuration.End)) {
+		return errors.New("seek position is out of time range of job")
+	}
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	epoch := job.epoch + 1
+	if err := seeker.Seek(to, epoch); err != nil {
+		return err
+	}
+	job.epoch = epoch
+	job.timeWheel.seek(epoch)
+	if job.checkpoint != nil {
+		job.checkpoint.reset()
+	}
+	job.Configuration.Begin = to.UnixNano() / 1e6
+	job.Havok.Broadcast(&pb.DispatcherEvent{
+		Type: pb.DispatcherEvent_JobConfiguration,
+		Data: &pb.DispatcherEvent_Job{Job: job.Configuration},
+	})
+	Logger.Info("job seeks to new position", zap.Time("at", to), zap.Int64("epoch", epoch))
+	return nil
+}
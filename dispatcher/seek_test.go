@@ -0,0 +1,127 @@
+package dispatcher
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+// seekFetcher 读取第一条日志后重新定位到at，返回重新定位之后的日志
+func seekFetcher(t *testing.T, f Fetcher, at time.Time) []*LogRecordWrapper {
+	output := make(chan *LogRecordWrapper)
+	f.SetOutput(output)
+	done := make(chan error)
+	go func() { done <- f.Start() }()
+
+	first := <-output
+	assert.EqualValues(t, 0, first.epoch)
+	assert.Nil(t, f.(Seeker).Seek(at, 1))
+
+	var logs []*LogRecordWrapper
+	for log := range output {
+		if log.epoch == 1 {
+			logs = append(logs, log)
+		}
+	}
+	assert.Nil(t, <-done)
+	assert.Equal(t, ErrSeekUnavailable, f.(Seeker).Seek(at, 2))
+	return logs
+}
+
+func TestFileFetcher_SeekRunning(t *testing.T) {
+	path := writeTestLog(t, t.TempDir(), "access.log", "1000 /a1", "2000 /a2", "3000 /a3", "4000 /a4", "5000 /a5")
+	ff := NewFileFetcher(path).withTestAnalyzer()
+	ff.TimeRange(ParseMSec(3000), ParseMSec(10000))
+
+	// 向前重新定位到开始时间之前
+	logs := seekFetcher(t, ff, ParseMSec(2000))
+	assert.Equal(t, []int64{2000, 3000, 4000, 5000}, occurAtMSec(logs))
+
+	assert.NotNil(t, NewFileFetcher(path).WithFollow(0).Seek(ParseMSec(2000), 1))
+}
+
+func TestMultipleFilesFetcher_Seek(t *testing.T) {
+	dir := t.TempDir()
+	writeTestLog(t, dir, "node1.log", "1000 /a1", "3000 /a3", "5000 /a5", "7000 /a7")
+	writeTestLog(t, dir, "node2.log", "2000 /b2", "4000 /b4", "6000 /b6")
+	mff, err := NewMultipleFilesFetcher(filepath.Join(dir, "*.log"))
+	assert.Nil(t, err)
+	analyzer := NewBaseAnalyzer()
+	analyzer.Use(msecAnalyzeFunc)
+	mff.WithAnalyzer(analyzer)
+	mff.TimeRange(ParseMSec(1000), ParseMSec(10000))
+
+	logs := seekFetcher(t, mff, ParseMSec(4500))
+	assert.Equal(t, []int64{5000, 6000, 7000}, occurAtMSec(logs))
+}
+
+func TestSyntheticFetcher_Seek(t *testing.T) {
+	sf, err := NewSyntheticFetcher([]*SyntheticTemplate{{URL: "http://api.example.com/"}}, 1)
+	assert.Nil(t, err)
+	_, err = sf.WithShape([]SyntheticPoint{{At: 0, QPS: 1}, {At: 9000, QPS: 1}, {At: 9001, QPS: 2}})
+	assert.Nil(t, err)
+	begin := time.Unix(1606118400, 0)
+	sf.TimeRange(begin, begin.Add(12*time.Second))
+
+	// QPS曲线仍以最初的开始时间为起点
+	logs := seekFetcher(t, sf, begin.Add(10*time.Second))
+	assert.Len(t, logs, 5)
+	assert.Equal(t, begin.Add(10*time.Second), logs[0].OccurAt)
+	assert.Equal(t, begin.Add(11*time.Second), logs[2].OccurAt)
+}
+
+func TestTimeWheel_Seek(t *testing.T) {
+	tw, _ := NewTimeWheel(&pb.JobConfiguration{
+		Rate:  1.0,
+		Begin: replayBegin,
+		End:   replayEnd,
+		Speed: 1.0,
+	})
+	tw.WithHavok(DefaultHavok)
+
+	var sent []*LogRecordWrapper
+	tw.dispatched = func(log *LogRecordWrapper) { sent = append(sent, log) }
+	go func() {
+		tw.Recv() <- genLogRecord(replayBegin + 1000)
+		tw.Recv() <- genLogRecord(replayBegin + 30000) // 等待期间重新定位，不再分发
+		tw.Recv() <- genLogRecord(replayBegin + 31000)
+		time.Sleep(100 * time.Millisecond)
+		tw.seek(1)
+		for _, ms := range []int64{0, 100} { // 早于任务开始时间，向前重新定位
+			log := genLogRecord(replayBegin - 5000 + ms)
+			log.epoch = 1
+			tw.Recv() <- log
+		}
+		close(tw.inbox)
+	}()
+
+	start := time.Now()
+	assert.Nil(t, tw.Start())
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, []int64{replayBegin + 1000, replayBegin - 5000, replayBegin - 4900}, occurAtMSec(sent))
+}
+
+func TestReorderStage_Seek(t *testing.T) {
+	logs := msecLogs(5000, 6000, 7000, 1000, 2000)
+	for _, log := range logs[3:] {
+		log.epoch = 1
+	}
+	result := runStage(t, NewReorderStage(10*time.Second), logs...)
+	assert.Equal(t, []int64{1000, 2000}, occurAtMSec(result))
+	assert.EqualValues(t, 1, result[0].epoch)
+}
+
+func TestJob_Seek(t *testing.T) {
+	job, err := NewJob(&pb.JobConfiguration{Begin: 1000, End: 10000, Rate: 1, Speed: 1})
+	assert.Nil(t, err)
+	job.WithFetcher(NewHARFetcher("capture.har"))
+	assert.NotNil(t, job.Seek(ParseMSec(2000))) // 任务未开始
+
+	job.status = StatusRunning
+	assert.NotNil(t, job.Seek(ParseMSec(2000))) // 不支持重新定位
+	job.WithFetcher(NewFileFetcher("access.log"))
+	assert.NotNil(t, job.Seek(ParseMSec(20000))) // 超出结束时间
+}
@@ -0,0 +1,36 @@
+package dispatcher
+
+type (
+	// Stage 位于Fetcher与TimeWheel之间的日志处理环节，如导出、过滤等
+	//
+	// Stage从Recv返回的管道读取日志，处理后写入SetOutput设定的管道，输入管道关闭后须关闭输出管道
+	Stage interface {
+		Recv() chan<- *LogRecordWrapper
+		SetOutput(chan<- *LogRecordWrapper)
+		Start() error
+	}
+
+	baseStage struct {
+		input  chan *LogRecordWrapper
+		output chan<- *LogRecordWrapper
+	}
+)
+
+var (
+	// StageBuffer Stage输入管道的缓冲大小
+	StageBuffer = 100
+)
+
+func newBaseStage() *baseStage {
+	return &baseStage{input: make(chan *LogRecordWrapper, StageBuffer)}
+}
+
+// Recv 返回Stage的输入管道
+func (bs *baseStage) Recv() chan<- *LogRecordWrapper {
+	return bs.input
+}
+
+// SetOutput 设定LogRecordWrapper的输出管道
+func (bs *baseStage) SetOutput(c chan<- *LogRecordWrapper) {
+	bs.output = c
+}
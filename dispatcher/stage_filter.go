@@ -0,0 +1,226 @@
+package dispatcher
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	// FilterRule 过滤规则，同一规则中的条件需要同时满足，未配置的条件不参与匹配
+	FilterRule struct {
+		Name    string            `toml:"name"`
+		Action  string            `toml:"action"`  // include：只保留匹配的日志，exclude：丢弃匹配的日志
+		Host    string            `toml:"host"`    // 正则，匹配请求地址中的host
+		Path    string            `toml:"path"`    // 正则，匹配请求路径
+		Method  []string          `toml:"method"`  // 请求方法，满足其一即可
+		Headers map[string]string `toml:"headers"` // 请求头名称到正则的映射，请求头名称不区分大小写
+	}
+
+	// FilterStage 按规则过滤日志并按HashField确定性采样
+	//
+	// 规则按配置顺序依次检查，日志须通过全部规则；采样按HashField的哈希值决定，同一用户的请求要么全部保留要么全部丢弃，
+	// HashField为空的日志随机采样
+	FilterStage struct {
+		rules  []*filterRule
+		rate   float64
+		salt   string
+		sample *filterRule
+		*baseStage
+	}
+
+	filterRule struct {
+		name    string
+		action  string
+		host    *regexp.Regexp
+		path    *regexp.Regexp
+		methods map[string]bool
+		headers map[string]*regexp.Regexp
+		passed  int64
+		dropped int64
+	}
+
+	// FilterRuleStats 单个规则的统计数据
+	FilterRuleStats struct {
+		Name    string `json:"name"`
+		Action  string `json:"action"`
+		Passed  int64  `json:"passed"`
+		Dropped int64  `json:"dropped"`
+	}
+)
+
+const (
+	filterActionInclude = "include"
+	filterActionExclude = "exclude"
+	filterActionSample  = "sample"
+	filterSampleScale   = 10000
+)
+
+// NewFilterStage FilterStage的构造函数，规则有误时返回error
+func NewFilterStage(rules []*FilterRule) (*FilterStage, error) {
+	fs := &FilterStage{baseStage: newBaseStage()}
+	for i, r := range rules {
+		rule, err := r.compile()
+		if err != nil {
+			return nil, err
+		}
+		if rule.name == "" {
+			rule.name = fmt.Sprintf("rule-%d", i)
+		}
+		fs.rules = append(fs.rules, rule)
+	}
+	return fs, nil
+}
+
+// WithSampling 设置采样比例，取值(0, 1)，其他值表示不采样；salt用于在不同任务间得到不同的采样结果
+func (fs *FilterStage) WithSampling(rate float64, salt string) *FilterStage {
+	if rate > 0 && rate < 1 {
+		fs.rate = rate
+		fs.salt = salt
+		fs.sample = &filterRule{name: filterActionSample, action: filterActionSample}
+	}
+	return fs
+}
+
+func (r *FilterRule) compile() (*filterRule, error) {
+	rule := &filterRule{name: r.Name, action: strings.ToLower(r.Action)}
+	if rule.action == "" {
+		rule.action = filterActionInclude
+	}
+	if rule.action != filterActionInclude && rule.action != filterActionExclude {
+		return nil, fmt.Errorf("filter rule %q: unknown action %q, expect include/exclude", r.Name, r.Action)
+	}
+	if r.Host == "" && r.Path == "" && len(r.Method) == 0 && len(r.Headers) == 0 {
+		return nil, fmt.Errorf("filter rule %q: no condition", r.Name)
+	}
+
+	var err error
+	if r.Host != "" {
+		if rule.host, err = regexp.Compile(r.Host); err != nil {
+			return nil, fmt.Errorf("filter rule %q: bad host: %w", r.Name, err)
+		}
+	}
+	if r.Path != "" {
+		if rule.path, err = regexp.Compile(r.Path); err != nil {
+			return nil, fmt.Errorf("filter rule %q: bad path: %w", r.Name, err)
+		}
+	}
+	if len(r.Method) > 0 {
+		rule.methods = map[string]bool{}
+		for _, m := range r.Method {
+			rule.methods[strings.ToUpper(m)] = true
+		}
+	}
+	if len(r.Headers) > 0 {
+		rule.headers = map[string]*regexp.Regexp{}
+		for k, v := range r.Headers {
+			if rule.headers[strings.ToLower(k)], err = regexp.Compile(v); err != nil {
+				return nil, fmt.Errorf("filter rule %q: bad header %s: %w", r.Name, k, err)
+			}
+		}
+	}
+	return rule, nil
+}
+
+// Start 过滤直到输入管道关闭
+func (fs *FilterStage) Start() error {
+	for log := range fs.input {
+		if fs.accept(log) {
+			fs.output <- log
+		}
+	}
+	close(fs.output)
+	return nil
+}
+
+// Stats 返回各规则的统计数据，采样作为最后一个规则
+func (fs *FilterStage) Stats() []FilterRuleStats {
+	rules := fs.rules
+	if fs.sample != nil {
+		rules = append(rules[:len(rules):len(rules)], fs.sample)
+	}
+	stats := make([]FilterRuleStats, len(rules))
+	for i, r := range rules {
+		stats[i] = FilterRuleStats{Name: r.name, Action: r.action, Passed: atomic.LoadInt64(&r.passed), Dropped: atomic.LoadInt64(&r.dropped)}
+	}
+	return stats
+}
+
+// Provide 实现Provider接口
+func (fs *FilterStage) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/filter/stats",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderJSON(w, &struct {
+					Code int               `json:"code"`
+					Data []FilterRuleStats `json:"data"`
+				}{Code: http.StatusOK, Data: fs.Stats()})
+			},
+		},
+	}
+}
+
+func (fs *FilterStage) accept(log *LogRecordWrapper) bool {
+	u, err := url.Parse(log.Url)
+	if err != nil {
+		u = &url.URL{}
+	}
+	for _, r := range fs.rules {
+		if r.match(log, u) != (r.action == filterActionInclude) {
+			atomic.AddInt64(&r.dropped, 1)
+			return false
+		}
+		atomic.AddInt64(&r.passed, 1)
+	}
+
+	if fs.sample == nil {
+		return true
+	}
+	if fs.sampled(log.HashField) {
+		atomic.AddInt64(&fs.sample.passed, 1)
+		return true
+	}
+	atomic.AddInt64(&fs.sample.dropped, 1)
+	return false
+}
+
+func (fs *FilterStage) sampled(hashField string) bool {
+	if hashField == "" {
+		return rand.Float64() < fs.rate
+	}
+	return float64(DefaultFNVHashPool.Hash(fs.salt+hashField)%filterSampleScale) < fs.rate*filterSampleScale
+}
+
+func (r *filterRule) match(log *LogRecordWrapper, u *url.URL) bool {
+	if r.host != nil && !r.host.MatchString(u.Host) {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(u.Path) {
+		return false
+	}
+	if r.methods != nil && !r.methods[strings.ToUpper(log.Method)] {
+		return false
+	}
+	for name, pattern := range r.headers {
+		value, ok := lookupHeader(log.Header, name)
+		if !ok || !pattern.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupHeader 不区分大小写地查找请求头
+func lookupHeader(header map[string]string, name string) (string, bool) {
+	for k, v := range header {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
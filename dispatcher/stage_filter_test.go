@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func filterLog(method, url string, header map[string]string, hashField string) *LogRecordWrapper {
+	return &LogRecordWrapper{HashField: hashField, LogRecord: &pb.LogRecord{Method: method, Url: url, Header: header}}
+}
+
+func TestFilterStage_Rules(t *testing.T) {
+	fs, err := NewFilterStage([]*FilterRule{
+		{Name: "api", Action: "include", Host: `^api\.a\.com$`, Path: "^/v2/", Method: []string{"get", "POST"}},
+		{Name: "health", Action: "exclude", Path: "^/v2/health"},
+		{Headers: map[string]string{"x-env": "^prod$"}},
+	})
+	assert.Nil(t, err)
+
+	prod := map[string]string{"X-Env": "prod"}
+	logs := runStage(t, fs,
+		filterLog("GET", "http://api.a.com/v2/orders?id=1", prod, ""),
+		filterLog("DELETE", "http://api.a.com/v2/orders", prod, ""),
+		filterLog("GET", "http://www.a.com/v2/orders", prod, ""),
+		filterLog("GET", "http://api.a.com/v2/health", prod, ""),
+		filterLog("POST", "http://api.a.com/v2/pay", map[string]string{"X-Env": "test"}, ""),
+		filterLog("POST", "http://api.a.com/v2/pay", prod, ""),
+	)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "http://api.a.com/v2/orders?id=1", logs[0].Url)
+	assert.Equal(t, "http://api.a.com/v2/pay", logs[1].Url)
+
+	assert.Equal(t, []FilterRuleStats{
+		{Name: "api", Action: "include", Passed: 4, Dropped: 2},
+		{Name: "health", Action: "exclude", Passed: 3, Dropped: 1},
+		{Name: "rule-2", Action: "include", Passed: 2, Dropped: 1},
+	}, fs.Stats())
+
+	for _, bad := range []*FilterRule{{Name: "a", Action: "drop", Path: "/"}, {Name: "b"}, {Name: "c", Path: "("}} {
+		_, err = NewFilterStage([]*FilterRule{bad})
+		assert.NotNil(t, err, bad.Name)
+	}
+}
+
+func TestFilterStage_Sampling(t *testing.T) {
+	var input []*LogRecordWrapper
+	for i := 0; i < 3; i++ {
+		for u := 0; u < 1000; u++ {
+			input = append(input, filterLog("GET", "http://a.com/", nil, fmt.Sprintf("user-%d", u)))
+		}
+	}
+
+	fs, err := NewFilterStage(nil)
+	assert.Nil(t, err)
+	logs := runStage(t, fs.WithSampling(0.2, "job-1"), input...)
+
+	// 同一用户的请求全部保留
+	users := map[string]int{}
+	for _, log := range logs {
+		users[log.HashField]++
+	}
+	for user, n := range users {
+		assert.Equal(t, 3, n, user)
+	}
+	assert.InDelta(t, 200, len(users), 50)
+
+	stats := fs.Stats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, int64(len(logs)), stats[0].Passed)
+	assert.Equal(t, int64(len(input)-len(logs)), stats[0].Dropped)
+
+	// 相同的salt得到相同的采样结果
+	fs, _ = NewFilterStage(nil)
+	again := runStage(t, fs.WithSampling(0.2, "job-1"), input...)
+	assert.Equal(t, len(logs), len(again))
+}
@@ -0,0 +1,368 @@
+package dispatcher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/buger/jsonparser"
+	"github.com/wosai/havok/processor"
+	"go.uber.org/zap"
+)
+
+type (
+	// RedactStage 在日志离开dispatcher之前脱敏，避免敏感信息进入replayer及其日志
+	//
+	// 可以按请求头名称、JSON请求体路径、查询参数（以及表单请求体）以及正则探测器定位敏感值。默认将敏感值替换为保留格式的假名：
+	// 数字替换为数字，字母替换为同样大小写的字母，其他字符不变，同一个值在同一个key下总是得到相同的假名，因此请求之间的关联不受影响
+	RedactStage struct {
+		key       []byte
+		mask      bool
+		headers   map[string]bool
+		jsonPaths [][]string
+		query     map[string]bool
+		detectors []*redactDetector
+		stats     RedactStats
+		*baseStage
+	}
+
+	redactDetector struct {
+		name    string
+		pattern *regexp.Regexp
+		count   int64
+	}
+
+	// RedactStats RedactStage的统计数据，各字段为替换的敏感值个数
+	RedactStats struct {
+		Records  int64            `json:"records"`
+		Headers  int64            `json:"headers"`
+		JSON     int64            `json:"json"`
+		Query    int64            `json:"query"`
+		Detected map[string]int64 `json:"detected"`
+	}
+)
+
+// RedactDetectors 内置的正则探测器，可以通过WithDetectors按名称启用
+var RedactDetectors = map[string]*regexp.Regexp{
+	"phone":     regexp.MustCompile(`\b1[3-9]\d{9}\b`),
+	"id_card":   regexp.MustCompile(`\b\d{17}[\dXx]\b`),
+	"bank_card": regexp.MustCompile(`\b\d{16,19}\b`),
+	"email":     regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`),
+}
+
+// NewRedactStage RedactStage的构造函数，key为生成假名的HMAC密钥，为空时随机生成，此时假名在多次运行之间不一致
+func NewRedactStage(key string) *RedactStage {
+	rs := &RedactStage{
+		key:       []byte(key),
+		headers:   map[string]bool{},
+		query:     map[string]bool{},
+		baseStage: newBaseStage(),
+	}
+	if key == "" {
+		rs.key = make([]byte, 32)
+		rand.Read(rs.key)
+		Logger.Warn("redact key is empty, pseudonyms are not stable across runs")
+	}
+	return rs
+}
+
+// WithMask 使用*遮盖敏感值（保留首尾各四分之一的字符），而不是替换为假名
+func (rs *RedactStage) WithMask(mask bool) *RedactStage {
+	rs.mask = mask
+	return rs
+}
+
+// WithHeaders 脱敏指定的请求头，名称不区分大小写。Authorization保留认证方式，Cookie只替换各项的值
+func (rs *RedactStage) WithHeaders(names ...string) *RedactStage {
+	for _, name := range names {
+		rs.headers[strings.ToLower(name)] = true
+	}
+	return rs
+}
+
+// WithJSONPaths 脱敏JSON请求体中的字段，路径语法与processor.JSONProcessor一致，如user.phone、data.cards[0].no
+func (rs *RedactStage) WithJSONPaths(paths ...string) *RedactStage {
+	for _, path := range paths {
+		rs.jsonPaths = append(rs.jsonPaths, processor.ParseJSONPath(path))
+	}
+	return rs
+}
+
+// WithQuery 脱敏指定的查询参数，同时作用于application/x-www-form-urlencoded请求体
+func (rs *RedactStage) WithQuery(names ...string) *RedactStage {
+	for _, name := range names {
+		rs.query[name] = true
+	}
+	return rs
+}
+
+// WithDetectors 按名称启用RedactDetectors中的探测器，作用于请求地址、请求头的值以及请求体
+func (rs *RedactStage) WithDetectors(names ...string) (*RedactStage, error) {
+	for _, name := range names {
+		pattern, ok := RedactDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redact detector: %s", name)
+		}
+		rs.WithDetector(name, pattern)
+	}
+	return rs, nil
+}
+
+// WithDetector 添加自定义的正则探测器
+func (rs *RedactStage) WithDetector(name string, pattern *regexp.Regexp) *RedactStage {
+	rs.detectors = append(rs.detectors, &redactDetector{name: name, pattern: pattern})
+	return rs
+}
+
+// Start 脱敏直到输入管道关闭
+func (rs *RedactStage) Start() error {
+	for log := range rs.input {
+		rs.redact(log)
+		rs.output <- log
+	}
+	close(rs.output)
+	return nil
+}
+
+// Stats 返回统计数据
+func (rs *RedactStage) Stats() RedactStats {
+	stats := RedactStats{
+		Records:  atomic.LoadInt64(&rs.stats.Records),
+		Headers:  atomic.LoadInt64(&rs.stats.Headers),
+		JSON:     atomic.LoadInt64(&rs.stats.JSON),
+		Query:    atomic.LoadInt64(&rs.stats.Query),
+		Detected: map[string]int64{},
+	}
+	for _, d := range rs.detectors {
+		stats.Detected[d.name] += atomic.LoadInt64(&d.count)
+	}
+	return stats
+}
+
+// Provide 实现Provider接口
+func (rs *RedactStage) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/redact/stats",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderJSON(w, &struct {
+					Code int         `json:"code"`
+					Data RedactStats `json:"data"`
+				}{Code: http.StatusOK, Data: rs.Stats()})
+			},
+		},
+	}
+}
+
+func (rs *RedactStage) redact(log *LogRecordWrapper) {
+	if log.LogRecord == nil {
+		return
+	}
+	atomic.AddInt64(&rs.stats.Records, 1)
+	// 记录已替换的假名，避免探测器再次替换导致同一个值出现两种假名
+	done := map[string]bool{}
+
+	for k, v := range log.Header {
+		name := strings.ToLower(k)
+		if rs.headers[name] {
+			log.Header[k] = rs.redactHeader(name, v, done)
+			atomic.AddInt64(&rs.stats.Headers, 1)
+		} else {
+			log.Header[k] = rs.detect(v, done)
+		}
+	}
+
+	if len(rs.query) > 0 {
+		if i := strings.IndexByte(log.Url, '?'); i >= 0 {
+			log.Url = log.Url[:i+1] + rs.redactQuery(log.Url[i+1:], done)
+		}
+	}
+	log.Url = rs.detect(log.Url, done)
+
+	if len(log.Body) == 0 {
+		return
+	}
+	body := bytes.TrimSpace(log.Body)
+	switch {
+	case len(rs.jsonPaths) > 0 && len(body) > 0 && (body[0] == '{' || body[0] == '['):
+		log.Body = rs.redactJSON(log.Body, done)
+	case len(rs.query) > 0 && strings.HasPrefix(strings.ToLower(contentType(log.Header)), "application/x-www-form-urlencoded"):
+		log.Body = []byte(rs.redactQuery(string(log.Body), done))
+	}
+	if len(rs.detectors) > 0 {
+		log.Body = []byte(rs.detect(string(log.Body), done))
+	}
+}
+
+func (rs *RedactStage) redactHeader(name, value string, done map[string]bool) string {
+	switch name {
+	case "authorization":
+		// 保留Bearer、Basic等认证方式
+		if i := strings.IndexByte(value, ' '); i > 0 {
+			return value[:i+1] + rs.replace(value[i+1:], done)
+		}
+	case "cookie":
+		items := strings.Split(value, ";")
+		for i, item := range items {
+			if j := strings.IndexByte(item, '='); j >= 0 {
+				items[i] = item[:j+1] + rs.replace(item[j+1:], done)
+			}
+		}
+		return strings.Join(items, ";")
+	}
+	return rs.replace(value, done)
+}
+
+// redactQuery 替换a=1&b=2形式字符串中指定参数的值，其余部分保持原样
+func (rs *RedactStage) redactQuery(query string, done map[string]bool) string {
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		j := strings.IndexByte(pair, '=')
+		if j < 0 {
+			continue
+		}
+		key, err := url.QueryUnescape(pair[:j])
+		if err != nil || !rs.query[key] {
+			continue
+		}
+		value, err := url.QueryUnescape(pair[j+1:])
+		if err != nil {
+			value = pair[j+1:]
+		}
+		pairs[i] = pair[:j+1] + url.QueryEscape(rs.replace(value, done))
+		atomic.AddInt64(&rs.stats.Query, 1)
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (rs *RedactStage) redactJSON(body []byte, done map[string]bool) []byte {
+	for _, path := range rs.jsonPaths {
+		value, dataType, _, err := jsonparser.Get(body, path...)
+		if err != nil {
+			continue
+		}
+
+		var replaced []byte
+		switch dataType {
+		case jsonparser.String:
+			s, err := jsonparser.ParseString(value)
+			if err != nil {
+				continue
+			}
+			replaced, _ = json.Marshal(rs.replace(s, done))
+		case jsonparser.Number:
+			if rs.mask {
+				replaced, _ = json.Marshal(maskValue(string(value)))
+				break
+			}
+			// 保留指数部分，替换后仍为合法的数字
+			s := string(value)
+			if i := strings.IndexAny(s, "eE"); i >= 0 {
+				replaced = []byte(rs.pseudonym(s[:i]) + s[i:])
+			} else {
+				replaced = []byte(rs.pseudonym(s))
+			}
+			done[string(replaced)] = true
+		default:
+			continue
+		}
+		if body, err = jsonparser.Set(body, replaced, path...); err != nil {
+			Logger.Warn("failed to redact json body", zap.Strings("path", path), zap.Error(err))
+			continue
+		}
+		atomic.AddInt64(&rs.stats.JSON, 1)
+	}
+	return body
+}
+
+func (rs *RedactStage) detect(s string, done map[string]bool) string {
+	for _, d := range rs.detectors {
+		s = d.pattern.ReplaceAllStringFunc(s, func(m string) string {
+			if done[m] {
+				return m
+			}
+			atomic.AddInt64(&d.count, 1)
+			return rs.replace(m, done)
+		})
+	}
+	return s
+}
+
+func (rs *RedactStage) replace(value string, done map[string]bool) string {
+	if rs.mask {
+		value = maskValue(value)
+	} else {
+		value = rs.pseudonym(value)
+	}
+	done[value] = true
+	return value
+}
+
+// redactPhone 手机号的格式，假名保留前两位的号段
+var redactPhone = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// pseudonym 生成保留格式的假名：数字替换为数字，字母替换为同样大小写的字母，其他字符不变，非0的首个数字仍为非0；
+// 手机号保留1[3-9]号段，只替换后九位，假名仍是合法的手机号
+func (rs *RedactStage) pseudonym(value string) string {
+	var stream []byte
+	mac := hmac.New(sha256.New, rs.key)
+	var counter [4]byte
+	for block := uint32(0); len(stream) < len(value); block++ {
+		mac.Reset()
+		binary.BigEndian.PutUint32(counter[:], block)
+		mac.Write(counter[:])
+		mac.Write([]byte(value))
+		stream = mac.Sum(stream)
+	}
+
+	out := []byte(value)
+	keep, leading := 0, true
+	if redactPhone.MatchString(value) {
+		keep, leading = 2, false
+	}
+	for i, c := range out[keep:] {
+		i += keep
+		r := stream[i]
+		switch {
+		case c >= '0' && c <= '9':
+			if leading && c != '0' {
+				out[i] = '1' + r%9
+			} else {
+				out[i] = '0' + r%10
+			}
+			leading = false
+		case c >= 'a' && c <= 'z':
+			out[i] = 'a' + r%26
+		case c >= 'A' && c <= 'Z':
+			out[i] = 'A' + r%26
+		}
+	}
+	return string(out)
+}
+
+// maskValue 使用*遮盖字母与数字，保留首尾各四分之一的字符
+func maskValue(value string) string {
+	out := []byte(value)
+	keep := len(out) / 4
+	for i := keep; i < len(out)-keep; i++ {
+		c := out[i]
+		if c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			out[i] = '*'
+		}
+	}
+	return string(out)
+}
+
+func contentType(header map[string]string) string {
+	v, _ := lookupHeader(header, "Content-Type")
+	return v
+}
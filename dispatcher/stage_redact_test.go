@@ -0,0 +1,90 @@
+package dispatcher
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestRedactStage_Pseudonym(t *testing.T) {
+	rs, err := NewRedactStage("secret").
+		WithHeaders("authorization", "Cookie").
+		WithJSONPaths("user.phone", "cards[0].no", "amount").
+		WithQuery("id_card").
+		WithDetectors("phone", "email")
+	assert.Nil(t, err)
+
+	newLog := func() *LogRecordWrapper {
+		return &LogRecordWrapper{LogRecord: &pb.LogRecord{
+			Url:    "http://a.com/users/13812345678?id_card=11010119900307123X&page=1",
+			Method: "POST",
+			Header: map[string]string{"Authorization": "Bearer abc.DEF-123", "Cookie": "sid=s1; uid=42", "X-Mail": "tom@a.com"},
+			Body:   []byte(`{"user":{"phone":"13812345678","name":"tom"},"cards":[{"no":6222020200112233}],"amount":12.5}`),
+		}}
+	}
+	logs := runStage(t, rs, newLog(), newLog())
+	assert.Len(t, logs, 2)
+	assert.Equal(t, logs[0].LogRecord, logs[1].LogRecord)
+
+	log := logs[0]
+	assert.Regexp(t, `^Bearer [a-z]{3}\.[A-Z]{3}-\d{3}$`, log.Header["Authorization"])
+	assert.NotEqual(t, "Bearer abc.DEF-123", log.Header["Authorization"])
+	assert.Regexp(t, `^sid=[a-z]\d; uid=[1-9]\d$`, log.Header["Cookie"])
+	assert.Regexp(t, `^[a-z]{3}@[a-z]\.[a-z]{3}$`, log.Header["X-Mail"])
+	assert.NotContains(t, log.Url, "13812345678")
+	assert.NotContains(t, log.Url, "11010119900307123")
+	assert.Regexp(t, `^http://a\.com/users/\d{11}\?id_card=\d{17}[A-Z]&page=1$`, log.Url)
+
+	phone, err := jsonparser.GetString(log.Body, "user", "phone")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^13\d{9}$`, phone) // 保留号段
+	assert.NotEqual(t, "13812345678", phone)
+	assert.Regexp(t, `^15\d{9}$`, rs.pseudonym("15900001111"))
+	assert.NotEqual(t, "15900001111", rs.pseudonym("15900001111"))
+	// 同一个值得到相同的假名，无论出现在哪里
+	assert.Contains(t, log.Url, phone)
+	name, _ := jsonparser.GetString(log.Body, "user", "name")
+	assert.Equal(t, "tom", name)
+	card, err := jsonparser.GetInt(log.Body, "cards", "[0]", "no")
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(6222020200112233), card)
+	_, err = jsonparser.GetFloat(log.Body, "amount")
+	assert.Nil(t, err)
+
+	stats := rs.Stats()
+	assert.Equal(t, int64(2), stats.Records)
+	assert.Equal(t, int64(4), stats.Headers)
+	assert.Equal(t, int64(6), stats.JSON)
+	assert.Equal(t, int64(2), stats.Query)
+	assert.Equal(t, int64(2), stats.Detected["email"])
+	// 请求体中的手机号已经按JSON路径替换，探测器不会再次替换
+	assert.Equal(t, int64(2), stats.Detected["phone"])
+
+	// 不同的key得到不同的假名
+	other := NewRedactStage("other").WithHeaders("Authorization")
+	assert.NotEqual(t, log.Header["Authorization"], runStage(t, other, newLog())[0].Header["Authorization"])
+}
+
+func TestRedactStage_Mask(t *testing.T) {
+	rs := NewRedactStage("secret").WithMask(true).
+		WithJSONPaths("phone").
+		WithQuery("token").
+		WithDetector("order", regexp.MustCompile(`order-\d+`))
+	log := &LogRecordWrapper{LogRecord: &pb.LogRecord{
+		Url:    "http://a.com/pay",
+		Header: map[string]string{"content-type": "application/x-www-form-urlencoded"},
+		Body:   []byte("token=abcdefgh&order=order-12345678"),
+	}}
+	log = runStage(t, rs, log)[0]
+	assert.Equal(t, "token=ab%2A%2A%2A%2Agh&order=ord**-*****678", string(log.Body))
+
+	log.Body = []byte(`{"phone":13812345678}`)
+	log = runStage(t, NewRedactStage("secret").WithMask(true).WithJSONPaths("phone"), log)[0]
+	assert.Equal(t, `{"phone":"13*******78"}`, string(log.Body))
+
+	_, err := NewRedactStage("secret").WithDetectors("unknown")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,489 @@
+package dispatcher
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/wosai/havok/pkg/genproto"
+	"go.uber.org/zap"
+)
+
+type (
+	// ReorderStage 基于水位的重排序环节，适用于任意Fetcher
+	//
+	// 已收到的最大日志时间减去window作为水位，早于水位的日志按OccurAt顺序输出；早于已输出日志的迟到日志按配置丢弃或者修正时间。
+	// 内存中最多缓存maxBuffer条日志，设置了spillDir时较晚的日志按秒写入临时文件，否则提前输出最早的日志。
+	// 输出的日志的读取位置改为该数据源中仍缓存的最早日志的起始位置，断点从这里继续读取时不会丢失尚未分发的日志
+	ReorderStage struct {
+		window    time.Duration
+		maxBuffer int
+		spillDir  string
+		clamp     bool
+
+		heap        recordHeap
+		sequence    int
+		maxSeen     time.Time
+		lastEmitted time.Time
+		epoch       int64 // 当前缓存的日志的定位编号，见Seeker
+
+		lastCursor map[string]int64        // 各数据源最后收到的日志的读取位置，即下一条日志的起始位置
+		held       map[string]*heldCursors // 各数据源缓存中的日志的起始位置
+
+		tempDir   string
+		spilling  bool
+		spillFrom time.Time
+		buckets   map[int64]*spillBucket
+
+		stats ReorderStats
+		*baseStage
+	}
+
+	// ReorderStats ReorderStage的统计数据，用于观察数据源的乱序程度
+	ReorderStats struct {
+		Received    int64 `json:"received"`
+		Emitted     int64 `json:"emitted"`
+		OutOfOrder  int64 `json:"out_of_order"` // 早于已收到的最大日志时间
+		LateDropped int64 `json:"late_dropped"` // 早于已输出日志而被丢弃
+		LateClamped int64 `json:"late_clamped"` // 早于已输出日志而被修正时间
+		Forced      int64 `json:"forced"`       // 内存不足时提前输出
+		Spilled     int64 `json:"spilled"`      // 写入临时文件
+		Buffered    int64 `json:"buffered"`     // 当前内存中缓存的日志
+		MaxDelayMS  int64 `json:"max_delay_ms"` // 观察到的最大乱序时间
+	}
+
+	// heldCursors 同一数据源缓存中的日志的起始位置，starts按收到的顺序递增，done记录已经输出的起始位置
+	heldCursors struct {
+		starts []int64
+		done   map[int64]int
+	}
+
+	// spillBucket 同一秒内溢出到临时文件的日志
+	spillBucket struct {
+		start  time.Time
+		path   string
+		file   *os.File
+		writer *bufio.Writer
+		enc    *gob.Encoder
+		count  int
+	}
+
+	spillRecord struct {
+		HashField string
+		OccurAt   int64
+		Url       string
+		Method    string
+		Header    map[string]string
+		Body      []byte
+		Response  *RecordedResponse
+		Epoch     int64
+		Source    string
+		Offset    int64
+		Start     int64
+	}
+)
+
+var (
+	// ReorderDefaultMaxBuffer ReorderStage内存中默认最多缓存的日志数
+	ReorderDefaultMaxBuffer = 100000
+	// ReorderSpillBucket 临时文件的时间粒度
+	ReorderSpillBucket = time.Second
+)
+
+// NewReorderStage ReorderStage的构造函数，window为允许的乱序时间
+func NewReorderStage(window time.Duration) *ReorderStage {
+	return &ReorderStage{
+		window:     window,
+		maxBuffer:  ReorderDefaultMaxBuffer,
+		lastCursor: map[string]int64{},
+		held:       map[string]*heldCursors{},
+		buckets:    map[int64]*spillBucket{},
+		baseStage:  newBaseStage(),
+	}
+}
+
+// WithMaxBuffer 设置内存中最多缓存的日志数
+func (rs *ReorderStage) WithMaxBuffer(n int) *ReorderStage {
+	if n > 0 {
+		rs.maxBuffer = n
+	}
+	return rs
+}
+
+// WithSpill 设置临时文件所在目录，为空时不使用临时文件
+func (rs *ReorderStage) WithSpill(dir string) *ReorderStage {
+	rs.spillDir = dir
+	return rs
+}
+
+// WithClamp 迟到日志的处理方式，true表示修正为最后输出的日志时间，false表示丢弃
+func (rs *ReorderStage) WithClamp(clamp bool) *ReorderStage {
+	rs.clamp = clamp
+	return rs
+}
+
+// Start 重排序直到输入管道关闭，之后输出全部缓存的日志
+//
+// 水位只随新日志推进，输入空闲超过window时输出全部缓存的日志，避免数据源停顿时最后一批日志一直得不到分发
+func (rs *ReorderStage) Start() error {
+	var tick <-chan time.Time
+	if rs.window > 0 {
+		ticker := time.NewTicker(rs.window / 2)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	lastInput := time.Now()
+
+loop:
+	for {
+		select {
+		case log, ok := <-rs.input:
+			if !ok {
+				break loop
+			}
+			if log.epoch > rs.epoch { // 任务被重新定位，缓存的日志已经过期
+				rs.reset(log.epoch)
+			}
+			rs.accept(log)
+			rs.release(rs.maxSeen.Add(-rs.window))
+			lastInput = time.Now()
+
+		case now := <-tick:
+			if now.Sub(lastInput) >= rs.window && (rs.heap.Len() > 0 || len(rs.buckets) > 0) {
+				rs.release(rs.maxSeen)
+			}
+		}
+	}
+
+	for {
+		bucket := rs.earliestBucket()
+		if bucket == nil {
+			break
+		}
+		for rs.heap.Len() > 0 && rs.heap[0].log.OccurAt.Before(bucket.start) {
+			rs.emit(rs.pop())
+		}
+		rs.load(bucket)
+	}
+	for rs.heap.Len() > 0 {
+		rs.emit(rs.pop())
+	}
+	close(rs.output)
+
+	if rs.tempDir != "" {
+		os.RemoveAll(rs.tempDir)
+	}
+	Logger.Info("reorder stage finished", zap.Any("stats", rs.Stats()))
+	return nil
+}
+
+// Stats 返回当前的统计数据
+func (rs *ReorderStage) Stats() ReorderStats {
+	return ReorderStats{
+		Received:    atomic.LoadInt64(&rs.stats.Received),
+		Emitted:     atomic.LoadInt64(&rs.stats.Emitted),
+		OutOfOrder:  atomic.LoadInt64(&rs.stats.OutOfOrder),
+		LateDropped: atomic.LoadInt64(&rs.stats.LateDropped),
+		LateClamped: atomic.LoadInt64(&rs.stats.LateClamped),
+		Forced:      atomic.LoadInt64(&rs.stats.Forced),
+		Spilled:     atomic.LoadInt64(&rs.stats.Spilled),
+		Buffered:    atomic.LoadInt64(&rs.stats.Buffered),
+		MaxDelayMS:  atomic.LoadInt64(&rs.stats.MaxDelayMS),
+	}
+}
+
+// Provide 实现Provider接口
+func (rs *ReorderStage) Provide() []ProviderMethod {
+	return []ProviderMethod{
+		{
+			Path: "/api/reorder/stats",
+			Func: func(w http.ResponseWriter, req *http.Request) {
+				renderJSON(w, &struct {
+					Code int          `json:"code"`
+					Data ReorderStats `json:"data"`
+				}{Code: http.StatusOK, Data: rs.Stats()})
+			},
+		},
+	}
+}
+
+// reset 丢弃缓存以及临时文件中的日志，重新开始计算水位
+func (rs *ReorderStage) reset(epoch int64) {
+	for _, bucket := range rs.buckets {
+		bucket.file.Close()
+		os.Remove(bucket.path)
+	}
+	Logger.Info("reorder stage is reset after seeking", zap.Int("buffered", rs.heap.Len()), zap.Int("buckets", len(rs.buckets)))
+	rs.buckets = map[int64]*spillBucket{}
+	rs.lastCursor, rs.held = map[string]int64{}, map[string]*heldCursors{}
+	rs.heap = rs.heap[:0]
+	rs.spilling = false
+	rs.maxSeen, rs.lastEmitted, rs.spillFrom = time.Time{}, time.Time{}, time.Time{}
+	rs.epoch = epoch
+	atomic.StoreInt64(&rs.stats.Buffered, 0)
+}
+
+func (rs *ReorderStage) accept(log *LogRecordWrapper) {
+	atomic.AddInt64(&rs.stats.Received, 1)
+	if log.cursor != nil {
+		start, ok := rs.lastCursor[log.cursor.source]
+		if !ok {
+			start = -1
+		}
+		rs.lastCursor[log.cursor.source] = log.cursor.offset
+		log.cursor.start = start
+	}
+	if !rs.lastEmitted.IsZero() && log.OccurAt.Before(rs.lastEmitted) {
+		if !rs.clamp {
+			atomic.AddInt64(&rs.stats.LateDropped, 1)
+			return
+		}
+		atomic.AddInt64(&rs.stats.LateClamped, 1)
+		log.OccurAt = rs.lastEmitted
+	}
+	if log.cursor != nil {
+		h, ok := rs.held[log.cursor.source]
+		if !ok {
+			h = &heldCursors{done: map[int64]int{}}
+			rs.held[log.cursor.source] = h
+		}
+		h.starts = append(h.starts, log.cursor.start)
+	}
+
+	if log.OccurAt.Before(rs.maxSeen) {
+		atomic.AddInt64(&rs.stats.OutOfOrder, 1)
+		if delay := rs.maxSeen.Sub(log.OccurAt).Milliseconds(); delay > atomic.LoadInt64(&rs.stats.MaxDelayMS) {
+			atomic.StoreInt64(&rs.stats.MaxDelayMS, delay)
+		}
+	} else {
+		rs.maxSeen = log.OccurAt
+	}
+
+	if rs.spilling && !log.OccurAt.Before(rs.spillFrom) && rs.spill(log) {
+		return
+	}
+	rs.push(log)
+
+	if rs.heap.Len() <= rs.maxBuffer {
+		return
+	}
+	if rs.spillDir != "" {
+		rs.spillNewest()
+	}
+	for rs.heap.Len() > rs.maxBuffer {
+		atomic.AddInt64(&rs.stats.Forced, 1)
+		rs.emit(rs.pop())
+	}
+}
+
+// spillNewest 内存不足时将较晚的一半日志写入临时文件，之后不早于这些日志的新日志直接写入临时文件
+func (rs *ReorderStage) spillNewest() {
+	sort.Sort(rs.heap) // 有序的数组同时也是合法的小顶堆
+	keep := rs.maxBuffer / 2
+	spilled := rs.heap[keep:]
+	rs.heap = rs.heap[:keep:keep]
+
+	for i, item := range spilled {
+		if !rs.spill(item.log) {
+			for _, rest := range spilled[i:] {
+				rs.push(rest.log)
+			}
+			break
+		}
+	}
+	if len(rs.buckets) > 0 {
+		rs.spilling = true
+		rs.spillFrom = spilled[0].log.OccurAt
+	}
+	atomic.StoreInt64(&rs.stats.Buffered, int64(rs.heap.Len()))
+}
+
+// release 输出早于水位的日志，临时文件中早于水位的日志须先加载，内存充足时也会提前加载
+func (rs *ReorderStage) release(watermark time.Time) {
+	for {
+		bucket := rs.earliestBucket()
+		if bucket != nil && !bucket.start.After(watermark) {
+			rs.load(bucket)
+			continue
+		}
+
+		for rs.heap.Len() > 0 && !rs.heap[0].log.OccurAt.After(watermark) {
+			rs.emit(rs.pop())
+		}
+
+		switch {
+		case bucket == nil:
+			rs.spilling = false
+			return
+		case rs.heap.Len()+bucket.count <= rs.maxBuffer/2:
+			rs.load(bucket)
+		default:
+			return
+		}
+	}
+}
+
+func (rs *ReorderStage) push(log *LogRecordWrapper) {
+	rs.sequence++
+	heap.Push(&rs.heap, &mergeItem{log: log, source: rs.sequence})
+	atomic.StoreInt64(&rs.stats.Buffered, int64(rs.heap.Len()))
+}
+
+func (rs *ReorderStage) pop() *LogRecordWrapper {
+	log := heap.Pop(&rs.heap).(*mergeItem).log
+	atomic.StoreInt64(&rs.stats.Buffered, int64(rs.heap.Len()))
+	return log
+}
+
+func (rs *ReorderStage) emit(log *LogRecordWrapper) {
+	rs.lastEmitted = log.OccurAt
+	if log.cursor != nil {
+		log.cursor = rs.unhold(log.cursor)
+	}
+	atomic.AddInt64(&rs.stats.Emitted, 1)
+	rs.output <- log
+}
+
+// unhold 日志输出后返回该数据源可以继续读取的位置：仍有缓存的日志时为其中最早的起始位置，起始位置未知时返回nil，不更新断点
+func (rs *ReorderStage) unhold(c *sourceCursor) *sourceCursor {
+	h, ok := rs.held[c.source]
+	if !ok {
+		return c
+	}
+	h.done[c.start]++
+	for len(h.starts) > 0 && h.done[h.starts[0]] > 0 {
+		start := h.starts[0]
+		if h.done[start]--; h.done[start] == 0 {
+			delete(h.done, start)
+		}
+		h.starts = h.starts[1:]
+	}
+
+	switch {
+	case len(h.starts) == 0:
+		return &sourceCursor{source: c.source, offset: rs.lastCursor[c.source]}
+	case h.starts[0] < 0:
+		return nil
+	default:
+		return &sourceCursor{source: c.source, offset: h.starts[0]}
+	}
+}
+
+// spill 写入临时文件，失败时不再使用临时文件并返回false
+func (rs *ReorderStage) spill(log *LogRecordWrapper) bool {
+	if rs.spillDir == "" {
+		return false
+	}
+	start := log.OccurAt.Truncate(ReorderSpillBucket)
+	bucket, ok := rs.buckets[start.UnixNano()]
+	if !ok {
+		var err error
+		if bucket, err = rs.createBucket(start); err != nil {
+			Logger.Error("failed to create reorder spill file, keep logs in memory", zap.Error(err))
+			rs.spillDir = ""
+			return false
+		}
+		rs.buckets[start.UnixNano()] = bucket
+	}
+
+	r := &spillRecord{
+		HashField: log.HashField,
+		OccurAt:   log.OccurAt.UnixNano(),
+		Url:       log.Url,
+		Method:    log.Method,
+		Header:    log.Header,
+		Body:      log.Body,
+		Response:  log.Response,
+		Epoch:     log.epoch,
+	}
+	if log.cursor != nil {
+		r.Source, r.Offset, r.Start = log.cursor.source, log.cursor.offset, log.cursor.start
+	}
+	err := bucket.enc.Encode(r)
+	if err != nil {
+		Logger.Error("failed to write reorder spill file, keep logs in memory", zap.Error(err))
+		rs.spillDir = ""
+		return false
+	}
+	bucket.count++
+	atomic.AddInt64(&rs.stats.Spilled, 1)
+	return true
+}
+
+func (rs *ReorderStage) createBucket(start time.Time) (*spillBucket, error) {
+	if rs.tempDir == "" {
+		dir, err := ioutil.TempDir(rs.spillDir, "havok-reorder-")
+		if err != nil {
+			return nil, err
+		}
+		rs.tempDir = dir
+	}
+	path := filepath.Join(rs.tempDir, fmt.Sprintf("%d.gob", start.UnixNano()))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &spillBucket{start: start, path: path, file: file, writer: writer, enc: gob.NewEncoder(writer)}, nil
+}
+
+func (rs *ReorderStage) earliestBucket() *spillBucket {
+	if len(rs.buckets) == 0 {
+		return nil
+	}
+	keys := make([]int64, 0, len(rs.buckets))
+	for k := range rs.buckets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return rs.buckets[keys[0]]
+}
+
+// load 将临时文件中的日志加载到内存
+func (rs *ReorderStage) load(bucket *spillBucket) {
+	delete(rs.buckets, bucket.start.UnixNano())
+	if end := bucket.start.Add(ReorderSpillBucket); end.After(rs.spillFrom) {
+		rs.spillFrom = end // 该秒内的新日志不再写入临时文件
+	}
+	defer os.Remove(bucket.path)
+
+	err := bucket.writer.Flush()
+	if err == nil {
+		_, err = bucket.file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		Logger.Error("failed to read reorder spill file, logs are lost", zap.Int("count", bucket.count), zap.Error(err))
+		bucket.file.Close()
+		return
+	}
+	defer bucket.file.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(bucket.file))
+	for i := 0; i < bucket.count; i++ {
+		var r spillRecord
+		if err = dec.Decode(&r); err != nil {
+			Logger.Error("failed to decode reorder spill file, logs are lost", zap.Int("count", bucket.count-i), zap.Error(err))
+			return
+		}
+		log := &LogRecordWrapper{
+			HashField: r.HashField,
+			OccurAt:   time.Unix(0, r.OccurAt),
+			Response:  r.Response,
+			LogRecord: &pb.LogRecord{Url: r.Url, Method: r.Method, Header: r.Header, Body: r.Body},
+			epoch:     r.Epoch,
+		}
+		if r.Source != "" {
+			log.cursor = &sourceCursor{source: r.Source, offset: r.Offset, start: r.Start}
+		}
+		rs.push(log)
+	}
+}
@@ -0,0 +1,169 @@
+package dispatcher
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "github.com/wosai/havok/pkg/genproto"
+)
+
+// runStage 依次发送日志并收集Stage的全部输出
+func runStage(t *testing.T, s Stage, logs ...*LogRecordWrapper) []*LogRecordWrapper {
+	output := make(chan *LogRecordWrapper, len(logs))
+	s.SetOutput(output)
+	done := make(chan error)
+	go func() { done <- s.Start() }()
+
+	for _, log := range logs {
+		s.Recv() <- log
+	}
+	close(s.Recv())
+	assert.Nil(t, <-done)
+
+	var result []*LogRecordWrapper
+	for log := range output {
+		result = append(result, log)
+	}
+	return result
+}
+
+func msecLogs(ms ...int64) []*LogRecordWrapper {
+	logs := make([]*LogRecordWrapper, len(ms))
+	for i, m := range ms {
+		logs[i] = &LogRecordWrapper{OccurAt: ParseMSec(m), LogRecord: &pb.LogRecord{Url: "/" + strconv.FormatInt(m, 10)}}
+	}
+	return logs
+}
+
+func occurAtMSec(logs []*LogRecordWrapper) []int64 {
+	ms := make([]int64, len(logs))
+	for i, log := range logs {
+		ms[i] = log.OccurAt.UnixNano() / 1e6
+	}
+	return ms
+}
+
+func TestReorderStage_Window(t *testing.T) {
+	// 收到5000时水位为3000，之后的1500早于已输出的日志
+	input := []int64{1000, 3000, 2000, 5000, 1500, 4000, 9000}
+
+	rs := NewReorderStage(2 * time.Second)
+	logs := runStage(t, rs, msecLogs(input...)...)
+	assert.Equal(t, []int64{1000, 2000, 3000, 4000, 5000, 9000}, occurAtMSec(logs))
+	stats := rs.Stats()
+	assert.Equal(t, int64(1), stats.LateDropped)
+	assert.Equal(t, int64(2), stats.OutOfOrder)
+	assert.Equal(t, int64(1000), stats.MaxDelayMS)
+
+	rs = NewReorderStage(2 * time.Second).WithClamp(true)
+	logs = runStage(t, rs, msecLogs(input...)...)
+	assert.Equal(t, []int64{1000, 2000, 3000, 3000, 4000, 5000, 9000}, occurAtMSec(logs))
+	assert.Equal(t, "/1500", logs[3].Url)
+	assert.Equal(t, int64(1), rs.Stats().LateClamped)
+}
+
+func TestReorderStage_IdleFlush(t *testing.T) {
+	rs := NewReorderStage(50 * time.Millisecond)
+	output := make(chan *LogRecordWrapper, 10)
+	rs.SetOutput(output)
+	done := make(chan error)
+	go func() { done <- rs.Start() }()
+
+	// 输入空闲超过window后，缓存的日志不必等待新日志推进水位
+	for _, log := range msecLogs(1000, 1040, 1020) {
+		rs.Recv() <- log
+	}
+	var result []*LogRecordWrapper
+	for len(result) < 3 {
+		select {
+		case log := <-output:
+			result = append(result, log)
+		case <-time.After(time.Second):
+			t.Fatal("buffered logs are not flushed while input is idle")
+		}
+	}
+	assert.Equal(t, []int64{1000, 1020, 1040}, occurAtMSec(result))
+
+	// 之后早于已输出日志的日志按迟到处理
+	rs.Recv() <- msecLogs(1030)[0]
+	close(rs.Recv())
+	assert.Nil(t, <-done)
+	assert.Len(t, output, 0)
+	assert.EqualValues(t, 1, rs.Stats().LateDropped)
+}
+
+func TestReorderStage_Spill(t *testing.T) {
+	var input []int64
+	for i := 0; i < 200; i++ {
+		input = append(input, int64(i*37))
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(input), func(i, j int) { input[i], input[j] = input[j], input[i] })
+
+	dir := t.TempDir()
+	rs := NewReorderStage(time.Hour).WithMaxBuffer(10).WithSpill(dir)
+	logs := runStage(t, rs, msecLogs(input...)...)
+	assert.Len(t, logs, 200)
+	for i := 1; i < len(logs); i++ {
+		assert.False(t, logs[i].OccurAt.Before(logs[i-1].OccurAt))
+	}
+	assert.True(t, rs.Stats().Spilled > 0)
+	assert.Equal(t, int64(0), rs.Stats().Forced)
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 0)
+
+	// 不使用临时文件时提前输出
+	rs = NewReorderStage(time.Hour).WithMaxBuffer(10)
+	logs = runStage(t, rs, msecLogs(input...)...)
+	assert.True(t, rs.Stats().Forced > 0)
+	assert.Equal(t, int64(200), rs.Stats().Received)
+	assert.Equal(t, rs.Stats().Emitted, int64(len(logs)))
+}
+
+func TestReorderStage_Cursor(t *testing.T) {
+	// 输出的日志记录该数据源中仍缓存的最早日志的起始位置
+	logs := msecLogs(1000, 3000, 2000, 5000, 4000, 9000)
+	for i, log := range logs {
+		log.cursor = &sourceCursor{source: "access.log", offset: int64(i+1) * 10}
+	}
+	rs := NewReorderStage(2 * time.Second)
+	logs = runStage(t, rs, logs...)
+	assert.Equal(t, []int64{1000, 2000, 3000, 4000, 5000, 9000}, occurAtMSec(logs))
+	var offsets []int64
+	for _, log := range logs {
+		offsets = append(offsets, log.cursor.offset)
+	}
+	assert.Equal(t, []int64{10, 10, 30, 30, 50, 60}, offsets)
+
+	// 数据源的第一条日志仍在缓存中时起始位置未知，不更新断点
+	logs = msecLogs(3000, 1000)
+	logs[0].cursor = &sourceCursor{source: "access.log", offset: 10}
+	logs[1].cursor = &sourceCursor{source: "access.log", offset: 20}
+	logs = runStage(t, NewReorderStage(5*time.Second), logs...)
+	assert.Equal(t, []int64{1000, 3000}, occurAtMSec(logs))
+	assert.Nil(t, logs[0].cursor)
+	assert.Equal(t, int64(20), logs[1].cursor.offset)
+
+	// 写入临时文件的日志保留读取位置
+	var input []int64
+	for i := 0; i < 50; i++ {
+		input = append(input, int64((50-i)*100))
+	}
+	logs = msecLogs(input...)
+	for i, log := range logs {
+		log.cursor = &sourceCursor{source: "access.log", offset: int64(i + 1)}
+	}
+	rs = NewReorderStage(time.Hour).WithMaxBuffer(10).WithSpill(t.TempDir())
+	logs = runStage(t, rs, logs...)
+	assert.Len(t, logs, 50)
+	assert.True(t, rs.Stats().Spilled > 0)
+	for _, log := range logs[:49] {
+		assert.Nil(t, log.cursor)
+	}
+	assert.Equal(t, int64(50), logs[49].cursor.offset)
+}
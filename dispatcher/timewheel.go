@@ -10,33 +10,45 @@ import (
 )
 
 var (
-	defaultTimeWheelInterval = 10 * time.Millisecond
-	defaultInboxBuffer       = 1000
+	defaultInboxBuffer = 1000
 )
 
 type (
 	// timeWheel 用于控制LogRecord发送速率
+	//
+	// 按回放时钟（日志时间按倍速推进）逐条释放日志，每条日志使用同一个timer等待到点，暂停时回放时钟停止推进
 	TimeWheel struct {
-		delta    time.Duration          // 日志时间与当前时间的偏差
-		nextStop time.Time              // 下一次等待时间（现实时间）
-		offset   time.Duration          // 在增速回放时，原始日志时间戳的修正量
-		interval time.Duration          // 每次循环间隔，如1s
-		inbox    chan *LogRecordWrapper // 接收LogRecordWrapper，输入方为Fetcher
-		status   TaskStatus             // TimeWheel工作状态
-		begin    time.Time
-		end      time.Time
-		speed    float32
-		ticker   *time.Ticker
-		Havok    *Havok
-		parent   ParentTask
-		counter  int64
-		qps      int64
+		clock   *playbackClock
+		timer   *time.Timer
+		wake    chan struct{}          // 暂停、恢复、停止、重新定位时唤醒等待中的日志
+		inbox   chan *LogRecordWrapper // 接收LogRecordWrapper，输入方为Fetcher
+		status  TaskStatus             // TimeWheel工作状态
+		begin   time.Time
+		end     time.Time
+		speed   float32
+		Havok   *Havok
+		parent  ParentTask
+		counter int64
+		qps     int64
+		epoch   int64 // 最后一次重新定位的编号，更早的日志被丢弃
+		current int64 // 正在回放的日志的定位编号
+
+		idleThreshold  time.Duration // 超过该值的日志间隔会被压缩，为0时不压缩
+		idleMax        time.Duration // 压缩后的间隔
+		last           time.Time     // 上一条分发的日志时间
+		idleGaps       int64         // 被压缩的间隔数
+		idleCompressed int64         // 累计跳过的日志时间，纳秒
+
+		dispatched func(*LogRecordWrapper) // 分发日志之前调用，用于记录断点
 	}
 )
 
 // Stop 停止TimeWheel的分发
 func (tw *TimeWheel) Stop() {
-	atomic.CompareAndSwapInt32(&tw.status, StatusRunning, StatusStopped)
+	if !atomic.CompareAndSwapInt32(&tw.status, StatusRunning, StatusStopped) {
+		atomic.CompareAndSwapInt32(&tw.status, StatusPaused, StatusStopped)
+	}
+	tw.wakeup()
 	if tw.parent != nil { //有ParentTask存在时，不直接通知下游havok
 		tw.parent.Notify(tw, StatusStopped)
 	} else if tw.Havok != nil {
@@ -46,14 +58,43 @@ func (tw *TimeWheel) Stop() {
 
 func (tw *TimeWheel) Finish() {
 	atomic.CompareAndSwapInt32(&tw.status, StatusRunning, StatusFinished)
+	if gaps := atomic.LoadInt64(&tw.idleGaps); gaps > 0 {
+		Logger.Info("idle gaps of time wheel were compressed", zap.Int64("gaps", gaps),
+			zap.Duration("compressed", time.Duration(atomic.LoadInt64(&tw.idleCompressed))))
+	}
 	if tw.parent != nil {
 		tw.parent.Notify(tw, StatusFinished)
 	} else if tw.Havok != nil {
 		tw.Havok.Broadcast(&pb.DispatcherEvent{Type: pb.DispatcherEvent_JobStop})
 	}
-	if tw.ticker != nil {
-		tw.ticker.Stop()
+}
+
+// Pause 暂停分发，回放时钟停止推进，只有运行中的TimeWheel可以暂停
+func (tw *TimeWheel) Pause() bool {
+	if !atomic.CompareAndSwapInt32(&tw.status, StatusRunning, StatusPaused) {
+		return false
+	}
+	tw.clock.pause()
+	tw.wakeup()
+	Logger.Info("time wheel is paused", zap.String("at", tw.clock.now().String()))
+	if tw.parent != nil {
+		tw.parent.Notify(tw, StatusPaused)
+	}
+	return true
+}
+
+// Resume 从暂停时的日志时间继续分发，暂停期间积压的日志仍按原有间隔发出
+func (tw *TimeWheel) Resume() bool {
+	if !atomic.CompareAndSwapInt32(&tw.status, StatusPaused, StatusRunning) {
+		return false
+	}
+	tw.clock.resume()
+	tw.wakeup()
+	Logger.Info("time wheel is resumed", zap.String("at", tw.clock.now().String()))
+	if tw.parent != nil {
+		tw.parent.Notify(tw, StatusRunning)
 	}
+	return true
 }
 
 func (tw *TimeWheel) Status() TaskStatus {
@@ -65,12 +106,16 @@ func NewTimeWheel(job *pb.JobConfiguration) (*TimeWheel, error) {
 	if err := checkConfiguration(job); err != nil {
 		return nil, err
 	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
 	return &TimeWheel{
-		interval: defaultTimeWheelInterval,
-		inbox:    make(chan *LogRecordWrapper, defaultInboxBuffer),
-		begin:    ParseMSec(job.Begin),
-		end:      ParseMSec(job.End),
-		speed:    job.Speed,
+		clock: newPlaybackClock(job.Speed),
+		timer: timer,
+		wake:  make(chan struct{}, 1),
+		inbox: make(chan *LogRecordWrapper, defaultInboxBuffer),
+		begin: ParseMSec(job.Begin),
+		end:   parseJobEnd(job.End),
+		speed: job.Speed,
 	}, nil
 }
 
@@ -88,10 +133,13 @@ func (tw *TimeWheel) Start() error {
 	Logger.Info("start time wheel", zap.String("begin", tw.begin.String()), zap.String("end", tw.end.String()))
 
 	go func() {
-		var last = tw.counter
+		var last = atomic.LoadInt64(&tw.counter)
 		var current int64
 		for {
 			time.Sleep(1 * time.Second)
+			if s := tw.Status(); s == StatusStopped || s == StatusFinished {
+				return
+			}
 			current = atomic.LoadInt64(&tw.counter)
 			tw.qps = current - last
 			last = current
@@ -105,6 +153,19 @@ func (tw *TimeWheel) Start() error {
 			return ErrTaskInterrupted
 		}
 
+		if tw.stale(log) { // 重新定位之前读取的日志
+			continue
+		}
+		if log.epoch > tw.current { // 重新定位后的第一条日志，回放时钟从该日志重新开始
+			tw.current = log.epoch
+			tw.seek(log.epoch)
+			tw.clock.reset()
+			tw.last = time.Time{}
+			if log.OccurAt.Before(tw.begin) {
+				tw.begin = log.OccurAt
+			}
+		}
+
 		if log.OccurAt.Before(tw.begin) { // 早于任务开始时间，不处理
 			continue
 		}
@@ -115,19 +176,25 @@ func (tw *TimeWheel) Start() error {
 			return nil
 		}
 
-		if tw.delta == 0 {
-			tw.delta = time.Now().Sub(log.OccurAt)
-			Logger.Info("set delta field of time wheel", zap.String("delta", tw.delta.String()), zap.String("occurAt", log.OccurAt.String()))
-			go tw.wheeling()
+		if !tw.clock.isStarted() {
+			tw.clock.start(log.OccurAt)
+			Logger.Info("start playback clock of time wheel", zap.String("occurAt", log.OccurAt.String()))
 		}
+		tw.compress(log)
 
-		//Logger.Info("received log", zap.String("occurAt", log.OccurAt.String()))
-		for tw.nextStop.Before(log.OccurAt.Add(tw.delta)) {
-			time.Sleep(time.Millisecond)
-			//tw.next()
+		if !tw.wait(log) {
+			if tw.Status() != StatusStopped { // 等待期间任务被重新定位
+				continue
+			}
+			Logger.Warn("current time wheel is stopped")
+			return ErrTaskInterrupted
 		}
 
 		atomic.AddInt64(&tw.counter, 1)
+		tw.last = log.OccurAt
+		if tw.dispatched != nil {
+			tw.dispatched(log)
+		}
 		tw.Havok.Send(log)
 	}
 	// 上游Fetcher需要主动关闭channel，应当视为其完成了发送
@@ -136,23 +203,66 @@ func (tw *TimeWheel) Start() error {
 	return nil
 }
 
-// Parent 关联任务
-func (tw *TimeWheel) Parent(p ParentTask) {
-	tw.parent = p
+// wait 等待回放时钟到达日志时间，暂停期间一直等待，TimeWheel被停止或者日志因重新定位而过期时返回false
+func (tw *TimeWheel) wait(log *LogRecordWrapper) bool {
+	for {
+		if tw.Status() == StatusStopped || tw.stale(log) {
+			return false
+		}
+		d, running := tw.clock.until(log.OccurAt)
+		if running && d <= 0 {
+			return true
+		}
+
+		var fired <-chan time.Time
+		if running {
+			tw.timer.Reset(d)
+			fired = tw.timer.C
+		}
+		select {
+		case <-fired:
+		case <-tw.wake: // 时钟状态发生变化，重新计算等待时间
+			if running && !tw.timer.Stop() {
+				select {
+				case <-tw.timer.C:
+				default:
+				}
+			}
+		}
+	}
 }
 
-func (tw *TimeWheel) wheeling() {
-	tw.ticker = time.NewTicker(defaultTimeWheelInterval)
-	tw.next()
-	for range tw.ticker.C {
-		tw.next()
+// compress 与上一条日志的间隔超过阈值时，回放时钟直接跳到该日志之前idleMax，只等待idleMax
+func (tw *TimeWheel) compress(log *LogRecordWrapper) {
+	if tw.idleThreshold <= 0 || tw.last.IsZero() {
+		return
+	}
+	gap := log.OccurAt.Sub(tw.last)
+	if gap <= tw.idleThreshold {
+		return
+	}
+	skipped := log.OccurAt.Add(-tw.idleMax).Sub(tw.clock.now()) // 回放时钟已经越过上一条日志时，只跳过剩余的部分
+	if skipped <= 0 {
+		return
+	}
+	tw.clock.skip(skipped)
+	atomic.AddInt64(&tw.idleGaps, 1)
+	atomic.AddInt64(&tw.idleCompressed, int64(skipped))
+	Logger.Debug("compressed idle gap", zap.String("from", tw.last.String()), zap.String("to", log.OccurAt.String()),
+		zap.Duration("skipped", skipped))
+}
+
+// wakeup 唤醒等待中的日志，不阻塞
+func (tw *TimeWheel) wakeup() {
+	select {
+	case tw.wake <- struct{}{}:
+	default:
 	}
-	Logger.Info("stop wheeling")
 }
 
-func (tw *TimeWheel) next() {
-	tw.offset += time.Duration(float64(tw.interval) * float64(tw.speed-1.0))
-	tw.nextStop = time.Now().Add(tw.offset + time.Duration(float32(tw.interval)*tw.speed))
+// Parent 关联任务
+func (tw *TimeWheel) Parent(p ParentTask) {
+	tw.parent = p
 }
 
 // WithHavok 设置接收LogRecord的havok服务
@@ -161,12 +271,40 @@ func (tw *TimeWheel) WithHavok(hv *Havok) *TimeWheel {
 	return tw
 }
 
+// WithIdleCompression 将日志之间超过threshold的空闲间隔压缩为max，低峰时段快速跳过，突发流量内部的间隔保持不变；
+// threshold不大于0时不压缩，max超过threshold时按threshold处理
+func (tw *TimeWheel) WithIdleCompression(threshold, max time.Duration) *TimeWheel {
+	if max < 0 {
+		max = 0
+	}
+	if max > threshold {
+		max = threshold
+	}
+	tw.idleThreshold, tw.idleMax = threshold, max
+	return tw
+}
+
+// PerformanceStats 空闲间隔压缩的统计，可以通过Reporter.WithPerformanceSource附加到报告中
+func (tw *TimeWheel) PerformanceStats() map[string]float64 {
+	return map[string]float64{
+		"idle_gaps":          float64(atomic.LoadInt64(&tw.idleGaps)),
+		"idle_compressed_ms": float64(atomic.LoadInt64(&tw.idleCompressed) / int64(time.Millisecond)),
+	}
+}
+
 func (tw *TimeWheel) refreshConfig(c *pb.JobConfiguration) error {
-	if c == nil || c.Begin == 0 || c.End == 0 || c.Speed <= 0 {
+	if c == nil || c.Begin == 0 || c.Speed <= 0 {
 		return errors.New("bad job Configuration")
 	}
 	tw.begin = ParseMSec(c.Begin)
-	tw.end = ParseMSec(c.End)
+	tw.end = parseJobEnd(c.End)
 	tw.speed = c.Speed
+	tw.clock.setSpeed(c.Speed)
 	return nil
 }
+
+// setSpeed 运行中修改倍速，等待中的日志按新的倍速重新计算等待时间
+func (tw *TimeWheel) setSpeed(speed float32) {
+	tw.clock.setSpeed(speed)
+	tw.wakeup()
+}
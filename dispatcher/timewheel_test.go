@@ -47,3 +47,112 @@ func TestTimeWheel_Wheel(t *testing.T) {
 	d := time.Since(start)
 	assert.True(t, d < 16*time.Second)
 }
+
+func TestTimeWheel_PauseResume(t *testing.T) {
+	tw, _ := NewTimeWheel(&pb.JobConfiguration{
+		Rate:  1.0,
+		Begin: replayBegin,
+		End:   replayEnd,
+		Speed: 1.0,
+	})
+	tw.WithHavok(DefaultHavok)
+
+	var sent []time.Time
+	tw.dispatched = func(*LogRecordWrapper) { sent = append(sent, time.Now()) }
+	go func() {
+		for i := int64(0); i < 5; i++ {
+			tw.Recv() <- genLogRecord(replayBegin + i*100)
+		}
+		close(tw.inbox)
+	}()
+
+	assert.False(t, tw.Resume())
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		assert.True(t, tw.Pause())
+		assert.False(t, tw.Pause())
+		assert.Equal(t, StatusPaused, tw.Status())
+		time.Sleep(300 * time.Millisecond)
+		assert.True(t, tw.Resume())
+	}()
+
+	start := time.Now()
+	assert.Nil(t, tw.Start())
+	assert.Len(t, sent, 5)
+	// 暂停300ms，之后的日志整体推迟，且恢复后不会集中发出
+	assert.True(t, sent[1].Sub(start) < 150*time.Millisecond)
+	assert.True(t, sent[2].Sub(start) >= 500*time.Millisecond)
+	for i := 3; i < 5; i++ {
+		assert.True(t, sent[i].Sub(sent[i-1]) > 80*time.Millisecond, sent[i].Sub(sent[i-1]))
+	}
+}
+
+func TestTimeWheel_StopWhilePaused(t *testing.T) {
+	tw, _ := NewTimeWheel(&pb.JobConfiguration{
+		Rate:  1.0,
+		Begin: replayBegin,
+		End:   replayEnd,
+		Speed: 1.0,
+	})
+	tw.WithHavok(DefaultHavok)
+	go func() {
+		tw.Recv() <- genLogRecord(replayBegin)
+		tw.Recv() <- genLogRecord(replayBegin + 10000)
+	}()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tw.Pause()
+		time.Sleep(50 * time.Millisecond)
+		tw.Stop()
+	}()
+	assert.Equal(t, ErrTaskInterrupted, tw.Start())
+	assert.Equal(t, StatusStopped, tw.Status())
+}
+
+func TestTimeWheel_IdleCompression(t *testing.T) {
+	tw, _ := NewTimeWheel(&pb.JobConfiguration{
+		Rate:  1.0,
+		Begin: replayBegin,
+		End:   replayEnd,
+		Speed: 1.0,
+	})
+	tw.WithHavok(DefaultHavok).WithIdleCompression(time.Second, 200*time.Millisecond)
+
+	var sent []time.Time
+	tw.dispatched = func(*LogRecordWrapper) { sent = append(sent, time.Now()) }
+	go func() {
+		for _, ms := range []int64{0, 100, 30000, 30100, 30200} {
+			tw.Recv() <- genLogRecord(replayBegin + ms)
+		}
+		close(tw.inbox)
+	}()
+
+	start := time.Now()
+	assert.Nil(t, tw.Start())
+	assert.Len(t, sent, 5)
+	assert.True(t, time.Since(start) < time.Second)
+	// 空闲间隔压缩为200ms，突发内部的100ms间隔保持不变
+	assert.True(t, sent[2].Sub(sent[1]) >= 180*time.Millisecond, sent[2].Sub(sent[1]))
+	assert.True(t, sent[4].Sub(sent[3]) >= 80*time.Millisecond, sent[4].Sub(sent[3]))
+
+	stats := tw.PerformanceStats()
+	assert.Equal(t, 1.0, stats["idle_gaps"])
+	assert.True(t, stats["idle_compressed_ms"] > 29600 && stats["idle_compressed_ms"] <= 29700, stats["idle_compressed_ms"])
+
+	// 日志到达较晚、回放时钟已经走过一部分间隔时，仍然等待idleMax
+	tw, _ = NewTimeWheel(&pb.JobConfiguration{Rate: 1.0, Begin: replayBegin, End: replayEnd, Speed: 1.0})
+	tw.WithHavok(DefaultHavok).WithIdleCompression(time.Second, 200*time.Millisecond)
+	sent = nil
+	tw.dispatched = func(*LogRecordWrapper) { sent = append(sent, time.Now()) }
+	go func() {
+		tw.Recv() <- genLogRecord(replayBegin)
+		time.Sleep(300 * time.Millisecond)
+		tw.Recv() <- genLogRecord(replayBegin + 1500)
+		close(tw.inbox)
+	}()
+	assert.Nil(t, tw.Start())
+	assert.Len(t, sent, 2)
+	assert.True(t, sent[1].Sub(sent[0]) >= 480*time.Millisecond, sent[1].Sub(sent[0]))
+	stats = tw.PerformanceStats()
+	assert.True(t, stats["idle_compressed_ms"] > 900 && stats["idle_compressed_ms"] <= 1000, stats["idle_compressed_ms"])
+}
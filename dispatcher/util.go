@@ -73,6 +73,14 @@ func renderError(w http.ResponseWriter, err error) {
 		"application/json")
 }
 
+// renderStatusError 以指定的HTTP状态码返回错误，用于需要调用方根据状态码处理的接口，如429
+func renderStatusError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(map[string]interface{}{"code": status, "err_msg": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
 func renderResponse(w http.ResponseWriter, b []byte, contentType string) {
 	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
@@ -21,6 +21,7 @@ import (
 type (
 	Replayer struct {
 		replayRate  float32
+		apiRates    map[HTTPAPI]float32 // 按API调整的回放增益，与replayRate相乘
 		PH          *ProcessorHub
 		Selector    APISelector
 		Concurrency int
@@ -74,7 +75,6 @@ func NewReplayer(rate float32, pc *ProcessorHub, c int, keepAlive bool) *Replaye
 
 func (rep *Replayer) Run() {
 	for logRecord := range replayerPipeline {
-		rate := rep.replayRate
 		var api HTTPAPI = "default"
 		reqURL, err := url.Parse(logRecord.Url)
 		if err != nil {
@@ -91,6 +91,7 @@ func (rep *Replayer) Run() {
 			api = rep.Selector(reqURL, logRecord.Header, logRecord.Method, logRecord.Body)
 		}
 
+		rate := rep.rate(api)
 		for rate > 0 {
 			if rate < 1 {
 				if r := rand.Float32(); r >= rate {
@@ -117,6 +118,13 @@ func (rep *Replayer) refreshReplayerConfig(jobConfig *dispatcher.JobConfiguratio
 			rep.replayRate = jobConfig.Rate
 			Logger.Info("refresh replayer rate", zap.Float32("rate", jobConfig.Rate))
 		}
+		if !equalAPIRates(rep.apiRates, jobConfig.ApiRates) {
+			rep.apiRates = make(map[HTTPAPI]float32, len(jobConfig.ApiRates))
+			for api, rate := range jobConfig.ApiRates {
+				rep.apiRates[HTTPAPI(api)] = rate
+			}
+			Logger.Info("refresh replayer api rates", zap.Any("api_rates", jobConfig.ApiRates))
+		}
 		stuck := time.Duration(jobConfig.Stuck)
 		if rep.stuck != stuck {
 			rep.stuck = stuck
@@ -126,6 +134,28 @@ func (rep *Replayer) refreshReplayerConfig(jobConfig *dispatcher.JobConfiguratio
 
 }
 
+// rate 返回api的回放增益，设置了按API的增益时与全局增益相乘
+func (rep *Replayer) rate(api HTTPAPI) float32 {
+	rep.lock.RLock()
+	defer rep.lock.RUnlock()
+	if r, ok := rep.apiRates[api]; ok {
+		return rep.replayRate * r
+	}
+	return rep.replayRate
+}
+
+func equalAPIRates(current map[HTTPAPI]float32, rates map[string]float32) bool {
+	if len(current) != len(rates) {
+		return false
+	}
+	for api, rate := range rates {
+		if r, ok := current[HTTPAPI(api)]; !ok || r != rate {
+			return false
+		}
+	}
+	return true
+}
+
 // 保证一定时间内stuck只会出现一次>0的情况
 func (rep *Replayer) getStuck() time.Duration {
 	rep.lock.Lock()
@@ -0,0 +1,47 @@
+package replayer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	dispatcher "github.com/wosai/havok/pkg/genproto"
+)
+
+func TestReplayer_Rate(t *testing.T) {
+	rep := NewReplayer(2, nil, 1, false)
+	assert.EqualValues(t, 2, rep.rate("/pay/precreate"))
+
+	// 按API的增益与全局增益相乘，未配置的API只使用全局增益
+	rep.refreshReplayerConfig(&dispatcher.JobConfiguration{Rate: 2, ApiRates: map[string]float32{"/pay/precreate": 5, "/health": 0}})
+	assert.EqualValues(t, 10, rep.rate("/pay/precreate"))
+	assert.EqualValues(t, 0, rep.rate("/health"))
+	assert.EqualValues(t, 2, rep.rate("/query"))
+
+	// 全局增益变化时同样生效
+	rep.refreshReplayerConfig(&dispatcher.JobConfiguration{Rate: 0.5, ApiRates: map[string]float32{"/pay/precreate": 5, "/health": 0}})
+	assert.EqualValues(t, 2.5, rep.rate("/pay/precreate"))
+	assert.EqualValues(t, 0.5, rep.rate("/query"))
+}
+
+func TestReplayer_RefreshAPIRates(t *testing.T) {
+	rep := NewReplayer(1, nil, 1, false)
+	rates := map[string]float32{"/pay/precreate": 5}
+	rep.refreshReplayerConfig(&dispatcher.JobConfiguration{Rate: 1, ApiRates: rates})
+	assert.True(t, equalAPIRates(rep.apiRates, rates))
+	rates["/pay/precreate"] = 1 // 保存的是副本
+	assert.EqualValues(t, 5, rep.rate("/pay/precreate"))
+
+	// 整体替换，不在新配置中的API恢复为全局增益
+	rep.refreshReplayerConfig(&dispatcher.JobConfiguration{Rate: 1, ApiRates: map[string]float32{"/refund": 3}})
+	assert.EqualValues(t, 1, rep.rate("/pay/precreate"))
+	assert.EqualValues(t, 3, rep.rate("/refund"))
+
+	// 空配置表示清除
+	rep.refreshReplayerConfig(&dispatcher.JobConfiguration{Rate: 1})
+	assert.Empty(t, rep.apiRates)
+	assert.EqualValues(t, 1, rep.rate("/refund"))
+
+	assert.True(t, equalAPIRates(nil, map[string]float32{}))
+	assert.False(t, equalAPIRates(map[HTTPAPI]float32{"/a": 1}, map[string]float32{"/a": 2}))
+	assert.False(t, equalAPIRates(map[HTTPAPI]float32{"/a": 1}, map[string]float32{"/b": 1}))
+}
@@ -310,22 +310,87 @@ func (x *LogRecord) GetBody() []byte {
 	return nil
 }
 
+// CapturedRecord 抓取文件中的一条日志，文件内容为gzip压缩的varint长度前缀加CapturedRecord序列
+type CapturedRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Log       *LogRecord `protobuf:"bytes,1,opt,name=log,proto3" json:"log,omitempty"`
+	OccurAt   int64      `protobuf:"varint,2,opt,name=occur_at,json=occurAt,proto3" json:"occur_at,omitempty"`      // 日志时间，纳秒级别
+	HashField string     `protobuf:"bytes,3,opt,name=hash_field,json=hashField,proto3" json:"hash_field,omitempty"` // 用于分发的哈希字段
+}
+
+func (x *CapturedRecord) Reset() {
+	*x = CapturedRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_havok_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CapturedRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapturedRecord) ProtoMessage() {}
+
+func (x *CapturedRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_havok_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapturedRecord.ProtoReflect.Descriptor instead.
+func (*CapturedRecord) Descriptor() ([]byte, []int) {
+	return file_havok_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CapturedRecord) GetLog() *LogRecord {
+	if x != nil {
+		return x.Log
+	}
+	return nil
+}
+
+func (x *CapturedRecord) GetOccurAt() int64 {
+	if x != nil {
+		return x.OccurAt
+	}
+	return 0
+}
+
+func (x *CapturedRecord) GetHashField() string {
+	if x != nil {
+		return x.HashField
+	}
+	return ""
+}
+
 type JobConfiguration struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Rate  float32 `protobuf:"fixed32,1,opt,name=rate,proto3" json:"rate,omitempty"`   // 回放增益倍数，1.0表示1:1回放，2.0表示放大一倍回放
-	Speed float32 `protobuf:"fixed32,2,opt,name=speed,proto3" json:"speed,omitempty"` // 回放速度， 1.0表示原速回放，2.0表示快放一倍
-	Begin int64   `protobuf:"varint,3,opt,name=begin,proto3" json:"begin,omitempty"`  // 开始回放时间，毫秒级别
-	End   int64   `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`      // 结束回放时间，毫秒级别
-	Stuck int64   `protobuf:"varint,5,opt,name=stuck,proto3" json:"stuck,omitempty"`  //模拟流量锯齿特性(临时阻塞replayer消费)
+	Rate     float32            `protobuf:"fixed32,1,opt,name=rate,proto3" json:"rate,omitempty"`                                                                                                                 // 回放增益倍数，1.0表示1:1回放，2.0表示放大一倍回放
+	Speed    float32            `protobuf:"fixed32,2,opt,name=speed,proto3" json:"speed,omitempty"`                                                                                                               // 回放速度， 1.0表示原速回放，2.0表示快放一倍
+	Begin    int64              `protobuf:"varint,3,opt,name=begin,proto3" json:"begin,omitempty"`                                                                                                                // 开始回放时间，毫秒级别
+	End      int64              `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`                                                                                                                    // 结束回放时间，毫秒级别
+	Stuck    int64              `protobuf:"varint,5,opt,name=stuck,proto3" json:"stuck,omitempty"`                                                                                                                //模拟流量锯齿特性(临时阻塞replayer消费)
+	ApiRates map[string]float32 `protobuf:"bytes,6,rep,name=api_rates,json=apiRates,proto3" json:"api_rates,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed32,2,opt,name=value,proto3"` // 按API调整回放增益，键为replayer的APISelector计算出的API，实际倍数为rate乘以该值，0表示不回放该API
 }
 
 func (x *JobConfiguration) Reset() {
 	*x = JobConfiguration{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_havok_proto_msgTypes[3]
+		mi := &file_havok_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -338,7 +403,7 @@ func (x *JobConfiguration) String() string {
 func (*JobConfiguration) ProtoMessage() {}
 
 func (x *JobConfiguration) ProtoReflect() protoreflect.Message {
-	mi := &file_havok_proto_msgTypes[3]
+	mi := &file_havok_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -351,7 +416,7 @@ func (x *JobConfiguration) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use JobConfiguration.ProtoReflect.Descriptor instead.
 func (*JobConfiguration) Descriptor() ([]byte, []int) {
-	return file_havok_proto_rawDescGZIP(), []int{3}
+	return file_havok_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *JobConfiguration) GetRate() float32 {
@@ -389,6 +454,13 @@ func (x *JobConfiguration) GetStuck() int64 {
 	return 0
 }
 
+func (x *JobConfiguration) GetApiRates() map[string]float32 {
+	if x != nil {
+		return x.ApiRates
+	}
+	return nil
+}
+
 type StatsRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -401,7 +473,7 @@ type StatsRequest struct {
 func (x *StatsRequest) Reset() {
 	*x = StatsRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_havok_proto_msgTypes[4]
+		mi := &file_havok_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -414,7 +486,7 @@ func (x *StatsRequest) String() string {
 func (*StatsRequest) ProtoMessage() {}
 
 func (x *StatsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_havok_proto_msgTypes[4]
+	mi := &file_havok_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -427,7 +499,7 @@ func (x *StatsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
 func (*StatsRequest) Descriptor() ([]byte, []int) {
-	return file_havok_proto_rawDescGZIP(), []int{4}
+	return file_havok_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *StatsRequest) GetRequestId() int32 {
@@ -459,7 +531,7 @@ type StatsReport struct {
 func (x *StatsReport) Reset() {
 	*x = StatsReport{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_havok_proto_msgTypes[5]
+		mi := &file_havok_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -472,7 +544,7 @@ func (x *StatsReport) String() string {
 func (*StatsReport) ProtoMessage() {}
 
 func (x *StatsReport) ProtoReflect() protoreflect.Message {
-	mi := &file_havok_proto_msgTypes[5]
+	mi := &file_havok_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -485,7 +557,7 @@ func (x *StatsReport) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatsReport.ProtoReflect.Descriptor instead.
 func (*StatsReport) Descriptor() ([]byte, []int) {
-	return file_havok_proto_rawDescGZIP(), []int{5}
+	return file_havok_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *StatsReport) GetReplayerId() string {
@@ -545,7 +617,7 @@ type AttackerStatsWrapper struct {
 func (x *AttackerStatsWrapper) Reset() {
 	*x = AttackerStatsWrapper{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_havok_proto_msgTypes[6]
+		mi := &file_havok_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -558,7 +630,7 @@ func (x *AttackerStatsWrapper) String() string {
 func (*AttackerStatsWrapper) ProtoMessage() {}
 
 func (x *AttackerStatsWrapper) ProtoReflect() protoreflect.Message {
-	mi := &file_havok_proto_msgTypes[6]
+	mi := &file_havok_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -571,7 +643,7 @@ func (x *AttackerStatsWrapper) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AttackerStatsWrapper.ProtoReflect.Descriptor instead.
 func (*AttackerStatsWrapper) Descriptor() ([]byte, []int) {
-	return file_havok_proto_rawDescGZIP(), []int{6}
+	return file_havok_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *AttackerStatsWrapper) GetName() string {
@@ -669,7 +741,7 @@ type ReportReturn struct {
 func (x *ReportReturn) Reset() {
 	*x = ReportReturn{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_havok_proto_msgTypes[7]
+		mi := &file_havok_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -682,7 +754,7 @@ func (x *ReportReturn) String() string {
 func (*ReportReturn) ProtoMessage() {}
 
 func (x *ReportReturn) ProtoReflect() protoreflect.Message {
-	mi := &file_havok_proto_msgTypes[7]
+	mi := &file_havok_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -695,7 +767,7 @@ func (x *ReportReturn) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ReportReturn.ProtoReflect.Descriptor instead.
 func (*ReportReturn) Descriptor() ([]byte, []int) {
-	return file_havok_proto_rawDescGZIP(), []int{7}
+	return file_havok_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ReportReturn) GetRequestId() int32 {
@@ -749,115 +821,131 @@ var file_havok_proto_rawDesc = []byte{
 	0x65, 0x72, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
 	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a,
-	0x02, 0x38, 0x01, 0x22, 0x7a, 0x0a, 0x10, 0x4a, 0x6f, 0x62, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
-	0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x02, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73,
-	0x70, 0x65, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x02, 0x52, 0x05, 0x73, 0x70, 0x65, 0x65,
-	0x64, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x65, 0x67, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03,
-	0x52, 0x05, 0x62, 0x65, 0x67, 0x69, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6e, 0x64, 0x18, 0x04,
-	0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x65, 0x6e, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x75,
-	0x63, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x73, 0x74, 0x75, 0x63, 0x6b, 0x22,
-	0x50, 0x0a, 0x0c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x05, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x21,
-	0x0a, 0x0c, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x54, 0x69, 0x6d,
-	0x65, 0x22, 0xc9, 0x02, 0x0a, 0x0b, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72,
-	0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x5f, 0x69, 0x64,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72,
-	0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49,
-	0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x54, 0x69,
-	0x6d, 0x65, 0x12, 0x37, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28,
-	0x0b, 0x32, 0x21, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e,
-	0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61,
-	0x70, 0x70, 0x65, 0x72, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x73, 0x12, 0x5b, 0x0a, 0x11, 0x70,
-	0x65, 0x72, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x73,
-	0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2e, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68,
-	0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74,
-	0x2e, 0x50, 0x65, 0x72, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74,
-	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x10, 0x70, 0x65, 0x72, 0x66, 0x6f, 0x72, 0x6d, 0x61,
-	0x6e, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x1a, 0x43, 0x0a, 0x15, 0x50, 0x65, 0x72, 0x66,
-	0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x02, 0x38, 0x01, 0x22, 0x74, 0x0a, 0x0e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x64, 0x52,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x28, 0x0a, 0x03, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x16, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b,
+	0x2e, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x03, 0x6c, 0x6f, 0x67, 0x12,
+	0x19, 0x0a, 0x08, 0x6f, 0x63, 0x63, 0x75, 0x72, 0x5f, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x07, 0x6f, 0x63, 0x63, 0x75, 0x72, 0x41, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x68, 0x61,
+	0x73, 0x68, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x68, 0x61, 0x73, 0x68, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x22, 0x81, 0x02, 0x0a, 0x10, 0x4a, 0x6f,
+	0x62, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12,
+	0x0a, 0x04, 0x72, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x02, 0x52, 0x04, 0x72, 0x61,
+	0x74, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x70, 0x65, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x02, 0x52, 0x05, 0x73, 0x70, 0x65, 0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x65, 0x67, 0x69,
+	0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x62, 0x65, 0x67, 0x69, 0x6e, 0x12, 0x10,
+	0x0a, 0x03, 0x65, 0x6e, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x65, 0x6e, 0x64,
+	0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x75, 0x63, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x05, 0x73, 0x74, 0x75, 0x63, 0x6b, 0x12, 0x48, 0x0a, 0x09, 0x61, 0x70, 0x69, 0x5f, 0x72, 0x61,
+	0x74, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2b, 0x2e, 0x77, 0x6f, 0x73, 0x61,
+	0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x4a, 0x6f, 0x62, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x41, 0x70, 0x69, 0x52, 0x61, 0x74, 0x65,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x61, 0x70, 0x69, 0x52, 0x61, 0x74, 0x65, 0x73,
+	0x1a, 0x3b, 0x0a, 0x0d, 0x41, 0x70, 0x69, 0x52, 0x61, 0x74, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72,
 	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
 	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x01, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0xa9, 0x07,
-	0x0a, 0x14, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57,
-	0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x72, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
-	0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
-	0x65, 0x73, 0x12, 0x2e, 0x0a, 0x13, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x72, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52,
-	0x11, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69,
-	0x6d, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x6d, 0x69, 0x6e, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x6d,
-	0x69, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2a,
-	0x0a, 0x11, 0x6d, 0x61, 0x78, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x74,
-	0x69, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x6d, 0x61, 0x78, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x58, 0x0a, 0x0d, 0x74, 0x72,
-	0x65, 0x6e, 0x64, 0x5f, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28,
-	0x0b, 0x32, 0x33, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e,
+	0x28, 0x02, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x50, 0x0a,
+	0x0c, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a,
+	0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x21, 0x0a, 0x0c,
+	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x0b, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x22,
+	0xc9, 0x02, 0x0a, 0x0b, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12,
+	0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x49, 0x64,
+	0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12,
+	0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65,
+	0x12, 0x37, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x21, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74,
+	0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70,
+	0x65, 0x72, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x73, 0x12, 0x5b, 0x0a, 0x11, 0x70, 0x65, 0x72,
+	0x66, 0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x05,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x2e, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76,
+	0x6f, 0x6b, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x2e, 0x50,
+	0x65, 0x72, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x10, 0x70, 0x65, 0x72, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x6e, 0x63,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x1a, 0x43, 0x0a, 0x15, 0x50, 0x65, 0x72, 0x66, 0x6f, 0x72,
+	0x6d, 0x61, 0x6e, 0x63, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0xa9, 0x07, 0x0a, 0x14,
 	0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61,
-	0x70, 0x70, 0x65, 0x72, 0x2e, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73,
-	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63,
-	0x63, 0x65, 0x73, 0x73, 0x12, 0x5b, 0x0a, 0x0e, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x5f, 0x66, 0x61,
-	0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x34, 0x2e, 0x77,
-	0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63,
-	0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e,
-	0x54, 0x72, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x45, 0x6e, 0x74,
-	0x72, 0x79, 0x52, 0x0d, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65,
-	0x73, 0x12, 0x5b, 0x0a, 0x0e, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x74, 0x69,
-	0x6d, 0x65, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x34, 0x2e, 0x77, 0x6f, 0x73, 0x61,
-	0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72,
-	0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
-	0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x12, 0x58,
-	0x0a, 0x0d, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x18,
-	0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x33, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61,
-	0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74,
-	0x73, 0x57, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65,
-	0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x66, 0x61, 0x69, 0x6c,
-	0x75, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72,
-	0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x73, 0x74,
-	0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x6c, 0x61, 0x73, 0x74, 0x5f,
-	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0c, 0x20, 0x01,
-	0x28, 0x03, 0x52, 0x0f, 0x6c, 0x61, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x54,
-	0x69, 0x6d, 0x65, 0x1a, 0x3f, 0x0a, 0x11, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63,
-	0x65, 0x73, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18,
+	0x70, 0x70, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x72, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73,
+	0x12, 0x2e, 0x0a, 0x13, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x11, 0x74,
+	0x6f, 0x74, 0x61, 0x6c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65,
+	0x12, 0x2a, 0x0a, 0x11, 0x6d, 0x69, 0x6e, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x6d, 0x69, 0x6e,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2a, 0x0a, 0x11,
+	0x6d, 0x61, 0x78, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x74, 0x69, 0x6d,
+	0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x6d, 0x61, 0x78, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x58, 0x0a, 0x0d, 0x74, 0x72, 0x65, 0x6e,
+	0x64, 0x5f, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x33, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74,
+	0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70,
+	0x65, 0x72, 0x2e, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x65,
+	0x73, 0x73, 0x12, 0x5b, 0x0a, 0x0e, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x5f, 0x66, 0x61, 0x69, 0x6c,
+	0x75, 0x72, 0x65, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x34, 0x2e, 0x77, 0x6f, 0x73,
+	0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65,
+	0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e, 0x54, 0x72,
+	0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x52, 0x0d, 0x74, 0x72, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x12,
+	0x5b, 0x0a, 0x0e, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x34, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e,
+	0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74,
+	0x61, 0x74, 0x73, 0x57, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0d, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x12, 0x58, 0x0a, 0x0d,
+	0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x18, 0x0a, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x33, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f,
+	0x6b, 0x2e, 0x41, 0x74, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x73, 0x57,
+	0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x2e, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f,
+	0x74, 0x69, 0x6d, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72,
+	0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x6c, 0x61, 0x73, 0x74, 0x5f, 0x72, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x0f, 0x6c, 0x61, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x54, 0x69, 0x6d,
+	0x65, 0x1a, 0x3f, 0x0a, 0x11, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02,
+	0x38, 0x01, 0x1a, 0x40, 0x0a, 0x12, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x75,
+	0x72, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18,
 	0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61,
 	0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x3a, 0x02, 0x38, 0x01, 0x1a, 0x40, 0x0a, 0x12, 0x54, 0x72, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69,
-	0x6c, 0x75, 0x72, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
+	0x3a, 0x02, 0x38, 0x01, 0x1a, 0x40, 0x0a, 0x12, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
 	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05,
 	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x40, 0x0a, 0x12, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03,
-	0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14,
-	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76,
-	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3f, 0x0a, 0x11, 0x46, 0x61, 0x69, 0x6c,
-	0x75, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a,
-	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
-	0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x2d, 0x0a, 0x0c, 0x52, 0x65, 0x70,
-	0x6f, 0x72, 0x74, 0x52, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x72,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x32, 0x9a, 0x01, 0x0a, 0x05, 0x48, 0x61, 0x76,
-	0x6f, 0x6b, 0x12, 0x50, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12,
-	0x21, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x52, 0x65,
-	0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x1a, 0x1c, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b,
-	0x2e, 0x44, 0x69, 0x73, 0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74,
-	0x22, 0x00, 0x30, 0x01, 0x12, 0x3f, 0x0a, 0x06, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x18,
-	0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x53, 0x74, 0x61,
-	0x74, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x1a, 0x19, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69,
-	0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x74,
-	0x75, 0x72, 0x6e, 0x22, 0x00, 0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
-	0x63, 0x6f, 0x6d, 0x2f, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2f, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2f,
-	0x70, 0x6b, 0x67, 0x2f, 0x67, 0x65, 0x6e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3f, 0x0a, 0x11, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x2d, 0x0a, 0x0c, 0x52, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x52, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x32, 0x9a, 0x01, 0x0a, 0x05, 0x48, 0x61, 0x76, 0x6f, 0x6b,
+	0x12, 0x50, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x21, 0x2e,
+	0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x52, 0x65, 0x70, 0x6c,
+	0x61, 0x79, 0x65, 0x72, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x1a, 0x1c, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x44,
+	0x69, 0x73, 0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x22, 0x00,
+	0x30, 0x01, 0x12, 0x3f, 0x0a, 0x06, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x18, 0x2e, 0x77,
+	0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x1a, 0x19, 0x2e, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2e, 0x68,
+	0x61, 0x76, 0x6f, 0x6b, 0x2e, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x74, 0x75, 0x72,
+	0x6e, 0x22, 0x00, 0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x77, 0x6f, 0x73, 0x61, 0x69, 0x2f, 0x68, 0x61, 0x76, 0x6f, 0x6b, 0x2f, 0x70, 0x6b,
+	0x67, 0x2f, 0x67, 0x65, 0x6e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -873,45 +961,49 @@ func file_havok_proto_rawDescGZIP() []byte {
 }
 
 var file_havok_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_havok_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_havok_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
 var file_havok_proto_goTypes = []interface{}{
 	(DispatcherEvent_Type)(0),    // 0: wosai.havok.DispatcherEvent.Type
 	(*DispatcherEvent)(nil),      // 1: wosai.havok.DispatcherEvent
 	(*ReplayerRegistration)(nil), // 2: wosai.havok.ReplayerRegistration
 	(*LogRecord)(nil),            // 3: wosai.havok.LogRecord
-	(*JobConfiguration)(nil),     // 4: wosai.havok.JobConfiguration
-	(*StatsRequest)(nil),         // 5: wosai.havok.StatsRequest
-	(*StatsReport)(nil),          // 6: wosai.havok.StatsReport
-	(*AttackerStatsWrapper)(nil), // 7: wosai.havok.AttackerStatsWrapper
-	(*ReportReturn)(nil),         // 8: wosai.havok.ReportReturn
-	nil,                          // 9: wosai.havok.LogRecord.HeaderEntry
-	nil,                          // 10: wosai.havok.StatsReport.PerformanceStatsEntry
-	nil,                          // 11: wosai.havok.AttackerStatsWrapper.TrendSuccessEntry
-	nil,                          // 12: wosai.havok.AttackerStatsWrapper.TrendFailuresEntry
-	nil,                          // 13: wosai.havok.AttackerStatsWrapper.ResponseTimesEntry
-	nil,                          // 14: wosai.havok.AttackerStatsWrapper.FailureTimesEntry
+	(*CapturedRecord)(nil),       // 4: wosai.havok.CapturedRecord
+	(*JobConfiguration)(nil),     // 5: wosai.havok.JobConfiguration
+	(*StatsRequest)(nil),         // 6: wosai.havok.StatsRequest
+	(*StatsReport)(nil),          // 7: wosai.havok.StatsReport
+	(*AttackerStatsWrapper)(nil), // 8: wosai.havok.AttackerStatsWrapper
+	(*ReportReturn)(nil),         // 9: wosai.havok.ReportReturn
+	nil,                          // 10: wosai.havok.LogRecord.HeaderEntry
+	nil,                          // 11: wosai.havok.JobConfiguration.ApiRatesEntry
+	nil,                          // 12: wosai.havok.StatsReport.PerformanceStatsEntry
+	nil,                          // 13: wosai.havok.AttackerStatsWrapper.TrendSuccessEntry
+	nil,                          // 14: wosai.havok.AttackerStatsWrapper.TrendFailuresEntry
+	nil,                          // 15: wosai.havok.AttackerStatsWrapper.ResponseTimesEntry
+	nil,                          // 16: wosai.havok.AttackerStatsWrapper.FailureTimesEntry
 }
 var file_havok_proto_depIdxs = []int32{
 	0,  // 0: wosai.havok.DispatcherEvent.type:type_name -> wosai.havok.DispatcherEvent.Type
 	3,  // 1: wosai.havok.DispatcherEvent.log:type_name -> wosai.havok.LogRecord
-	4,  // 2: wosai.havok.DispatcherEvent.job:type_name -> wosai.havok.JobConfiguration
-	5,  // 3: wosai.havok.DispatcherEvent.stats:type_name -> wosai.havok.StatsRequest
-	9,  // 4: wosai.havok.LogRecord.header:type_name -> wosai.havok.LogRecord.HeaderEntry
-	7,  // 5: wosai.havok.StatsReport.stats:type_name -> wosai.havok.AttackerStatsWrapper
-	10, // 6: wosai.havok.StatsReport.performance_stats:type_name -> wosai.havok.StatsReport.PerformanceStatsEntry
-	11, // 7: wosai.havok.AttackerStatsWrapper.trend_success:type_name -> wosai.havok.AttackerStatsWrapper.TrendSuccessEntry
-	12, // 8: wosai.havok.AttackerStatsWrapper.trend_failures:type_name -> wosai.havok.AttackerStatsWrapper.TrendFailuresEntry
-	13, // 9: wosai.havok.AttackerStatsWrapper.response_times:type_name -> wosai.havok.AttackerStatsWrapper.ResponseTimesEntry
-	14, // 10: wosai.havok.AttackerStatsWrapper.failure_times:type_name -> wosai.havok.AttackerStatsWrapper.FailureTimesEntry
-	2,  // 11: wosai.havok.Havok.Subscribe:input_type -> wosai.havok.ReplayerRegistration
-	6,  // 12: wosai.havok.Havok.Report:input_type -> wosai.havok.StatsReport
-	1,  // 13: wosai.havok.Havok.Subscribe:output_type -> wosai.havok.DispatcherEvent
-	8,  // 14: wosai.havok.Havok.Report:output_type -> wosai.havok.ReportReturn
-	13, // [13:15] is the sub-list for method output_type
-	11, // [11:13] is the sub-list for method input_type
-	11, // [11:11] is the sub-list for extension type_name
-	11, // [11:11] is the sub-list for extension extendee
-	0,  // [0:11] is the sub-list for field type_name
+	5,  // 2: wosai.havok.DispatcherEvent.job:type_name -> wosai.havok.JobConfiguration
+	6,  // 3: wosai.havok.DispatcherEvent.stats:type_name -> wosai.havok.StatsRequest
+	10, // 4: wosai.havok.LogRecord.header:type_name -> wosai.havok.LogRecord.HeaderEntry
+	3,  // 5: wosai.havok.CapturedRecord.log:type_name -> wosai.havok.LogRecord
+	11, // 6: wosai.havok.JobConfiguration.api_rates:type_name -> wosai.havok.JobConfiguration.ApiRatesEntry
+	8,  // 7: wosai.havok.StatsReport.stats:type_name -> wosai.havok.AttackerStatsWrapper
+	12, // 8: wosai.havok.StatsReport.performance_stats:type_name -> wosai.havok.StatsReport.PerformanceStatsEntry
+	13, // 9: wosai.havok.AttackerStatsWrapper.trend_success:type_name -> wosai.havok.AttackerStatsWrapper.TrendSuccessEntry
+	14, // 10: wosai.havok.AttackerStatsWrapper.trend_failures:type_name -> wosai.havok.AttackerStatsWrapper.TrendFailuresEntry
+	15, // 11: wosai.havok.AttackerStatsWrapper.response_times:type_name -> wosai.havok.AttackerStatsWrapper.ResponseTimesEntry
+	16, // 12: wosai.havok.AttackerStatsWrapper.failure_times:type_name -> wosai.havok.AttackerStatsWrapper.FailureTimesEntry
+	2,  // 13: wosai.havok.Havok.Subscribe:input_type -> wosai.havok.ReplayerRegistration
+	7,  // 14: wosai.havok.Havok.Report:input_type -> wosai.havok.StatsReport
+	1,  // 15: wosai.havok.Havok.Subscribe:output_type -> wosai.havok.DispatcherEvent
+	9,  // 16: wosai.havok.Havok.Report:output_type -> wosai.havok.ReportReturn
+	15, // [15:17] is the sub-list for method output_type
+	13, // [13:15] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_havok_proto_init() }
@@ -957,7 +1049,7 @@ func file_havok_proto_init() {
 			}
 		}
 		file_havok_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*JobConfiguration); i {
+			switch v := v.(*CapturedRecord); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -969,7 +1061,7 @@ func file_havok_proto_init() {
 			}
 		}
 		file_havok_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatsRequest); i {
+			switch v := v.(*JobConfiguration); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -981,7 +1073,7 @@ func file_havok_proto_init() {
 			}
 		}
 		file_havok_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatsReport); i {
+			switch v := v.(*StatsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -993,7 +1085,7 @@ func file_havok_proto_init() {
 			}
 		}
 		file_havok_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AttackerStatsWrapper); i {
+			switch v := v.(*StatsReport); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1005,6 +1097,18 @@ func file_havok_proto_init() {
 			}
 		}
 		file_havok_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AttackerStatsWrapper); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_havok_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ReportReturn); i {
 			case 0:
 				return &v.state
@@ -1028,7 +1132,7 @@ func file_havok_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_havok_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   14,
+			NumMessages:   16,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
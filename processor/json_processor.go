@@ -377,6 +377,11 @@ func (jp *JSONProcessor) getJSONPath(key string) []string {
 	return v
 }
 
+// ParseJSONPath 将形如data.list[0].id的key解析成buger/jsonparser支持的path，供其他模块复用相同的路径语法
+func ParseJSONPath(key string) []string {
+	return parseJSONPath(key)
+}
+
 func parseJSONPath(key string) []string {
 	var ret []string
 	ks := strings.Split(key, ".")
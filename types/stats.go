@@ -78,7 +78,8 @@ type (
 	}
 
 	PerformanceStat struct {
-		Stats map[string]map[string]float64
+		Stats      map[string]map[string]float64 // replayer的性能统计，以replayer id为键
+		Dispatcher map[string]map[string]float64 // dispatcher自身的性能统计，以来源（如timewheel）为键
 	}
 
 	// AttackerReport Attacker级别的报告